@@ -0,0 +1,93 @@
+// Package blobstore keeps uploaded files such as item images. Store is the
+// extension point for other backends; Disk keeps files under a local
+// directory.
+package blobstore
+
+import (
+    "errors"
+    "io"
+    "os"
+    "path"
+    "path/filepath"
+)
+
+// ErrNotFound is returned when a key has no stored blob.
+var ErrNotFound = errors.New("blob not found")
+
+// Store saves, reads and removes blobs by key. Keys are slash-separated
+// paths such as "items/12-x7Kq.jpg".
+type Store interface {
+    Put(key string, r io.Reader) error
+    Open(key string) (io.ReadCloser, error)
+    Delete(key string) error
+}
+
+// Disk stores blobs as files below a directory.
+type Disk struct {
+    dir string
+}
+
+func NewDisk(dir string) *Disk {
+    return &Disk{dir: dir}
+}
+
+// path maps a key to a file below the directory. Cleaning it as an absolute
+// path first drops any ".." so a key cannot escape the directory.
+func (d *Disk) path(key string) (string, error) {
+    clean := path.Clean("/" + key)
+    if clean == "/" {
+        return "", errors.New("blob key is empty")
+    }
+    return filepath.Join(d.dir, filepath.FromSlash(clean[1:])), nil
+}
+
+// Put writes the blob to a temporary file and renames it into place, so
+// readers never see a partial file.
+func (d *Disk) Put(key string, r io.Reader) error {
+    name, err := d.path(key)
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+        return err
+    }
+
+    f, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+    if err != nil {
+        return err
+    }
+    defer os.Remove(f.Name())
+
+    if _, err := io.Copy(f, r); err != nil {
+        f.Close()
+        return err
+    }
+    if err := f.Close(); err != nil {
+        return err
+    }
+    return os.Rename(f.Name(), name)
+}
+
+func (d *Disk) Open(key string) (io.ReadCloser, error) {
+    name, err := d.path(key)
+    if err != nil {
+        return nil, err
+    }
+    f, err := os.Open(name)
+    if os.IsNotExist(err) {
+        return nil, ErrNotFound
+    }
+    return f, err
+}
+
+// Delete removes the blob. Deleting a missing blob is not an error.
+func (d *Disk) Delete(key string) error {
+    name, err := d.path(key)
+    if err != nil {
+        return err
+    }
+    if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+        return err
+    }
+    return nil
+}
@@ -2,6 +2,7 @@ package config
 
 import (
     "os"
+    "time"
     "github.com/joho/godotenv"
 )
 
@@ -13,6 +14,20 @@ type Config struct {
     DBName          string
     ServerPort      string
     UseWindowsAuth  bool
+    JWTSecret       string
+    AccessTokenTTL  time.Duration
+    RefreshTokenTTL time.Duration
+    AdminUsername   string
+    AdminPassword   string
+
+    // InvoiceSigningKey is a base64 Ed25519 seed used to sign the invoice chain
+    InvoiceSigningKey string
+
+    // StockCheckInterval is how often low-stock alerts are refreshed
+    StockCheckInterval time.Duration
+
+    // ImageDir is where uploaded item images are stored
+    ImageDir string
 }
 
 func LoadConfig() *Config {
@@ -21,13 +36,24 @@ func LoadConfig() *Config {
     useWindowsAuth := getEnv("USE_WINDOWS_AUTH", "false") == "true"
     
     return &Config{
-        DBServer:       getEnv("DB_SERVER", "localhost"),
-        DBPort:         getEnv("DB_PORT", "1433"),
-        DBUser:         getEnv("DB_USER", ""),
-        DBPassword:     getEnv("DB_PASSWORD", ""),
-        DBName:         getEnv("DB_NAME", "PizzaShopDB"),
-        ServerPort:     getEnv("SERVER_PORT", "8080"),
-        UseWindowsAuth: useWindowsAuth,
+        DBServer:        getEnv("DB_SERVER", "localhost"),
+        DBPort:          getEnv("DB_PORT", "1433"),
+        DBUser:          getEnv("DB_USER", ""),
+        DBPassword:      getEnv("DB_PASSWORD", ""),
+        DBName:          getEnv("DB_NAME", "PizzaShopDB"),
+        ServerPort:      getEnv("SERVER_PORT", "8080"),
+        UseWindowsAuth:  useWindowsAuth,
+        JWTSecret:       getEnv("JWT_SECRET", ""),
+        AccessTokenTTL:  getDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+        RefreshTokenTTL: getDuration("REFRESH_TOKEN_TTL", 7*24*time.Hour),
+        AdminUsername:   getEnv("ADMIN_USERNAME", "admin"),
+        AdminPassword:   getEnv("ADMIN_PASSWORD", ""),
+
+        InvoiceSigningKey: getEnv("INVOICE_SIGNING_KEY", ""),
+
+        StockCheckInterval: getDuration("STOCK_CHECK_INTERVAL", 24*time.Hour),
+
+        ImageDir: getEnv("IMAGE_DIR", "uploads"),
     }
 }
 
@@ -36,4 +62,13 @@ func getEnv(key, defaultValue string) string {
         return value
     }
     return defaultValue
-}
\ No newline at end of file
+}
+
+func getDuration(key string, defaultValue time.Duration) time.Duration {
+    if value := os.Getenv(key); value != "" {
+        if d, err := time.ParseDuration(value); err == nil {
+            return d
+        }
+    }
+    return defaultValue
+}
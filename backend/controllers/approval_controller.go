@@ -0,0 +1,37 @@
+package controllers
+
+import (
+    "net/http"
+    "backend/middleware"
+    "backend/models"
+    "backend/services"
+
+    "github.com/gin-gonic/gin"
+)
+
+type ApprovalController struct {
+    approvalService *services.ApprovalService
+}
+
+func NewApprovalController() *ApprovalController {
+    return &ApprovalController{
+        approvalService: services.NewApprovalService(),
+    }
+}
+
+// CreateApproval exchanges a manager's username and PIN for a single-use
+// approval token the signed-in user passes to the action it authorises.
+func (c *ApprovalController) CreateApproval(ctx *gin.Context) {
+    var req models.ApprovalRequest
+    if !bindJSON(ctx, &req) {
+        return
+    }
+    
+    approval, err := c.approvalService.Approve(&req, middleware.CurrentUser(ctx))
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    ctx.JSON(http.StatusCreated, gin.H{"data": approval})
+}
@@ -0,0 +1,69 @@
+package controllers
+
+import (
+    "fmt"
+    "strconv"
+    "backend/models"
+    "backend/services"
+
+    "github.com/gin-gonic/gin"
+)
+
+type AuditController struct {
+    auditService *services.AuditService
+}
+
+func NewAuditController() *AuditController {
+    return &AuditController{
+        auditService: services.NewAuditService(),
+    }
+}
+
+// GetAudit lists audit entries. Filters: entity_type, entity_id, user_id,
+// action and an inclusive from/to date range (YYYY-MM-DD).
+func (c *AuditController) GetAudit(ctx *gin.Context) {
+    filter, err := parseAuditFilter(ctx)
+    if err != nil {
+        badRequest(ctx, err.Error())
+        return
+    }
+    
+    entries, total, err := c.auditService.ListAudit(filter)
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    respondPage(ctx, entries, filter.ListParams, total)
+}
+
+func parseAuditFilter(ctx *gin.Context) (models.AuditFilter, error) {
+    var filter models.AuditFilter
+    
+    params, err := parseListParams(ctx)
+    if err != nil {
+        return filter, err
+    }
+    filter.ListParams = params
+    filter.EntityType = ctx.Query("entity_type")
+    filter.Action = ctx.Query("action")
+    
+    if v := ctx.Query("entity_id"); v != "" {
+        id, err := strconv.Atoi(v)
+        if err != nil {
+            return filter, fmt.Errorf("entity_id must be a number")
+        }
+        filter.EntityID = &id
+    }
+    
+    if v := ctx.Query("user_id"); v != "" {
+        id, err := strconv.Atoi(v)
+        if err != nil {
+            return filter, fmt.Errorf("user_id must be a number")
+        }
+        filter.UserID = &id
+    }
+    
+    filter.From, filter.To, err = parseDateBounds(ctx)
+    return filter, err
+}
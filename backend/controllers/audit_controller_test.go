@@ -0,0 +1,61 @@
+package controllers
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+func auditFilterTest(query string) (*time.Time, *time.Time, error) {
+    ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+    ctx.Request = httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+    filter, err := parseAuditFilter(ctx)
+    return filter.From, filter.To, err
+}
+
+func TestParseAuditFilterDates(t *testing.T) {
+    day := func(d int) *time.Time {
+        t := time.Date(2026, 10, d, 0, 0, 0, 0, time.Local)
+        return &t
+    }
+
+    tests := []struct {
+        query   string
+        from    *time.Time
+        to      *time.Time
+        wantErr bool
+    }{
+        {"", nil, nil, false},
+        {"from=2026-10-01", day(1), nil, false},
+        // to is inclusive, as in the reports
+        {"to=2026-10-18", nil, day(19), false},
+        {"from=2026-10-18&to=2026-10-18", day(18), day(19), false},
+        {"from=2026-10-19&to=2026-10-18", nil, nil, true},
+        {"from=18.10.2026", nil, nil, true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.query, func(t *testing.T) {
+            from, to, err := auditFilterTest(tt.query)
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+            }
+            if tt.wantErr {
+                return
+            }
+            if !sameTime(from, tt.from) || !sameTime(to, tt.to) {
+                t.Errorf("got %v to %v, want %v to %v", from, to, tt.from, tt.to)
+            }
+        })
+    }
+}
+
+func sameTime(a, b *time.Time) bool {
+    if a == nil || b == nil {
+        return a == b
+    }
+    return a.Equal(*b)
+}
@@ -0,0 +1,100 @@
+package controllers
+
+import (
+    "net/http"
+    "backend/middleware"
+    "backend/models"
+    "backend/services"
+
+    "github.com/gin-gonic/gin"
+)
+
+type AuthController struct {
+    authService *services.AuthService
+}
+
+func NewAuthController(authService *services.AuthService) *AuthController {
+    return &AuthController{
+        authService: authService,
+    }
+}
+
+func (c *AuthController) Login(ctx *gin.Context) {
+    var req models.LoginRequest
+    if !bindJSON(ctx, &req) {
+        return
+    }
+    
+    tokens, err := c.authService.Login(req.Username, req.Password)
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    ctx.JSON(http.StatusOK, gin.H{"data": tokens})
+}
+
+func (c *AuthController) Refresh(ctx *gin.Context) {
+    var req models.RefreshRequest
+    if !bindJSON(ctx, &req) {
+        return
+    }
+    
+    tokens, err := c.authService.Refresh(req.RefreshToken)
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    ctx.JSON(http.StatusOK, gin.H{"data": tokens})
+}
+
+func (c *AuthController) Logout(ctx *gin.Context) {
+    // The refresh token is optional; without it only the access token is revoked
+    var req struct {
+        RefreshToken string `json:"refresh_token"`
+    }
+    if ctx.Request.ContentLength > 0 && !bindJSON(ctx, &req) {
+        return
+    }
+    
+    if err := c.authService.Logout(middleware.CurrentClaims(ctx), req.RefreshToken); err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    ctx.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+func (c *AuthController) Me(ctx *gin.Context) {
+    ctx.JSON(http.StatusOK, gin.H{"data": middleware.CurrentUser(ctx)})
+}
+
+func (c *AuthController) ChangePassword(ctx *gin.Context) {
+    var req models.ChangePasswordRequest
+    if !bindJSON(ctx, &req) {
+        return
+    }
+    
+    user := middleware.CurrentUser(ctx)
+    if err := c.authService.ChangePassword(user.UserID, req.CurrentPassword, req.NewPassword); err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    ctx.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
+}
+
+func (c *AuthController) SetPin(ctx *gin.Context) {
+    var req models.SetPinRequest
+    if !bindJSON(ctx, &req) {
+        return
+    }
+    
+    if err := c.authService.SetPin(middleware.CurrentUser(ctx), req.Password, req.Pin); err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    ctx.JSON(http.StatusOK, gin.H{"message": "PIN set successfully"})
+}
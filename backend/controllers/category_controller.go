@@ -1,10 +1,15 @@
 package controllers
 
 import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
     "net/http"
     "strconv"
+    "backend/middleware"
     "backend/models"
     "backend/services"
+    "backend/spreadsheet"
     
     "github.com/gin-gonic/gin"
 )
@@ -20,9 +25,31 @@ func NewCategoryController() *CategoryController {
 }
 
 func (c *CategoryController) GetCategories(ctx *gin.Context) {
-    categories, err := c.categoryService.GetAllCategories()
+    format, ok := exportFormat(ctx)
+    if !ok {
+        return
+    }
+    
+    includeArchived := ctx.Query("include_archived") == "true"
+    if format != "" {
+        header := []interface{}{"category_id", "category_name", "description", "parent_category_id", "sort_order", "is_active",
+            "archived_at"}
+        streamExport(ctx, format, "categories", header, func(w spreadsheet.Writer) error {
+            return c.categoryService.EachCategory(includeArchived, func(category models.Category) error {
+                var parentID interface{}
+                if category.ParentCategoryID != nil {
+                    parentID = *category.ParentCategoryID
+                }
+                return w.WriteRow(category.CategoryID, category.CategoryName, category.Description,
+                    parentID, category.SortOrder, *category.IsActive, category.ArchivedAt)
+            })
+        })
+        return
+    }
+    
+    categories, err := c.categoryService.GetAllCategories(includeArchived)
     if err != nil {
-        ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        respondError(ctx, err)
         return
     }
     
@@ -31,13 +58,12 @@ func (c *CategoryController) GetCategories(ctx *gin.Context) {
 
 func (c *CategoryController) CreateCategory(ctx *gin.Context) {
     var category models.Category
-    if err := ctx.ShouldBindJSON(&category); err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    if !bindJSON(ctx, &category) {
         return
     }
     
-    if err := c.categoryService.CreateCategory(&category); err != nil {
-        ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+    if err := c.categoryService.CreateCategory(&category, middleware.CurrentUser(ctx)); err != nil {
+        respondError(ctx, err)
         return
     }
     
@@ -47,19 +73,23 @@ func (c *CategoryController) CreateCategory(ctx *gin.Context) {
 func (c *CategoryController) UpdateCategory(ctx *gin.Context) {
     id, err := strconv.Atoi(ctx.Param("id"))
     if err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+        badRequest(ctx, "Invalid category ID")
         return
     }
     
-    var category models.Category
-    if err := ctx.ShouldBindJSON(&category); err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    // Fields left out of the body keep their stored values
+    category, err := c.categoryService.GetCategoryByID(id)
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+    if !bindJSON(ctx, category) {
         return
     }
     
     category.CategoryID = id
-    if err := c.categoryService.UpdateCategory(&category); err != nil {
-        ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+    if err := c.categoryService.UpdateCategory(category, middleware.CurrentUser(ctx)); err != nil {
+        respondError(ctx, err)
         return
     }
     
@@ -69,30 +99,105 @@ func (c *CategoryController) UpdateCategory(ctx *gin.Context) {
 func (c *CategoryController) DeleteCategory(ctx *gin.Context) {
     id, err := strconv.Atoi(ctx.Param("id"))
     if err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+        badRequest(ctx, "Invalid category ID")
         return
     }
     
-    if err := c.categoryService.DeleteCategory(id); err != nil {
-        ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+    if err := c.categoryService.DeleteCategory(id, middleware.CurrentUser(ctx)); err != nil {
+        respondError(ctx, err)
         return
     }
     
     ctx.JSON(http.StatusOK, gin.H{"message": "Category deleted successfully"})
 }
 
+// ArchiveCategory hides a category whose items and subcategories are all
+// archived.
+func (c *CategoryController) ArchiveCategory(ctx *gin.Context) {
+    c.setArchived(ctx, true)
+}
+
+// RestoreCategory brings an archived category back.
+func (c *CategoryController) RestoreCategory(ctx *gin.Context) {
+    c.setArchived(ctx, false)
+}
+
+func (c *CategoryController) setArchived(ctx *gin.Context, archived bool) {
+    id, err := strconv.Atoi(ctx.Param("id"))
+    if err != nil {
+        badRequest(ctx, "Invalid category ID")
+        return
+    }
+    
+    var category *models.Category
+    if archived {
+        category, err = c.categoryService.ArchiveCategory(id, middleware.CurrentUser(ctx))
+    } else {
+        category, err = c.categoryService.RestoreCategory(id, middleware.CurrentUser(ctx))
+    }
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    ctx.JSON(http.StatusOK, gin.H{"data": category})
+}
+
 func (c *CategoryController) GetCategory(ctx *gin.Context) {
     id, err := strconv.Atoi(ctx.Param("id"))
     if err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+        badRequest(ctx, "Invalid category ID")
         return
     }
     
     category, err := c.categoryService.GetCategoryByID(id)
     if err != nil {
-        ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        respondError(ctx, err)
         return
     }
     
     ctx.JSON(http.StatusOK, gin.H{"data": category})
-}
\ No newline at end of file
+}
+
+// GetMenuTree returns the nested menu. Pass include_hidden=true to also see
+// inactive categories and hidden items.
+func (c *CategoryController) GetMenuTree(ctx *gin.Context) {
+    tree, err := c.categoryService.GetMenuTree(ctx.Query("include_hidden") == "true")
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    ctx.JSON(http.StatusOK, gin.H{"data": tree})
+}
+
+// menuMaxAge is how long browsers and proxies may reuse the public menu
+// before checking it again with its ETag.
+const menuMaxAge = "60"
+
+// GetMenu serves the public, read-only menu. It needs no login. The ETag lets
+// clients revalidate cheaply; an unchanged menu is answered with 304.
+func (c *CategoryController) GetMenu(ctx *gin.Context) {
+    tree, err := c.categoryService.GetPublicMenu()
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    body, err := json.Marshal(gin.H{"data": tree})
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+    sum := sha256.Sum256(body)
+    etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+    
+    ctx.Header("Cache-Control", "public, max-age="+menuMaxAge)
+    ctx.Header("ETag", etag)
+    if ctx.GetHeader("If-None-Match") == etag {
+        ctx.Status(http.StatusNotModified)
+        return
+    }
+    
+    ctx.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
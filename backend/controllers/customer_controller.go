@@ -3,41 +3,69 @@ package controllers
 import (
     "net/http"
     "strconv"
+    "backend/middleware"
     "backend/models"
     "backend/services"
+    "backend/spreadsheet"
     
     "github.com/gin-gonic/gin"
 )
 
 type CustomerController struct {
     customerService *services.CustomerService
+    importService   *services.ImportService
 }
 
 func NewCustomerController() *CustomerController {
     return &CustomerController{
         customerService: services.NewCustomerService(),
+        importService:   services.NewImportService(),
     }
 }
 
 func (c *CustomerController) GetCustomers(ctx *gin.Context) {
-    customers, err := c.customerService.GetAllCustomers()
+    format, ok := exportFormat(ctx)
+    if !ok {
+        return
+    }
+    
+    params, err := parseListParams(ctx)
+    if err != nil {
+        badRequest(ctx, err.Error())
+        return
+    }
+    
+    filter := models.CustomerFilter{ListParams: params, IncludeArchived: ctx.Query("include_archived") == "true"}
+    if format != "" {
+        // Exports contain every matching row rather than a single page
+        filter.Limit, filter.Offset = 0, 0
+        header := []interface{}{"customer_id", "customer_name", "phone", "email", "address", "archived_at"}
+        streamExport(ctx, format, "customers", header, func(w spreadsheet.Writer) error {
+            return c.customerService.EachCustomer(filter, func(customer models.Customer) error {
+                return w.WriteRow(customer.CustomerID, customer.CustomerName, customer.Phone,
+                    customer.Email, customer.Address, customer.ArchivedAt)
+            })
+        })
+        return
+    }
+    
+    customers, total, err := c.customerService.ListCustomers(filter)
     if err != nil {
-        ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        respondError(ctx, err)
         return
     }
     
-    ctx.JSON(http.StatusOK, gin.H{"data": customers})
+    respondPage(ctx, customers, params, total)
 }
 
 func (c *CustomerController) CreateCustomer(ctx *gin.Context) {
     var customer models.Customer
-    if err := ctx.ShouldBindJSON(&customer); err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    if !bindJSON(ctx, &customer) {
         return
     }
     
-    if err := c.customerService.CreateCustomer(&customer); err != nil {
-        ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+    if err := c.customerService.CreateCustomer(&customer, middleware.CurrentUser(ctx)); err != nil {
+        respondError(ctx, err)
         return
     }
     
@@ -47,19 +75,18 @@ func (c *CustomerController) CreateCustomer(ctx *gin.Context) {
 func (c *CustomerController) UpdateCustomer(ctx *gin.Context) {
     id, err := strconv.Atoi(ctx.Param("id"))
     if err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+        badRequest(ctx, "Invalid customer ID")
         return
     }
     
     var customer models.Customer
-    if err := ctx.ShouldBindJSON(&customer); err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    if !bindJSON(ctx, &customer) {
         return
     }
     
     customer.CustomerID = id
-    if err := c.customerService.UpdateCustomer(&customer); err != nil {
-        ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+    if err := c.customerService.UpdateCustomer(&customer, middleware.CurrentUser(ctx)); err != nil {
+        respondError(ctx, err)
         return
     }
     
@@ -69,30 +96,77 @@ func (c *CustomerController) UpdateCustomer(ctx *gin.Context) {
 func (c *CustomerController) DeleteCustomer(ctx *gin.Context) {
     id, err := strconv.Atoi(ctx.Param("id"))
     if err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+        badRequest(ctx, "Invalid customer ID")
         return
     }
     
-    if err := c.customerService.DeleteCustomer(id); err != nil {
-        ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+    if err := c.customerService.DeleteCustomer(id, middleware.CurrentUser(ctx)); err != nil {
+        respondError(ctx, err)
         return
     }
     
     ctx.JSON(http.StatusOK, gin.H{"message": "Customer deleted successfully"})
 }
 
+// ArchiveCustomer hides a customer from the list and from new invoices while
+// keeping their invoice history.
+func (c *CustomerController) ArchiveCustomer(ctx *gin.Context) {
+    c.setArchived(ctx, true)
+}
+
+// RestoreCustomer brings an archived customer back.
+func (c *CustomerController) RestoreCustomer(ctx *gin.Context) {
+    c.setArchived(ctx, false)
+}
+
+func (c *CustomerController) setArchived(ctx *gin.Context, archived bool) {
+    id, err := strconv.Atoi(ctx.Param("id"))
+    if err != nil {
+        badRequest(ctx, "Invalid customer ID")
+        return
+    }
+    
+    var customer *models.Customer
+    if archived {
+        customer, err = c.customerService.ArchiveCustomer(id, middleware.CurrentUser(ctx))
+    } else {
+        customer, err = c.customerService.RestoreCustomer(id, middleware.CurrentUser(ctx))
+    }
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    ctx.JSON(http.StatusOK, gin.H{"data": customer})
+}
+
 func (c *CustomerController) GetCustomer(ctx *gin.Context) {
     id, err := strconv.Atoi(ctx.Param("id"))
     if err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+        badRequest(ctx, "Invalid customer ID")
         return
     }
     
     customer, err := c.customerService.GetCustomerByID(id)
     if err != nil {
-        ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        respondError(ctx, err)
         return
     }
     
     ctx.JSON(http.StatusOK, gin.H{"data": customer})
+}
+
+func (c *CustomerController) ImportCustomers(ctx *gin.Context) {
+    rows, ok := readImportFile(ctx)
+    if !ok {
+        return
+    }
+    
+    report, err := c.importService.ImportCustomers(rows, ctx.Query("dry_run") == "true", middleware.CurrentUser(ctx))
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    respondImport(ctx, report)
 }
\ No newline at end of file
@@ -0,0 +1,53 @@
+package controllers
+
+import (
+    "net/http"
+    "backend/middleware"
+    "backend/models"
+    "backend/services"
+
+    "github.com/gin-gonic/gin"
+)
+
+type DrawerController struct {
+    drawerService *services.DrawerService
+}
+
+func NewDrawerController() *DrawerController {
+    return &DrawerController{
+        drawerService: services.NewDrawerService(),
+    }
+}
+
+// OpenDrawer records a no-sale; the till opens the drawer on success.
+func (c *DrawerController) OpenDrawer(ctx *gin.Context) {
+    var req models.NoSaleRequest
+    if !bindJSON(ctx, &req) {
+        return
+    }
+    
+    noSale, err := c.drawerService.OpenDrawer(&req, middleware.CurrentUser(ctx))
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    ctx.JSON(http.StatusCreated, gin.H{"data": noSale})
+}
+
+// GetNoSales lists no-sales between from and to (YYYY-MM-DD, inclusive).
+func (c *DrawerController) GetNoSales(ctx *gin.Context) {
+    from, to, err := parseDateRange(ctx)
+    if err != nil {
+        badRequest(ctx, err.Error())
+        return
+    }
+    
+    noSales, err := c.drawerService.GetNoSales(from, to)
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    ctx.JSON(http.StatusOK, gin.H{"data": noSales})
+}
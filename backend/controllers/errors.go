@@ -0,0 +1,86 @@
+package controllers
+
+import (
+    "encoding/json"
+    "errors"
+    "log"
+    "net/http"
+    "backend/services"
+
+    "github.com/gin-gonic/gin"
+)
+
+// SQL Server error numbers that are reported to clients as constraint violations.
+const (
+    sqlForeignKeyViolation  = 547
+    sqlUniqueIndexViolation = 2601
+    sqlUniqueKeyViolation   = 2627
+)
+
+var statusByCode = map[string]int{
+    services.CodeInvalidRequest:   http.StatusBadRequest,
+    services.CodeUnauthorized:     http.StatusUnauthorized,
+    services.CodeForbidden:        http.StatusForbidden,
+    services.CodeNotFound:         http.StatusNotFound,
+    services.CodeValidationFailed: http.StatusUnprocessableEntity,
+    services.CodeConflict:         http.StatusConflict,
+    services.CodeConstraint:       http.StatusConflict,
+}
+
+// respondError maps an error to a status code and a structured body of the form
+// {"error": message, "code": code, "fields": {...}}. Anything that is not a
+// known domain error is logged and reported as a generic 500 so raw driver
+// errors never reach the client.
+func respondError(ctx *gin.Context, err error) {
+    appErr := toAppError(err)
+    if appErr == nil {
+        log.Printf("%s %s: %v", ctx.Request.Method, ctx.Request.URL.Path, err)
+        ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error", "code": "internal_error"})
+        return
+    }
+
+    body := gin.H{"error": appErr.Message, "code": appErr.Code}
+    if len(appErr.Fields) > 0 {
+        body["fields"] = appErr.Fields
+    }
+    ctx.JSON(statusByCode[appErr.Code], body)
+}
+
+// badRequest responds with 400 for malformed input such as a non-numeric id.
+func badRequest(ctx *gin.Context, message string) {
+    respondError(ctx, &services.AppError{Code: services.CodeInvalidRequest, Message: message})
+}
+
+// bindJSON decodes and validates the request body into obj. It responds with
+// 422 listing every invalid field, 400 if the body cannot be decoded, or 500
+// if a referenced record could not be looked up.
+func bindJSON(ctx *gin.Context, obj interface{}) bool {
+    if ctx.Request.Body == nil || json.NewDecoder(ctx.Request.Body).Decode(obj) != nil {
+        badRequest(ctx, "request body is not valid JSON for this endpoint")
+        return false
+    }
+    if err := validateStruct(ctx.Request.Context(), obj); err != nil {
+        respondError(ctx, err)
+        return false
+    }
+    return true
+}
+
+func toAppError(err error) *services.AppError {
+    var appErr *services.AppError
+    if errors.As(err, &appErr) {
+        return appErr
+    }
+
+    var sqlErr interface{ SQLErrorNumber() int32 }
+    if errors.As(err, &sqlErr) {
+        switch sqlErr.SQLErrorNumber() {
+        case sqlForeignKeyViolation:
+            return services.ConstraintError("the change refers to, or is referenced by, another record")
+        case sqlUniqueIndexViolation, sqlUniqueKeyViolation:
+            return services.ConstraintError("a record with the same unique value already exists")
+        }
+    }
+
+    return nil
+}
@@ -0,0 +1,60 @@
+package controllers
+
+import (
+    "io"
+    "time"
+    "backend/middleware"
+    "backend/services"
+
+    "github.com/gin-gonic/gin"
+)
+
+// eventHeartbeat keeps idle event streams from being closed by proxies.
+const eventHeartbeat = 30 * time.Second
+
+type EventController struct {
+    events *services.EventBroker
+}
+
+func NewEventController(events *services.EventBroker) *EventController {
+    return &EventController{
+        events: events,
+    }
+}
+
+// Stream sends events to the client as server-sent events until it
+// disconnects. The stream ends when the access token expires, so the client
+// reconnects with a fresh token and a revoked session stops receiving events.
+func (c *EventController) Stream(ctx *gin.Context) {
+    ch := c.events.Subscribe(middleware.CurrentUser(ctx))
+    defer c.events.Unsubscribe(ch)
+
+    expires := time.NewTimer(time.Hour)
+    if claims := middleware.CurrentClaims(ctx); claims != nil && claims.ExpiresAt != nil {
+        expires.Reset(time.Until(claims.ExpiresAt.Time))
+    }
+    defer expires.Stop()
+
+    heartbeat := time.NewTicker(eventHeartbeat)
+    defer heartbeat.Stop()
+
+    ctx.Header("Content-Type", "text/event-stream")
+    ctx.Header("Cache-Control", "no-cache")
+    ctx.Header("X-Accel-Buffering", "no")
+    ctx.Writer.Flush()
+
+    ctx.Stream(func(w io.Writer) bool {
+        select {
+        case event := <-ch:
+            ctx.SSEvent(event.Type, event)
+            return true
+        case <-heartbeat.C:
+            io.WriteString(w, ": keep-alive\n\n")
+            return true
+        case <-expires.C:
+            return false
+        case <-ctx.Request.Context().Done():
+            return false
+        }
+    })
+}
@@ -0,0 +1,62 @@
+package controllers
+
+import (
+    "fmt"
+    "log"
+    "net/http"
+    "backend/middleware"
+    "backend/services"
+    "backend/spreadsheet"
+
+    "github.com/gin-gonic/gin"
+)
+
+// exportFormat returns the ?format= requested by the client, or "" when the
+// normal JSON response is wanted. It responds with 400 for unknown formats and
+// 403 when the user may not export data, and then returns false.
+func exportFormat(ctx *gin.Context) (string, bool) {
+    format := ctx.Query("format")
+    if format == "" || format == "json" {
+        return "", true
+    }
+
+    if !spreadsheet.IsSupported(format) {
+        badRequest(ctx, "format must be csv or xlsx")
+        return "", false
+    }
+    
+    if err := services.RequirePermission(middleware.CurrentUser(ctx), services.PermExportData); err != nil {
+        respondError(ctx, err)
+        return "", false
+    }
+
+    return format, true
+}
+
+// streamExport sets the download headers, writes the header row and lets
+// write stream the remaining rows. Once the first byte is sent the status
+// code can no longer change, so failures after that point are only logged.
+func streamExport(ctx *gin.Context, format, name string, header []interface{}, write func(spreadsheet.Writer) error) {
+    ctx.Header("Content-Type", spreadsheet.ContentType(format))
+    ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.%s", name, format))
+    ctx.Status(http.StatusOK)
+
+    w, err := spreadsheet.NewWriter(ctx.Writer, format, name)
+    if err != nil {
+        log.Printf("export %s: %v", name, err)
+        return
+    }
+
+    if err := w.WriteRow(header...); err != nil {
+        log.Printf("export %s: %v", name, err)
+        return
+    }
+
+    if err := write(w); err != nil {
+        log.Printf("export %s: %v", name, err)
+    }
+
+    if err := w.Close(); err != nil {
+        log.Printf("export %s: %v", name, err)
+    }
+}
@@ -0,0 +1,54 @@
+package controllers
+
+import (
+    "net/http"
+    "path"
+    "strings"
+    "backend/services"
+    "backend/blobstore"
+
+    "github.com/gin-gonic/gin"
+)
+
+// imageTypes maps the extensions images are stored under to their MIME types.
+var imageTypes = map[string]string{
+    ".jpg": "image/jpeg",
+    ".png": "image/png",
+}
+
+// ImageController serves stored images to anyone, for the public menu.
+type ImageController struct {
+    images blobstore.Store
+}
+
+func NewImageController(images blobstore.Store) *ImageController {
+    return &ImageController{
+        images: images,
+    }
+}
+
+// GetImage streams a stored image. Uploads always get new keys, so an image
+// at a given URL never changes and clients may cache it for a year.
+func (c *ImageController) GetImage(ctx *gin.Context) {
+    key := strings.TrimPrefix(ctx.Param("key"), "/")
+    contentType, ok := imageTypes[path.Ext(key)]
+    if !ok {
+        respondError(ctx, &services.AppError{Code: services.CodeNotFound, Message: "image not found"})
+        return
+    }
+
+    r, err := c.images.Open(key)
+    if err == blobstore.ErrNotFound {
+        respondError(ctx, &services.AppError{Code: services.CodeNotFound, Message: "image not found"})
+        return
+    }
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+    defer r.Close()
+
+    ctx.DataFromReader(http.StatusOK, -1, contentType, r, map[string]string{
+        "Cache-Control": "public, max-age=31536000, immutable",
+    })
+}
@@ -0,0 +1,71 @@
+package controllers
+
+import (
+    "io"
+    "net/http"
+    "backend/models"
+    "backend/services"
+    "backend/spreadsheet"
+
+    "github.com/gin-gonic/gin"
+)
+
+// maxImportSize caps uploaded import files so a stray upload cannot exhaust memory.
+const maxImportSize = 10 << 20
+
+// readImportFile parses the multipart "file" field as CSV or XLSX. It writes a
+// 400 response and returns false when the upload is missing or unreadable.
+func readImportFile(ctx *gin.Context) ([][]string, bool) {
+    header, err := ctx.FormFile("file")
+    if err != nil {
+        badRequest(ctx, "a CSV or XLSX file is required in the \"file\" field")
+        return nil, false
+    }
+
+    format, err := spreadsheet.FormatFromFilename(header.Filename)
+    if err != nil {
+        badRequest(ctx, err.Error())
+        return nil, false
+    }
+
+    if header.Size > maxImportSize {
+        badRequest(ctx, "file is larger than 10 MB")
+        return nil, false
+    }
+
+    f, err := header.Open()
+    if err != nil {
+        badRequest(ctx, err.Error())
+        return nil, false
+    }
+    defer f.Close()
+
+    data, err := io.ReadAll(io.LimitReader(f, maxImportSize))
+    if err != nil {
+        badRequest(ctx, err.Error())
+        return nil, false
+    }
+
+    rows, err := spreadsheet.ReadAll(data, format)
+    if err != nil {
+        badRequest(ctx, err.Error())
+        return nil, false
+    }
+
+    return rows, true
+}
+
+// respondImport returns 200 when the import was applied or the dry run found no
+// errors, and 422 with the per-row report when any row was rejected.
+func respondImport(ctx *gin.Context, report *models.ImportReport) {
+    if report.Failed > 0 {
+        ctx.JSON(http.StatusUnprocessableEntity, gin.H{
+            "error": "import contains invalid rows",
+            "code":  services.CodeValidationFailed,
+            "data":  report,
+        })
+        return
+    }
+
+    ctx.JSON(http.StatusOK, gin.H{"data": report})
+}
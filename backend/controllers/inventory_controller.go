@@ -0,0 +1,287 @@
+package controllers
+
+import (
+    "fmt"
+    "net/http"
+    "strconv"
+    "backend/middleware"
+    "backend/models"
+    "backend/services"
+
+    "github.com/gin-gonic/gin"
+)
+
+type InventoryController struct {
+    inventoryService *services.InventoryService
+    alertService     *services.StockAlertService
+}
+
+func NewInventoryController(alertService *services.StockAlertService) *InventoryController {
+    return &InventoryController{
+        inventoryService: services.NewInventoryService(),
+        alertService:     alertService,
+    }
+}
+
+func (c *InventoryController) GetIngredients(ctx *gin.Context) {
+    ingredients, err := c.inventoryService.GetAllIngredients()
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    ctx.JSON(http.StatusOK, gin.H{"data": ingredients})
+}
+
+func (c *InventoryController) GetIngredient(ctx *gin.Context) {
+    id, err := strconv.Atoi(ctx.Param("id"))
+    if err != nil {
+        badRequest(ctx, "Invalid ingredient ID")
+        return
+    }
+
+    ingredient, err := c.inventoryService.GetIngredientByID(id)
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    ctx.JSON(http.StatusOK, gin.H{"data": ingredient})
+}
+
+func (c *InventoryController) CreateIngredient(ctx *gin.Context) {
+    var ingredient models.Ingredient
+    if !bindJSON(ctx, &ingredient) {
+        return
+    }
+
+    if err := c.inventoryService.CreateIngredient(&ingredient, middleware.CurrentUser(ctx)); err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    ctx.JSON(http.StatusCreated, gin.H{"data": ingredient})
+}
+
+func (c *InventoryController) UpdateIngredient(ctx *gin.Context) {
+    id, err := strconv.Atoi(ctx.Param("id"))
+    if err != nil {
+        badRequest(ctx, "Invalid ingredient ID")
+        return
+    }
+
+    var ingredient models.Ingredient
+    if !bindJSON(ctx, &ingredient) {
+        return
+    }
+
+    ingredient.IngredientID = id
+    if err := c.inventoryService.UpdateIngredient(&ingredient, middleware.CurrentUser(ctx)); err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    ctx.JSON(http.StatusOK, gin.H{"data": ingredient})
+}
+
+func (c *InventoryController) DeleteIngredient(ctx *gin.Context) {
+    id, err := strconv.Atoi(ctx.Param("id"))
+    if err != nil {
+        badRequest(ctx, "Invalid ingredient ID")
+        return
+    }
+
+    if err := c.inventoryService.DeleteIngredient(id, middleware.CurrentUser(ctx)); err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    ctx.JSON(http.StatusOK, gin.H{"message": "Ingredient deleted successfully"})
+}
+
+// AdjustStock records a manual change to an ingredient's on-hand quantity.
+func (c *InventoryController) AdjustStock(ctx *gin.Context) {
+    id, err := strconv.Atoi(ctx.Param("id"))
+    if err != nil {
+        badRequest(ctx, "Invalid ingredient ID")
+        return
+    }
+
+    var req models.StockAdjustmentRequest
+    if !bindJSON(ctx, &req) {
+        return
+    }
+
+    ingredient, err := c.inventoryService.AdjustStock(id, &req, middleware.CurrentUser(ctx))
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    ctx.JSON(http.StatusOK, gin.H{"data": ingredient})
+}
+
+// RecordIngredientWastage removes spoiled or spilled stock of an ingredient.
+func (c *InventoryController) RecordIngredientWastage(ctx *gin.Context) {
+    id, err := strconv.Atoi(ctx.Param("id"))
+    if err != nil {
+        badRequest(ctx, "Invalid ingredient ID")
+        return
+    }
+
+    var req models.WastageRequest
+    if !bindJSON(ctx, &req) {
+        return
+    }
+
+    ingredient, err := c.inventoryService.RecordIngredientWastage(id, &req, middleware.CurrentUser(ctx))
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    ctx.JSON(http.StatusOK, gin.H{"data": ingredient})
+}
+
+// RecordItemWastage removes the ingredients of wasted items, such as a
+// dropped pizza, using the item's recipe.
+func (c *InventoryController) RecordItemWastage(ctx *gin.Context) {
+    id, err := strconv.Atoi(ctx.Param("id"))
+    if err != nil {
+        badRequest(ctx, "Invalid item ID")
+        return
+    }
+
+    var req models.WastageRequest
+    if !bindJSON(ctx, &req) {
+        return
+    }
+
+    ingredients, err := c.inventoryService.RecordItemWastage(id, &req, middleware.CurrentUser(ctx))
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    ctx.JSON(http.StatusOK, gin.H{"data": ingredients})
+}
+
+// GetMovements lists stock movements, filtered by ingredient_id, invoice_id,
+// purchase_order_id, reason and a from/to date range.
+func (c *InventoryController) GetMovements(ctx *gin.Context) {
+    filter, err := parseMovementFilter(ctx)
+    if err != nil {
+        badRequest(ctx, err.Error())
+        return
+    }
+
+    movements, total, err := c.inventoryService.ListMovements(filter)
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    respondPage(ctx, movements, filter.ListParams, total)
+}
+
+func parseMovementFilter(ctx *gin.Context) (models.StockMovementFilter, error) {
+    var filter models.StockMovementFilter
+
+    params, err := parseListParams(ctx)
+    if err != nil {
+        return filter, err
+    }
+    filter.ListParams = params
+    filter.Reason = ctx.Query("reason")
+
+    if v := ctx.Query("ingredient_id"); v != "" {
+        id, err := strconv.Atoi(v)
+        if err != nil {
+            return filter, fmt.Errorf("ingredient_id must be a number")
+        }
+        filter.IngredientID = id
+    }
+
+    if v := ctx.Query("invoice_id"); v != "" {
+        id, err := strconv.Atoi(v)
+        if err != nil {
+            return filter, fmt.Errorf("invoice_id must be a number")
+        }
+        filter.InvoiceID = id
+    }
+
+    if v := ctx.Query("purchase_order_id"); v != "" {
+        id, err := strconv.Atoi(v)
+        if err != nil {
+            return filter, fmt.Errorf("purchase_order_id must be a number")
+        }
+        filter.PurchaseOrderID = id
+    }
+
+    if filter.From, filter.To, err = parseDateBounds(ctx); err != nil {
+        return filter, err
+    }
+
+    return filter, nil
+}
+
+func (c *InventoryController) GetRecipe(ctx *gin.Context) {
+    id, err := strconv.Atoi(ctx.Param("id"))
+    if err != nil {
+        badRequest(ctx, "Invalid item ID")
+        return
+    }
+
+    lines, err := c.inventoryService.GetRecipe(id)
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    ctx.JSON(http.StatusOK, gin.H{"data": lines})
+}
+
+// SetRecipe replaces the ingredients used to make one of an item.
+func (c *InventoryController) SetRecipe(ctx *gin.Context) {
+    id, err := strconv.Atoi(ctx.Param("id"))
+    if err != nil {
+        badRequest(ctx, "Invalid item ID")
+        return
+    }
+
+    var req models.SetRecipeRequest
+    if !bindJSON(ctx, &req) {
+        return
+    }
+
+    lines, err := c.inventoryService.SetRecipe(id, req.Lines, middleware.CurrentUser(ctx))
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    ctx.JSON(http.StatusOK, gin.H{"data": lines})
+}
+
+// GetAlerts lists ingredients at or below their reorder point with a
+// suggested order quantity, as of the last stock check.
+func (c *InventoryController) GetAlerts(ctx *gin.Context) {
+    alerts, err := c.alertService.ListAlerts()
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    ctx.JSON(http.StatusOK, gin.H{"data": alerts})
+}
+
+// CheckAlerts runs the stock check now instead of waiting for the daily job.
+func (c *InventoryController) CheckAlerts(ctx *gin.Context) {
+    alerts, err := c.alertService.CheckStock()
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    ctx.JSON(http.StatusOK, gin.H{"data": alerts})
+}
@@ -1,34 +1,38 @@
 package controllers
 
 import (
+    "fmt"
     "net/http"
     "strconv"
+    "backend/middleware"
     "backend/models"
     "backend/services"
+    "backend/spreadsheet"
     
     "github.com/gin-gonic/gin"
 )
 
 type InvoiceController struct {
     invoiceService *services.InvoiceService
+    chain          *services.InvoiceChain
 }
 
-func NewInvoiceController() *InvoiceController {
+func NewInvoiceController(chain *services.InvoiceChain) *InvoiceController {
     return &InvoiceController{
-        invoiceService: services.NewInvoiceService(),
+        invoiceService: services.NewInvoiceService(chain),
+        chain:          chain,
     }
 }
 
 func (c *InvoiceController) CreateInvoice(ctx *gin.Context) {
     var req models.CreateInvoiceRequest
-    if err := ctx.ShouldBindJSON(&req); err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    if !bindJSON(ctx, &req) {
         return
     }
     
-    invoice, err := c.invoiceService.CreateInvoice(&req)
+    invoice, err := c.invoiceService.CreateInvoice(&req, middleware.CurrentUser(ctx))
     if err != nil {
-        ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        respondError(ctx, err)
         return
     }
     
@@ -36,25 +40,116 @@ func (c *InvoiceController) CreateInvoice(ctx *gin.Context) {
 }
 
 func (c *InvoiceController) GetInvoices(ctx *gin.Context) {
-    invoices, err := c.invoiceService.GetAllInvoices()
+    format, ok := exportFormat(ctx)
+    if !ok {
+        return
+    }
+    
+    filter, err := parseInvoiceFilter(ctx)
+    if err != nil {
+        badRequest(ctx, err.Error())
+        return
+    }
+    
+    if format != "" {
+        // One row per line item, repeating the invoice columns on each line
+        header := []interface{}{"invoice_id", "invoice_number", "invoice_date", "customer_id", "customer_name",
+            "sub_total", "tax_rate", "tax_amount", "total_amount", "status",
+            "invoice_item_id", "item_id", "item_name", "category_name", "quantity", "unit_price", "total_price",
+            "parent_invoice_item_id", "slot_name"}
+        streamExport(ctx, format, "invoices", header, func(w spreadsheet.Writer) error {
+            return c.invoiceService.EachInvoiceWithItems(filter, func(invoice *models.Invoice) error {
+                invoiceCols := []interface{}{invoice.InvoiceID, invoice.InvoiceNumber, invoice.InvoiceDate,
+                    invoice.CustomerID, invoice.Customer.CustomerName,
+                    invoice.SubTotal, invoice.TaxRate, invoice.TaxAmount, invoice.TotalAmount, invoice.Status}
+                
+                if len(invoice.Items) == 0 {
+                    return w.WriteRow(invoiceCols...)
+                }
+                
+                for _, item := range invoice.Items {
+                    var parentID interface{}
+                    if item.ParentInvoiceItemID != nil {
+                        parentID = *item.ParentInvoiceItemID
+                    }
+                    var categoryName string
+                    if item.Item.Category != nil {
+                        categoryName = item.Item.Category.CategoryName
+                    }
+                    row := append(invoiceCols[:len(invoiceCols):len(invoiceCols)],
+                        item.InvoiceItemID, item.ItemID, item.Item.ItemName, categoryName,
+                        item.Quantity, item.UnitPrice, item.TotalPrice, parentID, item.SlotName)
+                    if err := w.WriteRow(row...); err != nil {
+                        return err
+                    }
+                }
+                return nil
+            })
+        })
+        return
+    }
+    
+    invoices, total, err := c.invoiceService.ListInvoices(filter)
     if err != nil {
-        ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        respondError(ctx, err)
         return
     }
     
-    ctx.JSON(http.StatusOK, gin.H{"data": invoices})
+    respondPage(ctx, invoices, filter.ListParams, total)
+}
+
+// parseInvoiceFilter reads the paging options plus the from/to dates
+// (inclusive, YYYY-MM-DD), customer_id, status and min_total/max_total filters.
+func parseInvoiceFilter(ctx *gin.Context) (models.InvoiceFilter, error) {
+    var filter models.InvoiceFilter
+    
+    params, err := parseListParams(ctx)
+    if err != nil {
+        return filter, err
+    }
+    filter.ListParams = params
+    
+    if filter.From, filter.To, err = parseDateBounds(ctx); err != nil {
+        return filter, err
+    }
+    
+    if v := ctx.Query("customer_id"); v != "" {
+        if filter.CustomerID, err = strconv.Atoi(v); err != nil {
+            return filter, fmt.Errorf("Invalid customer ID")
+        }
+    }
+    
+    filter.Status = ctx.Query("status")
+    
+    if v := ctx.Query("min_total"); v != "" {
+        min, err := strconv.ParseFloat(v, 64)
+        if err != nil {
+            return filter, fmt.Errorf("min_total must be a number")
+        }
+        filter.MinTotal = &min
+    }
+    
+    if v := ctx.Query("max_total"); v != "" {
+        max, err := strconv.ParseFloat(v, 64)
+        if err != nil {
+            return filter, fmt.Errorf("max_total must be a number")
+        }
+        filter.MaxTotal = &max
+    }
+    
+    return filter, nil
 }
 
 func (c *InvoiceController) GetInvoice(ctx *gin.Context) {
     id, err := strconv.Atoi(ctx.Param("id"))
     if err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+        badRequest(ctx, "Invalid invoice ID")
         return
     }
     
     invoice, err := c.invoiceService.GetInvoiceByID(id)
     if err != nil {
-        ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        respondError(ctx, err)
         return
     }
     
@@ -64,7 +159,7 @@ func (c *InvoiceController) GetInvoice(ctx *gin.Context) {
 func (c *InvoiceController) GetCustomers(ctx *gin.Context) {
     customers, err := c.invoiceService.GetAllCustomers()
     if err != nil {
-        ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        respondError(ctx, err)
         return
     }
     
@@ -73,15 +168,46 @@ func (c *InvoiceController) GetCustomers(ctx *gin.Context) {
 
 func (c *InvoiceController) CreateCustomer(ctx *gin.Context) {
     var customer models.Customer
-    if err := ctx.ShouldBindJSON(&customer); err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    if !bindJSON(ctx, &customer) {
         return
     }
     
-    if err := c.invoiceService.CreateCustomer(&customer); err != nil {
-        ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+    if err := c.invoiceService.CreateCustomer(&customer, middleware.CurrentUser(ctx)); err != nil {
+        respondError(ctx, err)
         return
     }
     
     ctx.JSON(http.StatusCreated, gin.H{"data": customer})
-}
\ No newline at end of file
+}
+
+func (c *InvoiceController) VoidInvoice(ctx *gin.Context) {
+    id, err := strconv.Atoi(ctx.Param("id"))
+    if err != nil {
+        badRequest(ctx, "Invalid invoice ID")
+        return
+    }
+    
+    var req models.VoidInvoiceRequest
+    if !bindJSON(ctx, &req) {
+        return
+    }
+    
+    invoice, err := c.invoiceService.VoidInvoice(id, req.Reason, req.ApprovalToken, middleware.CurrentUser(ctx))
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    ctx.JSON(http.StatusOK, gin.H{"data": invoice})
+}
+
+// VerifyChain walks the invoice hash chain and reports the first broken link.
+func (c *InvoiceController) VerifyChain(ctx *gin.Context) {
+    result, err := c.chain.Verify()
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    ctx.JSON(http.StatusOK, gin.H{"data": result})
+}
@@ -1,43 +1,109 @@
 package controllers
 
 import (
+    "io"
     "net/http"
     "strconv"
+    "backend/middleware"
     "backend/models"
     "backend/services"
+    "backend/spreadsheet"
+    "backend/blobstore"
     
     "github.com/gin-gonic/gin"
 )
 
 type ItemController struct {
-    itemService *services.ItemService
+    itemService   *services.ItemService
+    importService *services.ImportService
 }
 
-func NewItemController() *ItemController {
+// maxImageSize caps uploaded item images.
+const maxImageSize = 5 << 20
+
+func NewItemController(images blobstore.Store) *ItemController {
     return &ItemController{
-        itemService: services.NewItemService(),
+        itemService:   services.NewItemService(images),
+        importService: services.NewImportService(),
     }
 }
 
 func (c *ItemController) GetItems(ctx *gin.Context) {
-    items, err := c.itemService.GetAllItems()
+    format, ok := exportFormat(ctx)
+    if !ok {
+        return
+    }
+    
+    params, err := parseListParams(ctx)
+    if err != nil {
+        badRequest(ctx, err.Error())
+        return
+    }
+    
+    filter := models.ItemFilter{ListParams: params, Code: ctx.Query("code"), IncludeArchived: ctx.Query("include_archived") == "true"}
+    if v := ctx.Query("category_id"); v != "" {
+        if filter.CategoryID, err = strconv.Atoi(v); err != nil {
+            badRequest(ctx, "Invalid category ID")
+            return
+        }
+    }
+    
+    switch filter.Availability = ctx.Query("availability"); filter.Availability {
+    case "", services.ItemAvailable, services.ItemSoldOut, services.ItemHidden:
+    default:
+        badRequest(ctx, "availability must be available, sold_out or hidden")
+        return
+    }
+    
+    if format != "" {
+        // Exports contain every matching row rather than a single page
+        filter.Limit, filter.Offset = 0, 0
+        header := []interface{}{"item_id", "item_name", "category_id", "category_name", "base_price", "description",
+            "food_cost", "margin_percent", "sku", "barcode", "plu", "archived_at"}
+        streamExport(ctx, format, "items", header, func(w spreadsheet.Writer) error {
+            return c.itemService.EachItem(filter, func(item models.Item) error {
+                return w.WriteRow(item.ItemID, item.ItemName, item.CategoryID, item.Category.CategoryName,
+                    item.BasePrice, item.Description, item.FoodCost, item.MarginPercent, item.SKU, item.Barcode, item.PLU,
+                    item.ArchivedAt)
+            })
+        })
+        return
+    }
+    
+    items, total, err := c.itemService.ListItems(filter)
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    respondPage(ctx, items, params, total)
+}
+
+// LookupItem finds the item for a scanned or typed SKU, barcode or PLU.
+func (c *ItemController) LookupItem(ctx *gin.Context) {
+    code := ctx.Query("code")
+    if code == "" {
+        badRequest(ctx, "code is required")
+        return
+    }
+    
+    item, err := c.itemService.LookupItem(code)
     if err != nil {
-        ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        respondError(ctx, err)
         return
     }
     
-    ctx.JSON(http.StatusOK, gin.H{"data": items})
+    ctx.JSON(http.StatusOK, gin.H{"data": item})
 }
 
 func (c *ItemController) CreateItem(ctx *gin.Context) {
     var item models.Item
-    if err := ctx.ShouldBindJSON(&item); err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    if !bindJSON(ctx, &item) {
         return
     }
     
-    if err := c.itemService.CreateItem(&item); err != nil {
-        ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+    if err := c.itemService.CreateItem(&item, middleware.CurrentUser(ctx)); err != nil {
+        respondError(ctx, err)
         return
     }
     
@@ -47,19 +113,23 @@ func (c *ItemController) CreateItem(ctx *gin.Context) {
 func (c *ItemController) UpdateItem(ctx *gin.Context) {
     id, err := strconv.Atoi(ctx.Param("id"))
     if err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+        badRequest(ctx, "Invalid item ID")
         return
     }
     
-    var item models.Item
-    if err := ctx.ShouldBindJSON(&item); err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    // Fields left out of the body keep their stored values
+    item, err := c.itemService.GetItem(id)
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+    if !bindJSON(ctx, item) {
         return
     }
     
     item.ItemID = id
-    if err := c.itemService.UpdateItem(&item); err != nil {
-        ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+    if err := c.itemService.UpdateItem(item, middleware.CurrentUser(ctx)); err != nil {
+        respondError(ctx, err)
         return
     }
     
@@ -69,12 +139,12 @@ func (c *ItemController) UpdateItem(ctx *gin.Context) {
 func (c *ItemController) DeleteItem(ctx *gin.Context) {
     id, err := strconv.Atoi(ctx.Param("id"))
     if err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+        badRequest(ctx, "Invalid item ID")
         return
     }
     
-    if err := c.itemService.DeleteItem(id); err != nil {
-        ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+    if err := c.itemService.DeleteItem(id, middleware.CurrentUser(ctx)); err != nil {
+        respondError(ctx, err)
         return
     }
     
@@ -84,9 +154,237 @@ func (c *ItemController) DeleteItem(ctx *gin.Context) {
 func (c *ItemController) GetCategories(ctx *gin.Context) {
     categories, err := c.itemService.GetAllCategories()
     if err != nil {
-        ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        respondError(ctx, err)
         return
     }
     
     ctx.JSON(http.StatusOK, gin.H{"data": categories})
-}
\ No newline at end of file
+}
+
+func (c *ItemController) ImportItems(ctx *gin.Context) {
+    rows, ok := readImportFile(ctx)
+    if !ok {
+        return
+    }
+    
+    dryRun := ctx.Query("dry_run") == "true"
+    createCategories := ctx.Query("create_categories") == "true"
+    
+    report, err := c.importService.ImportItems(rows, dryRun, createCategories, middleware.CurrentUser(ctx))
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    respondImport(ctx, report)
+}
+
+func (c *ItemController) GetPriceHistory(ctx *gin.Context) {
+    id, err := strconv.Atoi(ctx.Param("id"))
+    if err != nil {
+        badRequest(ctx, "Invalid item ID")
+        return
+    }
+    
+    prices, err := c.itemService.GetPriceHistory(id)
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    ctx.JSON(http.StatusOK, gin.H{"data": prices})
+}
+
+// SchedulePrice sets a new price from effective_from (RFC 3339), or from now
+// when it is omitted.
+func (c *ItemController) SchedulePrice(ctx *gin.Context) {
+    id, err := strconv.Atoi(ctx.Param("id"))
+    if err != nil {
+        badRequest(ctx, "Invalid item ID")
+        return
+    }
+    
+    var req models.SchedulePriceRequest
+    if !bindJSON(ctx, &req) {
+        return
+    }
+    
+    price, err := c.itemService.SchedulePrice(id, &req, middleware.CurrentUser(ctx))
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    ctx.JSON(http.StatusCreated, gin.H{"data": price})
+}
+
+func (c *ItemController) CancelScheduledPrice(ctx *gin.Context) {
+    id, err := strconv.Atoi(ctx.Param("id"))
+    if err != nil {
+        badRequest(ctx, "Invalid item ID")
+        return
+    }
+    
+    priceID, err := strconv.Atoi(ctx.Param("priceId"))
+    if err != nil {
+        badRequest(ctx, "Invalid price ID")
+        return
+    }
+    
+    if err := c.itemService.CancelScheduledPrice(id, priceID, middleware.CurrentUser(ctx)); err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    ctx.JSON(http.StatusOK, gin.H{"message": "Scheduled price cancelled successfully"})
+}
+
+// SetAvailability marks an item available, sold out ("86") or hidden. A sold
+// out item may carry an until time after which it is available again.
+func (c *ItemController) SetAvailability(ctx *gin.Context) {
+    id, err := strconv.Atoi(ctx.Param("id"))
+    if err != nil {
+        badRequest(ctx, "Invalid item ID")
+        return
+    }
+    
+    var req models.SetAvailabilityRequest
+    if !bindJSON(ctx, &req) {
+        return
+    }
+    
+    item, err := c.itemService.SetAvailability(id, &req, middleware.CurrentUser(ctx))
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    ctx.JSON(http.StatusOK, gin.H{"data": item})
+}
+
+// ArchiveItem takes an item off the menu while keeping it on past invoices.
+func (c *ItemController) ArchiveItem(ctx *gin.Context) {
+    c.setArchived(ctx, true)
+}
+
+// RestoreItem puts an archived item back on the menu.
+func (c *ItemController) RestoreItem(ctx *gin.Context) {
+    c.setArchived(ctx, false)
+}
+
+func (c *ItemController) setArchived(ctx *gin.Context, archived bool) {
+    id, err := strconv.Atoi(ctx.Param("id"))
+    if err != nil {
+        badRequest(ctx, "Invalid item ID")
+        return
+    }
+    
+    var item *models.Item
+    if archived {
+        item, err = c.itemService.ArchiveItem(id, middleware.CurrentUser(ctx))
+    } else {
+        item, err = c.itemService.RestoreItem(id, middleware.CurrentUser(ctx))
+    }
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    ctx.JSON(http.StatusOK, gin.H{"data": item})
+}
+
+func (c *ItemController) GetBundle(ctx *gin.Context) {
+    id, err := strconv.Atoi(ctx.Param("id"))
+    if err != nil {
+        badRequest(ctx, "Invalid item ID")
+        return
+    }
+    
+    slots, err := c.itemService.GetBundle(id)
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    ctx.JSON(http.StatusOK, gin.H{"data": slots})
+}
+
+// SetBundle replaces the slots of a bundle such as a family deal. Sending no
+// slots makes the item a plain item again.
+func (c *ItemController) SetBundle(ctx *gin.Context) {
+    id, err := strconv.Atoi(ctx.Param("id"))
+    if err != nil {
+        badRequest(ctx, "Invalid item ID")
+        return
+    }
+    
+    var req models.SetBundleRequest
+    if !bindJSON(ctx, &req) {
+        return
+    }
+    
+    slots, err := c.itemService.SetBundle(id, req.Slots, middleware.CurrentUser(ctx))
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    ctx.JSON(http.StatusOK, gin.H{"data": slots})
+}
+
+// UploadImage sets the item's image from a JPEG or PNG in the multipart
+// "image" field and makes a thumbnail of it.
+func (c *ItemController) UploadImage(ctx *gin.Context) {
+    id, err := strconv.Atoi(ctx.Param("id"))
+    if err != nil {
+        badRequest(ctx, "Invalid item ID")
+        return
+    }
+    
+    header, err := ctx.FormFile("image")
+    if err != nil {
+        badRequest(ctx, "a JPEG or PNG file is required in the \"image\" field")
+        return
+    }
+    if header.Size > maxImageSize {
+        badRequest(ctx, "image is larger than 5 MB")
+        return
+    }
+    
+    f, err := header.Open()
+    if err != nil {
+        badRequest(ctx, err.Error())
+        return
+    }
+    defer f.Close()
+    
+    data, err := io.ReadAll(io.LimitReader(f, maxImageSize))
+    if err != nil {
+        badRequest(ctx, err.Error())
+        return
+    }
+    
+    item, err := c.itemService.SetImage(id, data, middleware.CurrentUser(ctx))
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    ctx.JSON(http.StatusOK, gin.H{"data": item})
+}
+
+func (c *ItemController) DeleteImage(ctx *gin.Context) {
+    id, err := strconv.Atoi(ctx.Param("id"))
+    if err != nil {
+        badRequest(ctx, "Invalid item ID")
+        return
+    }
+    
+    item, err := c.itemService.DeleteImage(id, middleware.CurrentUser(ctx))
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    ctx.JSON(http.StatusOK, gin.H{"data": item})
+}
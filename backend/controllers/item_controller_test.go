@@ -0,0 +1,64 @@
+package controllers
+
+import (
+    "reflect"
+    "testing"
+    "backend/models"
+)
+
+// storedItem is an item as UpdateItem loads it before binding the body.
+func storedItem() *models.Item {
+    calories := 850
+    return &models.Item{
+        ItemID:      4,
+        ItemName:    "Peperonata",
+        CategoryID:  2,
+        BasePrice:   11.5,
+        Description: "Roasted peppers",
+        SortOrder:   3,
+        Allergens:   []string{"gluten", "dairy"},
+        Vegetarian:  true,
+        SpicyLevel:  2,
+        Calories:    &calories,
+        SKU:         "PIZ-PEP",
+        Barcode:     "4006381333931",
+        PLU:         "204",
+    }
+}
+
+func TestUpdateItemKeepsOmittedFields(t *testing.T) {
+    withLookup(t, func(string, int) (bool, error) { return true, nil })
+
+    // The body the item screen sends, which knows nothing of menu details or
+    // item codes
+    item := storedItem()
+    body := `{"item_name": "Peperonata Piccante", "category_id": 2, "base_price": 12, "description": "Roasted chillies"}`
+    if ok, w := bindTest(body, item); !ok {
+        t.Fatalf("binding failed: %s", w.Body)
+    }
+
+    want := storedItem()
+    want.ItemName, want.BasePrice, want.Description = "Peperonata Piccante", 12, "Roasted chillies"
+    if !reflect.DeepEqual(item, want) {
+        t.Errorf("got %+v, want %+v", item, want)
+    }
+}
+
+func TestUpdateItemClearsSentFields(t *testing.T) {
+    withLookup(t, func(string, int) (bool, error) { return true, nil })
+
+    item := storedItem()
+    body := `{"allergens": [], "spicy_level": 0, "calories": null, "barcode": ""}`
+    if ok, w := bindTest(body, item); !ok {
+        t.Fatalf("binding failed: %s", w.Body)
+    }
+    if len(item.Allergens) != 0 || item.SpicyLevel != 0 || item.Calories != nil {
+        t.Errorf("got allergens %v, spicy level %d, calories %v; want them cleared", item.Allergens, item.SpicyLevel, item.Calories)
+    }
+    if item.Barcode != "" {
+        t.Errorf("barcode = %q, want it cleared", item.Barcode)
+    }
+    if item.SortOrder != 3 || item.SKU != "PIZ-PEP" || item.PLU != "204" {
+        t.Errorf("got sort order %d, SKU %q, PLU %q; want them kept", item.SortOrder, item.SKU, item.PLU)
+    }
+}
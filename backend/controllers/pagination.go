@@ -0,0 +1,84 @@
+package controllers
+
+import (
+    "encoding/base64"
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
+    "backend/models"
+
+    "github.com/gin-gonic/gin"
+)
+
+const (
+    defaultPageSize = 50
+    maxPageSize     = 500
+)
+
+// parseListParams reads limit, offset or cursor, sort and q from the query
+// string. sort takes a field name, prefixed with "-" for descending order.
+func parseListParams(ctx *gin.Context) (models.ListParams, error) {
+    params := models.ListParams{
+        Limit:  defaultPageSize,
+        Search: strings.TrimSpace(ctx.Query("q")),
+    }
+
+    if v := ctx.Query("limit"); v != "" {
+        limit, err := strconv.Atoi(v)
+        if err != nil || limit < 1 || limit > maxPageSize {
+            return params, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+        }
+        params.Limit = limit
+    }
+
+    if v := ctx.Query("cursor"); v != "" {
+        offset, err := decodeCursor(v)
+        if err != nil {
+            return params, err
+        }
+        params.Offset = offset
+    } else if v := ctx.Query("offset"); v != "" {
+        offset, err := strconv.Atoi(v)
+        if err != nil || offset < 0 {
+            return params, fmt.Errorf("offset must be a non-negative number")
+        }
+        params.Offset = offset
+    }
+
+    if v := ctx.Query("sort"); v != "" {
+        params.Desc = strings.HasPrefix(v, "-")
+        params.Sort = strings.TrimPrefix(v, "-")
+    }
+
+    return params, nil
+}
+
+// respondPage writes a page of results with the shared pagination envelope.
+func respondPage(ctx *gin.Context, data interface{}, params models.ListParams, total int) {
+    page := models.Pagination{
+        Total:  total,
+        Limit:  params.Limit,
+        Offset: params.Offset,
+    }
+
+    if next := params.Offset + params.Limit; next < total {
+        page.NextCursor = encodeCursor(next)
+    }
+
+    ctx.JSON(http.StatusOK, gin.H{"data": data, "pagination": page})
+}
+
+func encodeCursor(offset int) string {
+    return base64.RawURLEncoding.EncodeToString([]byte("o:" + strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+    raw, err := base64.RawURLEncoding.DecodeString(cursor)
+    if err == nil && strings.HasPrefix(string(raw), "o:") {
+        if offset, err := strconv.Atoi(string(raw[2:])); err == nil && offset >= 0 {
+            return offset, nil
+        }
+    }
+    return 0, fmt.Errorf("invalid cursor")
+}
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+    "net/http"
+    "strconv"
+    "backend/middleware"
+    "backend/models"
+    "backend/services"
+
+    "github.com/gin-gonic/gin"
+)
+
+type PriceRuleController struct {
+    priceRuleService *services.PriceRuleService
+}
+
+func NewPriceRuleController() *PriceRuleController {
+    return &PriceRuleController{
+        priceRuleService: services.NewPriceRuleService(),
+    }
+}
+
+func (c *PriceRuleController) GetPriceRules(ctx *gin.Context) {
+    rules, err := c.priceRuleService.GetAllPriceRules()
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    ctx.JSON(http.StatusOK, gin.H{"data": rules})
+}
+
+func (c *PriceRuleController) CreatePriceRule(ctx *gin.Context) {
+    var rule models.PriceRule
+    if !bindJSON(ctx, &rule) {
+        return
+    }
+    
+    if err := c.priceRuleService.CreatePriceRule(&rule, middleware.CurrentUser(ctx)); err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    ctx.JSON(http.StatusCreated, gin.H{"data": rule})
+}
+
+func (c *PriceRuleController) UpdatePriceRule(ctx *gin.Context) {
+    id, err := strconv.Atoi(ctx.Param("id"))
+    if err != nil {
+        badRequest(ctx, "Invalid price rule ID")
+        return
+    }
+    
+    var rule models.PriceRule
+    if !bindJSON(ctx, &rule) {
+        return
+    }
+    
+    rule.PriceRuleID = id
+    if err := c.priceRuleService.UpdatePriceRule(&rule, middleware.CurrentUser(ctx)); err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    ctx.JSON(http.StatusOK, gin.H{"data": rule})
+}
+
+func (c *PriceRuleController) DeletePriceRule(ctx *gin.Context) {
+    id, err := strconv.Atoi(ctx.Param("id"))
+    if err != nil {
+        badRequest(ctx, "Invalid price rule ID")
+        return
+    }
+    
+    if err := c.priceRuleService.DeletePriceRule(id, middleware.CurrentUser(ctx)); err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    ctx.JSON(http.StatusOK, gin.H{"message": "Price rule deleted successfully"})
+}
@@ -0,0 +1,272 @@
+package controllers
+
+import (
+    "fmt"
+    "log"
+    "net/http"
+    "strconv"
+    "strings"
+    "backend/middleware"
+    "backend/models"
+    "backend/pdf"
+    "backend/services"
+    "backend/spreadsheet"
+
+    "github.com/gin-gonic/gin"
+)
+
+type PurchaseOrderController struct {
+    purchaseOrderService *services.PurchaseOrderService
+    supplierService      *services.SupplierService
+}
+
+func NewPurchaseOrderController() *PurchaseOrderController {
+    return &PurchaseOrderController{
+        purchaseOrderService: services.NewPurchaseOrderService(),
+        supplierService:      services.NewSupplierService(),
+    }
+}
+
+// GetPurchaseOrders lists orders, filtered by status and supplier_id.
+func (c *PurchaseOrderController) GetPurchaseOrders(ctx *gin.Context) {
+    params, err := parseListParams(ctx)
+    if err != nil {
+        badRequest(ctx, err.Error())
+        return
+    }
+
+    filter := models.PurchaseOrderFilter{ListParams: params, Status: ctx.Query("status")}
+    if v := ctx.Query("supplier_id"); v != "" {
+        id, err := strconv.Atoi(v)
+        if err != nil {
+            badRequest(ctx, "supplier_id must be a number")
+            return
+        }
+        filter.SupplierID = id
+    }
+
+    orders, total, err := c.purchaseOrderService.ListPurchaseOrders(filter)
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    respondPage(ctx, orders, params, total)
+}
+
+func (c *PurchaseOrderController) GetPurchaseOrder(ctx *gin.Context) {
+    id, ok := purchaseOrderID(ctx)
+    if !ok {
+        return
+    }
+
+    po, err := c.purchaseOrderService.GetPurchaseOrder(id)
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    ctx.JSON(http.StatusOK, gin.H{"data": po})
+}
+
+func (c *PurchaseOrderController) CreatePurchaseOrder(ctx *gin.Context) {
+    var po models.PurchaseOrder
+    if !bindJSON(ctx, &po) {
+        return
+    }
+
+    created, err := c.purchaseOrderService.CreatePurchaseOrder(&po, middleware.CurrentUser(ctx))
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    ctx.JSON(http.StatusCreated, gin.H{"data": created})
+}
+
+func (c *PurchaseOrderController) UpdatePurchaseOrder(ctx *gin.Context) {
+    id, ok := purchaseOrderID(ctx)
+    if !ok {
+        return
+    }
+
+    var po models.PurchaseOrder
+    if !bindJSON(ctx, &po) {
+        return
+    }
+
+    po.PurchaseOrderID = id
+    updated, err := c.purchaseOrderService.UpdatePurchaseOrder(&po, middleware.CurrentUser(ctx))
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    ctx.JSON(http.StatusOK, gin.H{"data": updated})
+}
+
+func (c *PurchaseOrderController) DeletePurchaseOrder(ctx *gin.Context) {
+    id, ok := purchaseOrderID(ctx)
+    if !ok {
+        return
+    }
+
+    if err := c.purchaseOrderService.DeletePurchaseOrder(id, middleware.CurrentUser(ctx)); err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    ctx.JSON(http.StatusOK, gin.H{"message": "Purchase order deleted successfully"})
+}
+
+func (c *PurchaseOrderController) SendPurchaseOrder(ctx *gin.Context) {
+    id, ok := purchaseOrderID(ctx)
+    if !ok {
+        return
+    }
+
+    po, err := c.purchaseOrderService.SendPurchaseOrder(id, middleware.CurrentUser(ctx))
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    ctx.JSON(http.StatusOK, gin.H{"data": po})
+}
+
+func (c *PurchaseOrderController) CancelPurchaseOrder(ctx *gin.Context) {
+    id, ok := purchaseOrderID(ctx)
+    if !ok {
+        return
+    }
+
+    po, err := c.purchaseOrderService.CancelPurchaseOrder(id, middleware.CurrentUser(ctx))
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    ctx.JSON(http.StatusOK, gin.H{"data": po})
+}
+
+// ReceivePurchaseOrder books delivered goods into stock.
+func (c *PurchaseOrderController) ReceivePurchaseOrder(ctx *gin.Context) {
+    id, ok := purchaseOrderID(ctx)
+    if !ok {
+        return
+    }
+
+    var req models.ReceivePurchaseOrderRequest
+    if !bindJSON(ctx, &req) {
+        return
+    }
+
+    po, err := c.purchaseOrderService.ReceivePurchaseOrder(id, &req, middleware.CurrentUser(ctx))
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    ctx.JSON(http.StatusOK, gin.H{"data": po})
+}
+
+// GetDocument returns the order as a document to send to the supplier: a PDF
+// by default, or a csv or xlsx sheet with ?format=.
+func (c *PurchaseOrderController) GetDocument(ctx *gin.Context) {
+    id, ok := purchaseOrderID(ctx)
+    if !ok {
+        return
+    }
+
+    format := ctx.DefaultQuery("format", "pdf")
+    if format != "pdf" && !spreadsheet.IsSupported(format) {
+        badRequest(ctx, "format must be pdf, csv or xlsx")
+        return
+    }
+
+    po, err := c.purchaseOrderService.GetPurchaseOrder(id)
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    if format != "pdf" {
+        header := []interface{}{"ingredient", "quantity", "unit", "unit_cost", "line_total"}
+        streamExport(ctx, format, po.OrderNumber, header, func(w spreadsheet.Writer) error {
+            for _, line := range po.Lines {
+                err := w.WriteRow(line.IngredientName, line.Quantity, line.Unit, line.UnitCost, line.Quantity*line.UnitCost)
+                if err != nil {
+                    return err
+                }
+            }
+            return nil
+        })
+        return
+    }
+
+    supplier, err := c.supplierService.GetSupplierByID(po.SupplierID)
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    ctx.Header("Content-Type", pdf.ContentType)
+    ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.pdf", po.OrderNumber))
+    ctx.Status(http.StatusOK)
+    if _, err := purchaseOrderPDF(po, supplier).WriteTo(ctx.Writer); err != nil {
+        log.Printf("purchase order %s pdf: %v", po.OrderNumber, err)
+    }
+}
+
+// purchaseOrderPDF lays out an order as a printable document.
+func purchaseOrderPDF(po *models.PurchaseOrder, supplier *models.Supplier) *pdf.Document {
+    doc := pdf.New()
+    doc.Heading("Purchase order " + po.OrderNumber)
+    doc.Blank()
+    doc.Line("Date:     " + po.CreatedAt.Format("2006-01-02"))
+    doc.Line("Supplier: " + supplier.Name)
+    if supplier.ContactName != "" {
+        doc.Line("Contact:  " + supplier.ContactName)
+    }
+    if supplier.Phone != "" {
+        doc.Line("Phone:    " + supplier.Phone)
+    }
+    if supplier.Email != "" {
+        doc.Line("Email:    " + supplier.Email)
+    }
+    doc.Blank()
+
+    const row = "%-36s %12s %-6s %10s %12s"
+    doc.BoldLine(fmt.Sprintf(row, "Ingredient", "Quantity", "Unit", "Unit cost", "Total"))
+    doc.Line(strings.Repeat("-", 80))
+    for _, line := range po.Lines {
+        doc.Line(fmt.Sprintf(row, truncate(line.IngredientName, 36),
+            strconv.FormatFloat(line.Quantity, 'f', -1, 64), truncate(line.Unit, 6),
+            fmt.Sprintf("%.2f", line.UnitCost), fmt.Sprintf("%.2f", line.Quantity*line.UnitCost)))
+    }
+    doc.Line(strings.Repeat("-", 80))
+    doc.BoldLine(fmt.Sprintf("%-67s %12s", "Total", fmt.Sprintf("%.2f", po.Total)))
+
+    if po.Notes != "" {
+        doc.Blank()
+        doc.Paragraph("Notes: " + po.Notes)
+    }
+    return doc
+}
+
+func truncate(s string, n int) string {
+    r := []rune(s)
+    if len(r) <= n {
+        return s
+    }
+    return string(r[:n])
+}
+
+func purchaseOrderID(ctx *gin.Context) (int, bool) {
+    id, err := strconv.Atoi(ctx.Param("id"))
+    if err != nil {
+        badRequest(ctx, "Invalid purchase order ID")
+        return 0, false
+    }
+    return id, true
+}
@@ -0,0 +1,211 @@
+package controllers
+
+import (
+    "fmt"
+    "net/http"
+    "time"
+    "backend/services"
+    "backend/spreadsheet"
+
+    "github.com/gin-gonic/gin"
+)
+
+type ReportController struct {
+    reportService *services.ReportService
+}
+
+func NewReportController() *ReportController {
+    return &ReportController{
+        reportService: services.NewReportService(),
+    }
+}
+
+func (c *ReportController) GetTaxReport(ctx *gin.Context) {
+    format, ok := exportFormat(ctx)
+    if !ok {
+        return
+    }
+
+    from, to, err := parseDateRange(ctx)
+    if err != nil {
+        badRequest(ctx, err.Error())
+        return
+    }
+
+    groupBy := ctx.DefaultQuery("group_by", "month")
+    if groupBy != "month" && groupBy != "quarter" {
+        badRequest(ctx, "group_by must be month or quarter")
+        return
+    }
+
+    report, err := c.reportService.GetTaxReport(from, to, groupBy)
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    if format == "" {
+        ctx.JSON(http.StatusOK, gin.H{"data": report})
+        return
+    }
+
+    header := []interface{}{"period", "tax_rate", "invoice_count", "taxable_sales", "exempt_sales", "tax_collected"}
+    streamExport(ctx, format, "tax-report", header, func(w spreadsheet.Writer) error {
+        for _, period := range report.Periods {
+            for _, line := range period.Components {
+                err := w.WriteRow(line.Period, line.TaxRate, line.InvoiceCount,
+                    line.TaxableSales, line.ExemptSales, line.TaxCollected)
+                if err != nil {
+                    return err
+                }
+            }
+            err := w.WriteRow(period.Period, "total", period.InvoiceCount,
+                period.TaxableSales, period.ExemptSales, period.TaxCollected)
+            if err != nil {
+                return err
+            }
+        }
+        return w.WriteRow("all", "total", report.InvoiceCount,
+            report.TaxableSales, report.ExemptSales, report.TaxCollected)
+    })
+}
+
+// GetStockVarianceReport shows the value of stock lost to wastage and found
+// missing by stock takes, per ingredient.
+func (c *ReportController) GetStockVarianceReport(ctx *gin.Context) {
+    format, ok := exportFormat(ctx)
+    if !ok {
+        return
+    }
+
+    from, to, err := parseDateRange(ctx)
+    if err != nil {
+        badRequest(ctx, err.Error())
+        return
+    }
+
+    report, err := c.reportService.GetStockVarianceReport(from, to)
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    if format == "" {
+        ctx.JSON(http.StatusOK, gin.H{"data": report})
+        return
+    }
+
+    header := []interface{}{"ingredient", "unit", "wastage_quantity", "wastage_value",
+        "stock_take_quantity", "stock_take_value", "total_value"}
+    streamExport(ctx, format, "stock-variance", header, func(w spreadsheet.Writer) error {
+        for _, line := range report.Lines {
+            err := w.WriteRow(line.IngredientName, line.Unit, line.WastageQuantity, line.WastageValue,
+                line.StockTakeQuantity, line.StockTakeValue, line.TotalValue)
+            if err != nil {
+                return err
+            }
+        }
+        return w.WriteRow("total", "", "", report.WastageValue, "", report.StockTakeValue, report.TotalValue)
+    })
+}
+
+// GetMarginReport shows revenue, cost of goods and margin per item or
+// category so low-margin items can be re-priced.
+func (c *ReportController) GetMarginReport(ctx *gin.Context) {
+    format, ok := exportFormat(ctx)
+    if !ok {
+        return
+    }
+
+    from, to, err := parseDateRange(ctx)
+    if err != nil {
+        badRequest(ctx, err.Error())
+        return
+    }
+
+    groupBy := ctx.DefaultQuery("group_by", "item")
+    if groupBy != "item" && groupBy != "category" {
+        badRequest(ctx, "group_by must be item or category")
+        return
+    }
+
+    report, err := c.reportService.GetMarginReport(from, to, groupBy)
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    if format == "" {
+        ctx.JSON(http.StatusOK, gin.H{"data": report})
+        return
+    }
+
+    header := []interface{}{groupBy + "_id", groupBy, "quantity_sold", "revenue", "cost_of_goods",
+        "margin", "margin_percent", "uncosted_quantity"}
+    streamExport(ctx, format, "margin-report", header, func(w spreadsheet.Writer) error {
+        for _, line := range report.Lines {
+            err := w.WriteRow(line.ID, line.Name, line.QuantitySold, line.Revenue, line.CostOfGoods,
+                line.Margin, line.MarginPercent, line.UncostedQuantity)
+            if err != nil {
+                return err
+            }
+        }
+        return w.WriteRow("", "total", "", report.Revenue, report.CostOfGoods,
+            report.Margin, report.MarginPercent, "")
+    })
+}
+
+// parseDateRange reads the inclusive from/to dates (YYYY-MM-DD) from the query
+// string and returns a half-open range. It defaults to the current year so far.
+func parseDateRange(ctx *gin.Context) (time.Time, time.Time, error) {
+    now := time.Now()
+    from := time.Date(now.Year(), 1, 1, 0, 0, 0, 0, time.Local)
+    to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local).AddDate(0, 0, 1)
+
+    fromDate, toDate, err := parseDateBounds(ctx)
+    if err != nil {
+        return from, to, err
+    }
+    if fromDate != nil {
+        from = *fromDate
+    }
+    if toDate != nil {
+        to = *toDate
+    }
+
+    if !from.Before(to) {
+        return from, to, fmt.Errorf("from date must not be after to date")
+    }
+
+    return from, to, nil
+}
+
+// parseDateBounds reads the optional from/to dates for list filters, which
+// leave a range open when a date is omitted. Like parseDateRange, to is
+// returned as the start of the day after it.
+func parseDateBounds(ctx *gin.Context) (*time.Time, *time.Time, error) {
+    var from, to *time.Time
+
+    if v := ctx.Query("from"); v != "" {
+        t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+        if err != nil {
+            return nil, nil, fmt.Errorf("invalid from date %q: expected YYYY-MM-DD", v)
+        }
+        from = &t
+    }
+
+    if v := ctx.Query("to"); v != "" {
+        t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+        if err != nil {
+            return nil, nil, fmt.Errorf("invalid to date %q: expected YYYY-MM-DD", v)
+        }
+        t = t.AddDate(0, 0, 1)
+        to = &t
+    }
+
+    if from != nil && to != nil && !from.Before(*to) {
+        return nil, nil, fmt.Errorf("from date must not be after to date")
+    }
+
+    return from, to, nil
+}
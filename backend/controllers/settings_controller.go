@@ -0,0 +1,46 @@
+package controllers
+
+import (
+    "net/http"
+    "backend/middleware"
+    "backend/services"
+
+    "github.com/gin-gonic/gin"
+)
+
+type SettingsController struct {
+    settingsService *services.SettingsService
+}
+
+func NewSettingsController() *SettingsController {
+    return &SettingsController{
+        settingsService: services.NewSettingsService(),
+    }
+}
+
+func (c *SettingsController) GetSettings(ctx *gin.Context) {
+    settings, err := c.settingsService.GetAllSettings()
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    ctx.JSON(http.StatusOK, gin.H{"data": settings})
+}
+
+func (c *SettingsController) UpdateSetting(ctx *gin.Context) {
+    var req struct {
+        Value string `json:"value" binding:"required"`
+    }
+    if !bindJSON(ctx, &req) {
+        return
+    }
+    
+    key := ctx.Param("key")
+    if err := c.settingsService.UpdateSetting(key, req.Value, middleware.CurrentUser(ctx)); err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    ctx.JSON(http.StatusOK, gin.H{"message": "Setting updated successfully"})
+}
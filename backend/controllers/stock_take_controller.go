@@ -0,0 +1,121 @@
+package controllers
+
+import (
+    "net/http"
+    "strconv"
+    "backend/middleware"
+    "backend/models"
+    "backend/services"
+
+    "github.com/gin-gonic/gin"
+)
+
+type StockTakeController struct {
+    stockTakeService *services.StockTakeService
+}
+
+func NewStockTakeController() *StockTakeController {
+    return &StockTakeController{
+        stockTakeService: services.NewStockTakeService(),
+    }
+}
+
+func (c *StockTakeController) GetStockTakes(ctx *gin.Context) {
+    takes, err := c.stockTakeService.GetAllStockTakes()
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    ctx.JSON(http.StatusOK, gin.H{"data": takes})
+}
+
+func (c *StockTakeController) GetStockTake(ctx *gin.Context) {
+    id, ok := stockTakeID(ctx)
+    if !ok {
+        return
+    }
+
+    take, err := c.stockTakeService.GetStockTake(id)
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    ctx.JSON(http.StatusOK, gin.H{"data": take})
+}
+
+// CreateStockTake starts a count of the listed ingredients, or of all of them.
+func (c *StockTakeController) CreateStockTake(ctx *gin.Context) {
+    var req models.CreateStockTakeRequest
+    if !bindJSON(ctx, &req) {
+        return
+    }
+
+    take, err := c.stockTakeService.CreateStockTake(&req, middleware.CurrentUser(ctx))
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    ctx.JSON(http.StatusCreated, gin.H{"data": take})
+}
+
+func (c *StockTakeController) RecordCounts(ctx *gin.Context) {
+    id, ok := stockTakeID(ctx)
+    if !ok {
+        return
+    }
+
+    var req models.StockCountRequest
+    if !bindJSON(ctx, &req) {
+        return
+    }
+
+    take, err := c.stockTakeService.RecordCounts(id, &req, middleware.CurrentUser(ctx))
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    ctx.JSON(http.StatusOK, gin.H{"data": take})
+}
+
+// PostStockTake adjusts stock to the counted quantities and closes the count.
+func (c *StockTakeController) PostStockTake(ctx *gin.Context) {
+    id, ok := stockTakeID(ctx)
+    if !ok {
+        return
+    }
+
+    take, err := c.stockTakeService.PostStockTake(id, middleware.CurrentUser(ctx))
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    ctx.JSON(http.StatusOK, gin.H{"data": take})
+}
+
+func (c *StockTakeController) DeleteStockTake(ctx *gin.Context) {
+    id, ok := stockTakeID(ctx)
+    if !ok {
+        return
+    }
+
+    if err := c.stockTakeService.DeleteStockTake(id, middleware.CurrentUser(ctx)); err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    ctx.JSON(http.StatusOK, gin.H{"message": "Stock take deleted successfully"})
+}
+
+func stockTakeID(ctx *gin.Context) (int, bool) {
+    id, err := strconv.Atoi(ctx.Param("id"))
+    if err != nil {
+        badRequest(ctx, "Invalid stock take ID")
+        return 0, false
+    }
+    return id, true
+}
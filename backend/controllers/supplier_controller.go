@@ -0,0 +1,97 @@
+package controllers
+
+import (
+    "net/http"
+    "strconv"
+    "backend/middleware"
+    "backend/models"
+    "backend/services"
+
+    "github.com/gin-gonic/gin"
+)
+
+type SupplierController struct {
+    supplierService *services.SupplierService
+}
+
+func NewSupplierController() *SupplierController {
+    return &SupplierController{
+        supplierService: services.NewSupplierService(),
+    }
+}
+
+func (c *SupplierController) GetSuppliers(ctx *gin.Context) {
+    suppliers, err := c.supplierService.GetAllSuppliers()
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    ctx.JSON(http.StatusOK, gin.H{"data": suppliers})
+}
+
+func (c *SupplierController) GetSupplier(ctx *gin.Context) {
+    id, err := strconv.Atoi(ctx.Param("id"))
+    if err != nil {
+        badRequest(ctx, "Invalid supplier ID")
+        return
+    }
+
+    supplier, err := c.supplierService.GetSupplierByID(id)
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    ctx.JSON(http.StatusOK, gin.H{"data": supplier})
+}
+
+func (c *SupplierController) CreateSupplier(ctx *gin.Context) {
+    var supplier models.Supplier
+    if !bindJSON(ctx, &supplier) {
+        return
+    }
+
+    if err := c.supplierService.CreateSupplier(&supplier, middleware.CurrentUser(ctx)); err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    ctx.JSON(http.StatusCreated, gin.H{"data": supplier})
+}
+
+func (c *SupplierController) UpdateSupplier(ctx *gin.Context) {
+    id, err := strconv.Atoi(ctx.Param("id"))
+    if err != nil {
+        badRequest(ctx, "Invalid supplier ID")
+        return
+    }
+
+    var supplier models.Supplier
+    if !bindJSON(ctx, &supplier) {
+        return
+    }
+
+    supplier.SupplierID = id
+    if err := c.supplierService.UpdateSupplier(&supplier, middleware.CurrentUser(ctx)); err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    ctx.JSON(http.StatusOK, gin.H{"data": supplier})
+}
+
+func (c *SupplierController) DeleteSupplier(ctx *gin.Context) {
+    id, err := strconv.Atoi(ctx.Param("id"))
+    if err != nil {
+        badRequest(ctx, "Invalid supplier ID")
+        return
+    }
+
+    if err := c.supplierService.DeleteSupplier(id, middleware.CurrentUser(ctx)); err != nil {
+        respondError(ctx, err)
+        return
+    }
+
+    ctx.JSON(http.StatusOK, gin.H{"message": "Supplier deleted successfully"})
+}
@@ -0,0 +1,66 @@
+package controllers
+
+import (
+    "net/http"
+    "strconv"
+    "backend/middleware"
+    "backend/models"
+    "backend/services"
+
+    "github.com/gin-gonic/gin"
+)
+
+type UserController struct {
+    userService *services.UserService
+}
+
+func NewUserController() *UserController {
+    return &UserController{
+        userService: services.NewUserService(),
+    }
+}
+
+func (c *UserController) GetUsers(ctx *gin.Context) {
+    users, err := c.userService.GetAllUsers()
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    ctx.JSON(http.StatusOK, gin.H{"data": users})
+}
+
+func (c *UserController) CreateUser(ctx *gin.Context) {
+    var req models.CreateUserRequest
+    if !bindJSON(ctx, &req) {
+        return
+    }
+    
+    user, err := c.userService.CreateUser(&req, middleware.CurrentUser(ctx))
+    if err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    ctx.JSON(http.StatusCreated, gin.H{"data": user})
+}
+
+func (c *UserController) UpdateUser(ctx *gin.Context) {
+    id, err := strconv.Atoi(ctx.Param("id"))
+    if err != nil {
+        badRequest(ctx, "Invalid user ID")
+        return
+    }
+    
+    var req models.UpdateUserRequest
+    if !bindJSON(ctx, &req) {
+        return
+    }
+    
+    if err := c.userService.UpdateUser(id, &req, middleware.CurrentUser(ctx)); err != nil {
+        respondError(ctx, err)
+        return
+    }
+    
+    ctx.JSON(http.StatusOK, gin.H{"message": "User updated successfully"})
+}
@@ -0,0 +1,176 @@
+package controllers
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "reflect"
+    "regexp"
+    "strings"
+    "backend/services"
+
+    "github.com/gin-gonic/gin/binding"
+    "github.com/go-playground/validator/v10"
+)
+
+var phonePattern = regexp.MustCompile(`^\+?[0-9][0-9 ()-]{5,18}[0-9]$`)
+
+// validate is the engine behind the binding tags, set up by RegisterValidators.
+var validate *validator.Validate
+
+// lookupRecord backs the <entity>_exists rules.
+var lookupRecord = services.RecordExists
+
+// lookupFailure carries a failed existence lookup out of validation, so it is
+// reported as a server error instead of a record that does not exist.
+type lookupFailure struct {
+    err error
+}
+
+type lookupFailureKey struct{}
+
+// RegisterValidators adds the custom rules used in the binding tags of the
+// request models: notblank, phone and the <entity>_exists referential checks.
+// Field errors are reported using the JSON field names.
+func RegisterValidators() error {
+    v, ok := binding.Validator.Engine().(*validator.Validate)
+    if !ok {
+        return fmt.Errorf("unexpected validator engine %T", binding.Validator.Engine())
+    }
+
+    v.RegisterTagNameFunc(func(field reflect.StructField) string {
+        name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+        if name == "-" {
+            return ""
+        }
+        return name
+    })
+
+    rules := map[string]validator.Func{
+        "notblank": func(fl validator.FieldLevel) bool {
+            return strings.TrimSpace(fl.Field().String()) != ""
+        },
+        "phone": func(fl validator.FieldLevel) bool {
+            return phonePattern.MatchString(fl.Field().String())
+        },
+    }
+    lookups := map[string]validator.FuncCtx{
+        "category_exists":   recordExists("category"),
+        "customer_exists":   recordExists("customer"),
+        "ingredient_exists": recordExists("ingredient"),
+        "item_exists":       recordExists("item"),
+        "supplier_exists":   recordExists("supplier"),
+    }
+
+    for tag, fn := range rules {
+        if err := v.RegisterValidation(tag, fn); err != nil {
+            return err
+        }
+    }
+    for tag, fn := range lookups {
+        if err := v.RegisterValidationCtx(tag, fn); err != nil {
+            return err
+        }
+    }
+    validate = v
+    return nil
+}
+
+func recordExists(entity string) validator.FuncCtx {
+    return func(ctx context.Context, fl validator.FieldLevel) bool {
+        id := int(fl.Field().Int())
+        if id <= 0 {
+            // Left to the gt=0 rule so only one error is reported for the field
+            return true
+        }
+
+        exists, err := lookupRecord(entity, id)
+        if err != nil {
+            if failure, ok := ctx.Value(lookupFailureKey{}).(*lookupFailure); ok && failure.err == nil {
+                failure.err = fmt.Errorf("validate %s %d: %w", entity, id, err)
+            }
+            return true
+        }
+        return exists
+    }
+}
+
+// validateStruct checks obj against its binding tags. A database failure in
+// an existence lookup is returned as is rather than as a validation error.
+func validateStruct(ctx context.Context, obj interface{}) error {
+    failure := &lookupFailure{}
+    err := validate.StructCtx(context.WithValue(ctx, lookupFailureKey{}, failure), obj)
+    if failure.err != nil {
+        return failure.err
+    }
+    if err != nil {
+        if appErr := validationError(err); appErr != nil {
+            return appErr
+        }
+    }
+    return err
+}
+
+// validationError converts binding errors into a single validation error
+// listing every invalid field.
+func validationError(err error) *services.AppError {
+    var verrs validator.ValidationErrors
+    if !errors.As(err, &verrs) {
+        return nil
+    }
+
+    fields := make(map[string]string, len(verrs))
+    for _, fe := range verrs {
+        fields[fieldPath(fe)] = fieldMessage(fe)
+    }
+    return services.ValidationError("request validation failed", fields)
+}
+
+// fieldPath drops the struct name from the namespace, so
+// "CreateInvoiceRequest.items[0].quantity" becomes "items[0].quantity".
+func fieldPath(fe validator.FieldError) string {
+    ns := fe.Namespace()
+    if i := strings.Index(ns, "."); i >= 0 {
+        return ns[i+1:]
+    }
+    return ns
+}
+
+func fieldMessage(fe validator.FieldError) string {
+    switch fe.Tag() {
+    case "required", "notblank":
+        return "is required"
+    case "gt":
+        return "must be greater than " + fe.Param()
+    case "gte":
+        return "must be at least " + fe.Param()
+    case "lte":
+        return "must be at most " + fe.Param()
+    case "min":
+        if fe.Kind() == reflect.Slice {
+            return "must contain at least " + fe.Param() + " entries"
+        }
+        return "must be at least " + fe.Param() + " characters"
+    case "max":
+        if fe.Kind() == reflect.Slice {
+            return "must contain at most " + fe.Param() + " entries"
+        }
+        return "must be at most " + fe.Param() + " characters"
+    case "email":
+        return "must be a valid email address"
+    case "phone":
+        return "must be a valid phone number"
+    case "category_exists", "customer_exists", "ingredient_exists", "item_exists", "supplier_exists":
+        return "does not exist"
+    case "datetime":
+        return "must be a time in " + fe.Param() + " format"
+    case "unique":
+        return "must not contain duplicates"
+    case "numeric":
+        return "must contain only digits"
+    case "oneof":
+        return "must be one of " + strings.ReplaceAll(fe.Param(), " ", ", ")
+    default:
+        return "is invalid"
+    }
+}
@@ -0,0 +1,72 @@
+package controllers
+
+import (
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+)
+
+func init() {
+    gin.SetMode(gin.TestMode)
+    if err := RegisterValidators(); err != nil {
+        panic(err)
+    }
+}
+
+// withLookup replaces the existence lookup for the duration of a test.
+func withLookup(t *testing.T, fn func(entity string, id int) (bool, error)) {
+    t.Helper()
+    saved := lookupRecord
+    lookupRecord = fn
+    t.Cleanup(func() { lookupRecord = saved })
+}
+
+// bindTest binds body into obj the way a handler would and returns the
+// response recorded when binding fails.
+func bindTest(body string, obj interface{}) (bool, *httptest.ResponseRecorder) {
+    w := httptest.NewRecorder()
+    ctx, _ := gin.CreateTestContext(w)
+    ctx.Request = httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+    return bindJSON(ctx, obj), w
+}
+
+func TestBindJSONReferences(t *testing.T) {
+    type request struct {
+        CategoryID int `json:"category_id" binding:"required,gt=0,category_exists"`
+    }
+
+    tests := []struct {
+        name   string
+        lookup func(string, int) (bool, error)
+        status int
+    }{
+        {"exists", func(string, int) (bool, error) { return true, nil }, http.StatusOK},
+        {"missing", func(string, int) (bool, error) { return false, nil }, http.StatusUnprocessableEntity},
+        // A database outage is not the client's fault
+        {"lookup fails", func(string, int) (bool, error) { return false, errors.New("connection refused") }, http.StatusInternalServerError},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            withLookup(t, tt.lookup)
+            var req request
+            ok, w := bindTest(`{"category_id": 3}`, &req)
+            if ok != (tt.status == http.StatusOK) || (!ok && w.Code != tt.status) {
+                t.Errorf("got ok=%v status %d, want status %d", ok, w.Code, tt.status)
+            }
+        })
+    }
+}
+
+func TestBindJSONMalformed(t *testing.T) {
+    var req struct {
+        Quantity int `json:"quantity"`
+    }
+    if ok, w := bindTest(`{"quantity": "two"}`, &req); ok || w.Code != http.StatusBadRequest {
+        t.Errorf("got ok=%v status %d, want status 400", ok, w.Code)
+    }
+}
@@ -0,0 +1,438 @@
+package database
+
+import (
+    "fmt"
+)
+
+// migration is a schema change applied once, in order, on startup. Each
+// statement runs as its own batch because SQL Server cannot reference a
+// column in the same batch that adds it.
+type migration struct {
+    id         string
+    statements []string
+}
+
+var migrations = []migration{
+    {
+        id: "0001_invoice_status",
+        statements: []string{
+            `ALTER TABLE Invoices ADD Status NVARCHAR(20) NOT NULL CONSTRAINT DF_Invoices_Status DEFAULT 'issued'`,
+            `CREATE INDEX IX_Invoices_InvoiceDate ON Invoices (InvoiceDate DESC, InvoiceID DESC)`,
+        },
+    },
+    {
+        id: "0002_auth",
+        statements: []string{
+            `CREATE TABLE Users (
+                UserID INT IDENTITY(1,1) PRIMARY KEY,
+                Username NVARCHAR(50) NOT NULL CONSTRAINT UQ_Users_Username UNIQUE,
+                PasswordHash NVARCHAR(100) NOT NULL,
+                FullName NVARCHAR(100) NOT NULL DEFAULT '',
+                IsActive BIT NOT NULL DEFAULT 1,
+                CreatedAt DATETIME NOT NULL DEFAULT GETDATE()
+            )`,
+            `CREATE TABLE RefreshTokens (
+                TokenID INT IDENTITY(1,1) PRIMARY KEY,
+                UserID INT NOT NULL REFERENCES Users(UserID),
+                TokenHash CHAR(64) NOT NULL CONSTRAINT UQ_RefreshTokens_TokenHash UNIQUE,
+                ExpiresAt DATETIME NOT NULL,
+                RevokedAt DATETIME NULL,
+                CreatedAt DATETIME NOT NULL DEFAULT GETDATE()
+            )`,
+            `CREATE TABLE RevokedTokens (
+                TokenJTI NVARCHAR(64) NOT NULL PRIMARY KEY,
+                ExpiresAt DATETIME NOT NULL
+            )`,
+        },
+    },
+    {
+        id: "0003_roles_and_voids",
+        statements: []string{
+            `ALTER TABLE Users ADD Role NVARCHAR(20) NOT NULL CONSTRAINT DF_Users_Role DEFAULT 'cashier'`,
+            // Accounts created before roles existed were all administrators
+            `UPDATE Users SET Role = 'admin'`,
+            `ALTER TABLE Invoices ADD VoidedAt DATETIME NULL, VoidedBy INT NULL REFERENCES Users(UserID), VoidReason NVARCHAR(255) NULL`,
+            `CREATE TABLE Settings (
+                SettingKey NVARCHAR(50) NOT NULL PRIMARY KEY,
+                SettingValue NVARCHAR(200) NOT NULL,
+                UpdatedAt DATETIME NOT NULL DEFAULT GETDATE()
+            )`,
+        },
+    },
+    {
+        id: "0004_manager_approvals",
+        statements: []string{
+            `ALTER TABLE Users ADD PinHash NVARCHAR(100) NULL, PinFailedAttempts INT NOT NULL CONSTRAINT DF_Users_PinFailedAttempts DEFAULT 0, PinLockedUntil DATETIME NULL`,
+            `CREATE TABLE Approvals (
+                ApprovalID INT IDENTITY(1,1) PRIMARY KEY,
+                Action NVARCHAR(30) NOT NULL,
+                RequestedBy INT NOT NULL REFERENCES Users(UserID),
+                ApprovedBy INT NOT NULL REFERENCES Users(UserID),
+                InvoiceID INT NULL REFERENCES Invoices(InvoiceID),
+                TokenHash CHAR(64) NOT NULL CONSTRAINT UQ_Approvals_TokenHash UNIQUE,
+                ExpiresAt DATETIME NOT NULL,
+                UsedAt DATETIME NULL,
+                CreatedAt DATETIME NOT NULL DEFAULT GETDATE()
+            )`,
+            `ALTER TABLE Invoices ADD VoidApprovalID INT NULL REFERENCES Approvals(ApprovalID)`,
+            `ALTER TABLE InvoiceItems ADD PriceApprovalID INT NULL REFERENCES Approvals(ApprovalID)`,
+        },
+    },
+    {
+        id: "0005_audit_log",
+        statements: []string{
+            // UserID has no foreign key so entries outlive the accounts they name
+            `CREATE TABLE AuditLogs (
+                AuditID BIGINT IDENTITY(1,1) PRIMARY KEY,
+                OccurredAt DATETIME NOT NULL DEFAULT GETDATE(),
+                UserID INT NULL,
+                Username NVARCHAR(50) NOT NULL DEFAULT '',
+                EntityType NVARCHAR(30) NOT NULL,
+                EntityID INT NOT NULL,
+                Action NVARCHAR(30) NOT NULL,
+                BeforeData NVARCHAR(MAX) NULL,
+                AfterData NVARCHAR(MAX) NULL
+            )`,
+            `CREATE INDEX IX_AuditLogs_Entity ON AuditLogs (EntityType, EntityID, AuditID DESC)`,
+            `CREATE INDEX IX_AuditLogs_OccurredAt ON AuditLogs (OccurredAt DESC)`,
+            // The log is append-only: updates and deletes are rejected
+            `CREATE TRIGGER TR_AuditLogs_AppendOnly ON AuditLogs
+            INSTEAD OF UPDATE, DELETE
+            AS
+            BEGIN
+                THROW 51000, 'AuditLogs is append-only', 1;
+            END`,
+        },
+    },
+    {
+        id: "0006_invoice_chain",
+        statements: []string{
+            `CREATE TABLE InvoiceChain (
+                Sequence INT NOT NULL PRIMARY KEY,
+                InvoiceID INT NOT NULL CONSTRAINT UQ_InvoiceChain_InvoiceID UNIQUE REFERENCES Invoices(InvoiceID),
+                PrevHash CHAR(64) NOT NULL,
+                ChainHash CHAR(64) NOT NULL,
+                Signature NVARCHAR(100) NULL,
+                KeyID CHAR(16) NULL,
+                ChainedAt DATETIME NOT NULL DEFAULT GETDATE()
+            )`,
+        },
+    },
+    {
+        id: "0007_item_prices",
+        statements: []string{
+            `CREATE TABLE ItemPrices (
+                ItemPriceID INT IDENTITY(1,1) PRIMARY KEY,
+                ItemID INT NOT NULL REFERENCES Items(ItemID),
+                Price DECIMAL(10,2) NOT NULL,
+                EffectiveFrom DATETIME NOT NULL,
+                EffectiveTo DATETIME NULL,
+                CreatedBy INT NULL REFERENCES Users(UserID),
+                CreatedAt DATETIME NOT NULL DEFAULT GETDATE(),
+                CONSTRAINT UQ_ItemPrices_ItemFrom UNIQUE (ItemID, EffectiveFrom)
+            )`,
+            // Current prices become the first period, in effect since before any invoice
+            `INSERT INTO ItemPrices (ItemID, Price, EffectiveFrom)
+            SELECT ItemID, BasePrice, '1900-01-01' FROM Items`,
+        },
+    },
+    {
+        id: "0008_price_rules",
+        statements: []string{
+            // DaysMask has bit n set for weekday n, Sunday being 0; times are minutes since midnight
+            `CREATE TABLE PriceRules (
+                PriceRuleID INT IDENTITY(1,1) PRIMARY KEY,
+                Name NVARCHAR(100) NOT NULL,
+                DaysMask INT NOT NULL,
+                StartMinute INT NOT NULL,
+                EndMinute INT NOT NULL,
+                ItemID INT NULL REFERENCES Items(ItemID),
+                CategoryID INT NULL REFERENCES Categories(CategoryID),
+                DiscountPercent DECIMAL(5,2) NULL,
+                FixedPrice DECIMAL(10,2) NULL,
+                IsActive BIT NOT NULL DEFAULT 1,
+                CreatedAt DATETIME NOT NULL DEFAULT GETDATE()
+            )`,
+            `ALTER TABLE InvoiceItems ADD PriceRuleID INT NULL REFERENCES PriceRules(PriceRuleID)`,
+        },
+    },
+    {
+        id: "0009_item_availability",
+        statements: []string{
+            `ALTER TABLE Items ADD
+                Availability NVARCHAR(20) NOT NULL CONSTRAINT DF_Items_Availability DEFAULT 'available',
+                SoldOutUntil DATETIME NULL,
+                AvailabilitySource NVARCHAR(10) NOT NULL CONSTRAINT DF_Items_AvailabilitySource DEFAULT 'manual'`,
+        },
+    },
+    {
+        id: "0010_inventory",
+        statements: []string{
+            `CREATE TABLE Ingredients (
+                IngredientID INT IDENTITY(1,1) PRIMARY KEY,
+                Name NVARCHAR(100) NOT NULL CONSTRAINT UQ_Ingredients_Name UNIQUE,
+                Unit NVARCHAR(20) NOT NULL,
+                OnHand DECIMAL(12,3) NOT NULL DEFAULT 0,
+                CreatedAt DATETIME NOT NULL DEFAULT GETDATE()
+            )`,
+            `CREATE TABLE RecipeLines (
+                ItemID INT NOT NULL REFERENCES Items(ItemID),
+                IngredientID INT NOT NULL REFERENCES Ingredients(IngredientID),
+                Quantity DECIMAL(12,3) NOT NULL,
+                PRIMARY KEY (ItemID, IngredientID)
+            )`,
+            // Quantity is signed: negative when stock is used, positive when it comes back
+            `CREATE TABLE StockMovements (
+                MovementID BIGINT IDENTITY(1,1) PRIMARY KEY,
+                IngredientID INT NOT NULL REFERENCES Ingredients(IngredientID),
+                Quantity DECIMAL(12,3) NOT NULL,
+                Reason NVARCHAR(20) NOT NULL,
+                InvoiceID INT NULL REFERENCES Invoices(InvoiceID),
+                UserID INT NULL REFERENCES Users(UserID),
+                Note NVARCHAR(255) NOT NULL DEFAULT '',
+                OccurredAt DATETIME NOT NULL DEFAULT GETDATE()
+            )`,
+            `CREATE INDEX IX_StockMovements_Ingredient ON StockMovements (IngredientID, OccurredAt)`,
+            `CREATE INDEX IX_StockMovements_Invoice ON StockMovements (InvoiceID)`,
+        },
+    },
+    {
+        id: "0011_stock_alerts",
+        statements: []string{
+            `ALTER TABLE Ingredients ADD ReorderPoint DECIMAL(12,3) NULL`,
+            // An alert stays open until stock is back above the reorder point
+            `CREATE TABLE StockAlerts (
+                AlertID INT IDENTITY(1,1) PRIMARY KEY,
+                IngredientID INT NOT NULL REFERENCES Ingredients(IngredientID),
+                OnHand DECIMAL(12,3) NOT NULL,
+                ReorderPoint DECIMAL(12,3) NOT NULL,
+                DailyUsage DECIMAL(12,3) NOT NULL,
+                SuggestedQuantity DECIMAL(12,3) NOT NULL,
+                CreatedAt DATETIME NOT NULL DEFAULT GETDATE(),
+                CheckedAt DATETIME NOT NULL DEFAULT GETDATE(),
+                ResolvedAt DATETIME NULL
+            )`,
+            `CREATE UNIQUE INDEX UX_StockAlerts_Open ON StockAlerts (IngredientID) WHERE ResolvedAt IS NULL`,
+        },
+    },
+    {
+        id: "0012_purchasing",
+        statements: []string{
+            `CREATE TABLE Suppliers (
+                SupplierID INT IDENTITY(1,1) PRIMARY KEY,
+                Name NVARCHAR(100) NOT NULL CONSTRAINT UQ_Suppliers_Name UNIQUE,
+                ContactName NVARCHAR(100) NOT NULL DEFAULT '',
+                Phone NVARCHAR(20) NOT NULL DEFAULT '',
+                Email NVARCHAR(100) NOT NULL DEFAULT '',
+                Notes NVARCHAR(500) NOT NULL DEFAULT '',
+                CreatedAt DATETIME NOT NULL DEFAULT GETDATE()
+            )`,
+            `CREATE TABLE PurchaseOrders (
+                PurchaseOrderID INT IDENTITY(1,1) PRIMARY KEY,
+                SupplierID INT NOT NULL REFERENCES Suppliers(SupplierID),
+                Status NVARCHAR(20) NOT NULL DEFAULT 'draft',
+                Notes NVARCHAR(500) NOT NULL DEFAULT '',
+                CreatedBy INT NULL REFERENCES Users(UserID),
+                CreatedAt DATETIME NOT NULL DEFAULT GETDATE(),
+                SentAt DATETIME NULL,
+                ReceivedAt DATETIME NULL
+            )`,
+            `CREATE TABLE PurchaseOrderLines (
+                LineID INT IDENTITY(1,1) PRIMARY KEY,
+                PurchaseOrderID INT NOT NULL REFERENCES PurchaseOrders(PurchaseOrderID),
+                IngredientID INT NOT NULL REFERENCES Ingredients(IngredientID),
+                Quantity DECIMAL(12,3) NOT NULL,
+                UnitCost DECIMAL(12,4) NOT NULL,
+                ReceivedQuantity DECIMAL(12,3) NOT NULL DEFAULT 0
+            )`,
+            // UnitCost is the latest known cost per unit of the ingredient
+            `ALTER TABLE Ingredients ADD UnitCost DECIMAL(12,4) NULL`,
+            `ALTER TABLE StockMovements ADD
+                PurchaseOrderID INT NULL REFERENCES PurchaseOrders(PurchaseOrderID),
+                UnitCost DECIMAL(12,4) NULL`,
+        },
+    },
+    {
+        id: "0013_stock_takes",
+        statements: []string{
+            `CREATE TABLE StockTakes (
+                StockTakeID INT IDENTITY(1,1) PRIMARY KEY,
+                Status NVARCHAR(20) NOT NULL DEFAULT 'open',
+                Notes NVARCHAR(500) NOT NULL DEFAULT '',
+                CreatedBy INT NULL REFERENCES Users(UserID),
+                CreatedAt DATETIME NOT NULL DEFAULT GETDATE(),
+                PostedBy INT NULL REFERENCES Users(UserID),
+                PostedAt DATETIME NULL
+            )`,
+            `CREATE TABLE StockTakeLines (
+                StockTakeID INT NOT NULL REFERENCES StockTakes(StockTakeID),
+                IngredientID INT NOT NULL REFERENCES Ingredients(IngredientID),
+                ExpectedQuantity DECIMAL(12,3) NOT NULL,
+                CountedQuantity DECIMAL(12,3) NULL,
+                Reason NVARCHAR(255) NOT NULL DEFAULT '',
+                PRIMARY KEY (StockTakeID, IngredientID)
+            )`,
+            `ALTER TABLE StockMovements ADD StockTakeID INT NULL REFERENCES StockTakes(StockTakeID)`,
+        },
+    },
+    {
+        id: "0014_item_costs",
+        statements: []string{
+            // Each sold line keeps the recipe cost of one unit at the time of sale
+            `ALTER TABLE InvoiceItems ADD UnitCost DECIMAL(12,4) NULL`,
+        },
+    },
+    {
+        id: "0015_bundles",
+        statements: []string{
+            // A bundle is an item with slots; each slot is filled from its choices
+            `CREATE TABLE BundleSlots (
+                SlotID INT IDENTITY(1,1) PRIMARY KEY,
+                BundleItemID INT NOT NULL REFERENCES Items(ItemID),
+                Name NVARCHAR(100) NOT NULL,
+                Quantity INT NOT NULL DEFAULT 1,
+                SortOrder INT NOT NULL DEFAULT 0
+            )`,
+            `CREATE INDEX IX_BundleSlots_Bundle ON BundleSlots (BundleItemID)`,
+            `CREATE TABLE BundleChoices (
+                SlotID INT NOT NULL REFERENCES BundleSlots(SlotID),
+                ItemID INT NOT NULL REFERENCES Items(ItemID),
+                Surcharge DECIMAL(10,2) NOT NULL DEFAULT 0,
+                PRIMARY KEY (SlotID, ItemID)
+            )`,
+            `CREATE INDEX IX_BundleChoices_Item ON BundleChoices (ItemID)`,
+            // Components of a sold bundle are lines of their own under the bundle's line
+            `ALTER TABLE InvoiceItems ADD ParentInvoiceItemID INT NULL REFERENCES InvoiceItems(InvoiceItemID)`,
+            `ALTER TABLE InvoiceItems ADD SlotName NVARCHAR(100) NULL`,
+        },
+    },
+    {
+        id: "0016_menu_structure",
+        statements: []string{
+            `ALTER TABLE Categories ADD ParentCategoryID INT NULL REFERENCES Categories(CategoryID)`,
+            `ALTER TABLE Categories ADD SortOrder INT NOT NULL DEFAULT 0`,
+            `ALTER TABLE Categories ADD IsActive BIT NOT NULL DEFAULT 1`,
+            `ALTER TABLE Items ADD SortOrder INT NOT NULL DEFAULT 0`,
+        },
+    },
+    {
+        id: "0017_item_menu_details",
+        statements: []string{
+            // Allergens is a comma-separated list of tags such as gluten,dairy
+            `ALTER TABLE Items ADD Allergens NVARCHAR(200) NOT NULL DEFAULT ''`,
+            `ALTER TABLE Items ADD IsVegetarian BIT NOT NULL DEFAULT 0`,
+            `ALTER TABLE Items ADD IsVegan BIT NOT NULL DEFAULT 0`,
+            `ALTER TABLE Items ADD SpicyLevel TINYINT NOT NULL DEFAULT 0`,
+            `ALTER TABLE Items ADD Calories INT NULL`,
+            `ALTER TABLE Items ADD ImageKey NVARCHAR(200) NULL`,
+            `ALTER TABLE Items ADD ThumbnailKey NVARCHAR(200) NULL`,
+        },
+    },
+    {
+        id: "0018_item_codes",
+        statements: []string{
+            `ALTER TABLE Items ADD SKU NVARCHAR(50) NULL`,
+            `ALTER TABLE Items ADD Barcode NVARCHAR(14) NULL`,
+            `ALTER TABLE Items ADD PLU NVARCHAR(5) NULL`,
+            // Codes are optional, so uniqueness only applies to items that have one
+            `CREATE UNIQUE INDEX UX_Items_SKU ON Items (SKU) WHERE SKU IS NOT NULL`,
+            `CREATE UNIQUE INDEX UX_Items_Barcode ON Items (Barcode) WHERE Barcode IS NOT NULL`,
+            `CREATE UNIQUE INDEX UX_Items_PLU ON Items (PLU) WHERE PLU IS NOT NULL`,
+        },
+    },
+    {
+        id: "0019_archiving",
+        statements: []string{
+            // Archived records stay referenced by old invoices but leave the default lists
+            `ALTER TABLE Items ADD ArchivedAt DATETIME NULL`,
+            `ALTER TABLE Categories ADD ArchivedAt DATETIME NULL`,
+            `ALTER TABLE Customers ADD ArchivedAt DATETIME NULL`,
+        },
+    },
+    {
+        id: "0020_invoice_line_snapshots",
+        statements: []string{
+            `ALTER TABLE InvoiceItems ADD ItemName NVARCHAR(100) NULL`,
+            `ALTER TABLE InvoiceItems ADD ItemDescription NVARCHAR(500) NULL`,
+            `ALTER TABLE InvoiceItems ADD CategoryID INT NULL`,
+            `ALTER TABLE InvoiceItems ADD CategoryName NVARCHAR(100) NULL`,
+            // Earlier lines get today's names, the closest record there is of what was sold
+            `UPDATE ii
+            SET ItemName = i.ItemName, ItemDescription = i.Description,
+                CategoryID = i.CategoryID, CategoryName = c.CategoryName
+            FROM InvoiceItems ii
+            JOIN Items i ON ii.ItemID = i.ItemID
+            LEFT JOIN Categories c ON i.CategoryID = c.CategoryID`,
+        },
+    },
+    {
+        id: "0021_invoice_chain_version",
+        statements: []string{
+            // Existing links were hashed without the line snapshots and keep verifying as version 1
+            `ALTER TABLE InvoiceChain ADD ContentVersion INT NOT NULL CONSTRAINT DF_InvoiceChain_ContentVersion DEFAULT 1`,
+        },
+    },
+    {
+        id: "0022_no_sales",
+        statements: []string{
+            `CREATE TABLE NoSales (
+                NoSaleID INT IDENTITY(1,1) PRIMARY KEY,
+                UserID INT NOT NULL REFERENCES Users(UserID),
+                ApprovalID INT NULL REFERENCES Approvals(ApprovalID),
+                Reason NVARCHAR(255) NOT NULL,
+                OpenedAt DATETIME NOT NULL DEFAULT GETDATE()
+            )`,
+        },
+    },
+}
+
+// Migrate applies every migration that has not yet been recorded in the
+// SchemaMigrations table.
+func Migrate() error {
+    _, err := DB.Exec(`
+        IF OBJECT_ID('SchemaMigrations', 'U') IS NULL
+        CREATE TABLE SchemaMigrations (
+            MigrationID NVARCHAR(100) NOT NULL PRIMARY KEY,
+            AppliedAt DATETIME NOT NULL DEFAULT GETDATE()
+        )
+    `)
+    if err != nil {
+        return fmt.Errorf("failed to create migrations table: %v", err)
+    }
+
+    for _, m := range migrations {
+        var count int
+        err := DB.QueryRow(`SELECT COUNT(*) FROM SchemaMigrations WHERE MigrationID = ?`, m.id).Scan(&count)
+        if err != nil {
+            return err
+        }
+        if count > 0 {
+            continue
+        }
+
+        tx, err := DB.Begin()
+        if err != nil {
+            return err
+        }
+
+        for _, stmt := range m.statements {
+            if _, err := tx.Exec(stmt); err != nil {
+                tx.Rollback()
+                return fmt.Errorf("migration %s failed: %v", m.id, err)
+            }
+        }
+
+        if _, err := tx.Exec(`INSERT INTO SchemaMigrations (MigrationID) VALUES (?)`, m.id); err != nil {
+            tx.Rollback()
+            return err
+        }
+
+        if err := tx.Commit(); err != nil {
+            return err
+        }
+
+        fmt.Printf("Applied migration %s\n", m.id)
+    }
+
+    return nil
+}
@@ -0,0 +1,110 @@
+// Package imaging decodes uploaded images and makes thumbnails using only the
+// standard library. JPEG and PNG are supported.
+package imaging
+
+import (
+    "bytes"
+    "fmt"
+    "image"
+    "image/draw"
+    "image/jpeg"
+    "image/png"
+    "io"
+)
+
+// Image formats, as reported by Decode.
+const (
+    JPEG = "jpeg"
+    PNG  = "png"
+)
+
+// jpegQuality is used for every JPEG written; it keeps files small without
+// visible artefacts.
+const jpegQuality = 85
+
+// Decode reads a JPEG or PNG image. The dimensions are checked before the
+// pixels are decoded, so an image larger than maxPixels is rejected without
+// allocating memory for it. A JPEG is turned upright by its EXIF orientation,
+// since the orientation is lost when the image is encoded again.
+func Decode(data []byte, maxPixels int) (image.Image, string, error) {
+    cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+    if err != nil {
+        return nil, "", fmt.Errorf("must be a JPEG or PNG image")
+    }
+    if format != JPEG && format != PNG {
+        return nil, "", fmt.Errorf("must be a JPEG or PNG image, not %s", format)
+    }
+    if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxPixels {
+        return nil, "", fmt.Errorf("image is %dx%d pixels; at most %d pixels are allowed", cfg.Width, cfg.Height, maxPixels)
+    }
+
+    img, _, err := image.Decode(bytes.NewReader(data))
+    if err != nil {
+        return nil, "", fmt.Errorf("image could not be read: %v", err)
+    }
+    if format == JPEG {
+        img = orient(img, jpegOrientation(data))
+    }
+    return img, format, nil
+}
+
+// Encode writes img in the given format.
+func Encode(w io.Writer, img image.Image, format string) error {
+    switch format {
+    case JPEG:
+        return jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+    case PNG:
+        return png.Encode(w, img)
+    default:
+        return fmt.Errorf("unsupported image format %q", format)
+    }
+}
+
+// Thumbnail scales img down to fit within size x size pixels, keeping its
+// aspect ratio. Each thumbnail pixel is the average of the source pixels it
+// covers. Images that already fit keep their size.
+func Thumbnail(img image.Image, size int) *image.RGBA {
+    bounds := img.Bounds()
+    w, h := bounds.Dx(), bounds.Dy()
+    tw, th := w, h
+    if w > size || h > size {
+        if w >= h {
+            tw, th = size, max(1, h*size/w)
+        } else {
+            tw, th = max(1, w*size/h), size
+        }
+    }
+
+    src := image.NewRGBA(image.Rect(0, 0, w, h))
+    draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+    dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+
+    for y := 0; y < th; y++ {
+        y0 := y * h / th
+        y1 := max((y+1)*h/th, y0+1)
+        for x := 0; x < tw; x++ {
+            x0 := x * w / tw
+            x1 := max((x+1)*w/tw, x0+1)
+
+            var sum [4]int
+            n := 0
+            for sy := y0; sy < y1; sy++ {
+                i := src.PixOffset(x0, sy)
+                for sx := x0; sx < x1; sx++ {
+                    for c := 0; c < 4; c++ {
+                        sum[c] += int(src.Pix[i+c])
+                    }
+                    i += 4
+                    n++
+                }
+            }
+
+            j := dst.PixOffset(x, y)
+            for c := 0; c < 4; c++ {
+                dst.Pix[j+c] = uint8(sum[c] / n)
+            }
+        }
+    }
+
+    return dst
+}
@@ -0,0 +1,154 @@
+package imaging
+
+import (
+    "bytes"
+    "image"
+    "image/color"
+    "testing"
+)
+
+func TestThumbnailSize(t *testing.T) {
+    tests := []struct {
+        name         string
+        width        int
+        height       int
+        wantW, wantH int
+    }{
+        {"landscape", 1000, 500, 320, 160},
+        {"portrait", 600, 1200, 160, 320},
+        {"square", 640, 640, 320, 320},
+        {"already small", 200, 100, 200, 100},
+        {"very thin", 5000, 4, 320, 1},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            // Bounds that do not start at the origin must work too
+            img := image.NewRGBA(image.Rect(10, 10, 10+tt.width, 10+tt.height))
+            got := Thumbnail(img, 320).Bounds()
+            if got.Min != (image.Point{}) || got.Dx() != tt.wantW || got.Dy() != tt.wantH {
+                t.Errorf("got %v, want %dx%d from the origin", got, tt.wantW, tt.wantH)
+            }
+        })
+    }
+}
+
+func TestThumbnailAverages(t *testing.T) {
+    // A 4x2 image whose left half is a black and white checkerboard and whose
+    // right half is red, scaled to 2x1
+    img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+    white := color.RGBA{255, 255, 255, 255}
+    black := color.RGBA{0, 0, 0, 255}
+    red := color.RGBA{200, 0, 0, 255}
+    img.Set(0, 0, white)
+    img.Set(1, 0, black)
+    img.Set(0, 1, black)
+    img.Set(1, 1, white)
+    for y := 0; y < 2; y++ {
+        for x := 2; x < 4; x++ {
+            img.Set(x, y, red)
+        }
+    }
+
+    thumb := Thumbnail(img, 2)
+    if got, want := thumb.RGBAAt(0, 0), (color.RGBA{127, 127, 127, 255}); got != want {
+        t.Errorf("left pixel = %v, want %v", got, want)
+    }
+    if got := thumb.RGBAAt(1, 0); got != red {
+        t.Errorf("right pixel = %v, want %v", got, red)
+    }
+}
+
+func TestDecode(t *testing.T) {
+    var png bytes.Buffer
+    if err := Encode(&png, image.NewRGBA(image.Rect(0, 0, 100, 50)), PNG); err != nil {
+        t.Fatal(err)
+    }
+
+    img, format, err := Decode(png.Bytes(), 5000)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if format != PNG || img.Bounds().Dx() != 100 || img.Bounds().Dy() != 50 {
+        t.Errorf("got %s %v", format, img.Bounds())
+    }
+
+    if _, _, err := Decode(png.Bytes(), 4999); err == nil {
+        t.Error("an image over the pixel limit was accepted")
+    }
+    if _, _, err := Decode([]byte("GIF89a not really"), 5000); err == nil {
+        t.Error("data that is not an image was accepted")
+    }
+}
+
+// exifJPEG encodes img as a JPEG carrying an EXIF orientation tag.
+func exifJPEG(t *testing.T, img image.Image, orientation uint16) []byte {
+    t.Helper()
+    var buf bytes.Buffer
+    if err := Encode(&buf, img, JPEG); err != nil {
+        t.Fatal(err)
+    }
+
+    // A big-endian TIFF header and one IFD entry: orientation, SHORT, count 1
+    tiff := []byte{'M', 'M', 0, 42, 0, 0, 0, 8, 0, 1,
+        0x01, 0x12, 0, 3, 0, 0, 0, 1, byte(orientation >> 8), byte(orientation), 0, 0,
+        0, 0, 0, 0}
+    payload := append([]byte("Exif\x00\x00"), tiff...)
+    n := len(payload) + 2
+    app1 := append([]byte{0xFF, 0xE1, byte(n >> 8), byte(n)}, payload...)
+
+    data := buf.Bytes()
+    return append(append(append([]byte{}, data[:2]...), app1...), data[2:]...)
+}
+
+func TestDecodeOrientation(t *testing.T) {
+    // 16x8 with a red left half and a blue right half
+    img := image.NewRGBA(image.Rect(0, 0, 16, 8))
+    for y := 0; y < 8; y++ {
+        for x := 0; x < 16; x++ {
+            if x < 8 {
+                img.Set(x, y, color.RGBA{255, 0, 0, 255})
+            } else {
+                img.Set(x, y, color.RGBA{0, 0, 255, 255})
+            }
+        }
+    }
+
+    tests := []struct {
+        orientation uint16
+        w, h        int
+        // redAt is a pixel well inside the red half once upright
+        redAt image.Point
+    }{
+        {1, 16, 8, image.Point{2, 4}},
+        {3, 16, 8, image.Point{13, 4}},
+        // Turned a quarter left, so the red half ends up on top
+        {6, 8, 16, image.Point{4, 2}},
+        {8, 8, 16, image.Point{4, 13}},
+    }
+
+    for _, tt := range tests {
+        data := exifJPEG(t, img, tt.orientation)
+        got, format, err := Decode(data, 5000)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if format != JPEG || got.Bounds().Dx() != tt.w || got.Bounds().Dy() != tt.h {
+            t.Errorf("orientation %d: got %s %v, want %dx%d", tt.orientation, format, got.Bounds(), tt.w, tt.h)
+            continue
+        }
+        r, _, b, _ := got.At(tt.redAt.X, tt.redAt.Y).RGBA()
+        if r < 0xC000 || b > 0x4000 {
+            t.Errorf("orientation %d: pixel %v is not red", tt.orientation, tt.redAt)
+        }
+
+        // Encoding again drops the EXIF data
+        var out bytes.Buffer
+        if err := Encode(&out, got, format); err != nil {
+            t.Fatal(err)
+        }
+        if bytes.Contains(out.Bytes(), []byte("Exif")) {
+            t.Errorf("orientation %d: EXIF data survived encoding", tt.orientation)
+        }
+    }
+}
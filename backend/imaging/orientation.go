@@ -0,0 +1,120 @@
+package imaging
+
+import (
+    "bytes"
+    "encoding/binary"
+    "image"
+    "image/draw"
+)
+
+// exifOrientation is the EXIF tag telling how a camera image must be turned
+// to display upright.
+const exifOrientation = 0x0112
+
+// jpegOrientation returns the EXIF orientation (1 to 8) of a JPEG, or 1 when
+// it has none or the EXIF data cannot be read.
+func jpegOrientation(data []byte) int {
+    if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+        return 1
+    }
+    for i := 2; i+4 <= len(data); {
+        if data[i] != 0xFF {
+            return 1
+        }
+        marker := data[i+1]
+        // Image data starts at SOS; EXIF comes before it
+        if marker == 0xDA || marker == 0xD9 {
+            return 1
+        }
+        length := int(binary.BigEndian.Uint16(data[i+2:]))
+        if length < 2 || i+2+length > len(data) {
+            return 1
+        }
+        segment := data[i+4 : i+2+length]
+        if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+            return tiffOrientation(segment[6:])
+        }
+        i += 2 + length
+    }
+    return 1
+}
+
+// tiffOrientation reads the orientation tag from the first IFD of EXIF data.
+func tiffOrientation(tiff []byte) int {
+    if len(tiff) < 8 {
+        return 1
+    }
+    var order binary.ByteOrder
+    switch string(tiff[:2]) {
+    case "II":
+        order = binary.LittleEndian
+    case "MM":
+        order = binary.BigEndian
+    default:
+        return 1
+    }
+
+    ifd := int(order.Uint32(tiff[4:]))
+    if ifd < 8 || ifd+2 > len(tiff) {
+        return 1
+    }
+    count := int(order.Uint16(tiff[ifd:]))
+    for n := 0; n < count; n++ {
+        entry := ifd + 2 + n*12
+        if entry+12 > len(tiff) {
+            return 1
+        }
+        if order.Uint16(tiff[entry:]) == exifOrientation {
+            if v := int(order.Uint16(tiff[entry+8:])); v >= 1 && v <= 8 {
+                return v
+            }
+            return 1
+        }
+    }
+    return 1
+}
+
+// orient turns img upright for the given EXIF orientation. Orientations 5 to
+// 8 swap the width and height.
+func orient(img image.Image, orientation int) image.Image {
+    if orientation < 2 || orientation > 8 {
+        return img
+    }
+
+    bounds := img.Bounds()
+    w, h := bounds.Dx(), bounds.Dy()
+    src := image.NewRGBA(image.Rect(0, 0, w, h))
+    draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+    dw, dh := w, h
+    if orientation >= 5 {
+        dw, dh = h, w
+    }
+    dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+    for y := 0; y < dh; y++ {
+        for x := 0; x < dw; x++ {
+            var sx, sy int
+            switch orientation {
+            case 2: // mirrored
+                sx, sy = w-1-x, y
+            case 3: // upside down
+                sx, sy = w-1-x, h-1-y
+            case 4: // upside down and mirrored
+                sx, sy = x, h-1-y
+            case 5: // mirrored and turned a quarter left
+                sx, sy = y, x
+            case 6: // turned a quarter left
+                sx, sy = y, h-1-x
+            case 7: // mirrored and turned a quarter right
+                sx, sy = w-1-y, h-1-x
+            case 8: // turned a quarter right
+                sx, sy = w-1-y, x
+            }
+            i, j := src.PixOffset(sx, sy), dst.PixOffset(x, y)
+            copy(dst.Pix[j:j+4], src.Pix[i:i+4])
+        }
+    }
+
+    return dst
+}
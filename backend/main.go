@@ -1,10 +1,15 @@
 package main
 
 import (
+    "encoding/json"
     "log"
+    "os"
     "backend/config"
     "backend/controllers"
     "backend/database"
+    "backend/middleware"
+    "backend/services"
+    "backend/blobstore"
     
     "github.com/gin-contrib/cors"
     "github.com/gin-gonic/gin"
@@ -19,6 +24,48 @@ func main() {
         log.Fatal("Failed to initialize database:", err)
     }
     
+    // Apply pending schema migrations
+    if err := database.Migrate(); err != nil {
+        log.Fatal("Failed to migrate database:", err)
+    }
+    
+    // Register custom request validation rules
+    if err := controllers.RegisterValidators(); err != nil {
+        log.Fatal("Failed to register validators:", err)
+    }
+    
+    // Create the first admin account on a fresh database
+    authService := services.NewAuthService(cfg)
+    if err := authService.EnsureAdmin(cfg.AdminUsername, cfg.AdminPassword); err != nil {
+        log.Fatal("Failed to create bootstrap admin:", err)
+    }
+    
+    invoiceChain, err := services.NewInvoiceChain(cfg)
+    if err != nil {
+        log.Fatal("Failed to configure invoice chain:", err)
+    }
+    
+    // "backend verify-chain" checks the invoice chain and exits without
+    // changing it; "backend chain-backfill" chains invoices issued before the
+    // chain existed, once
+    if len(os.Args) > 1 && os.Args[1] == "verify-chain" {
+        verifyChain(invoiceChain)
+        return
+    }
+    if len(os.Args) > 1 && os.Args[1] == "chain-backfill" {
+        n, err := invoiceChain.Backfill()
+        if err != nil {
+            log.Fatal("Failed to chain existing invoices:", err)
+        }
+        log.Printf("Added %d existing invoices to the hash chain", n)
+        return
+    }
+    
+    // Flag low stock once a day, or as often as STOCK_CHECK_INTERVAL says
+    events := services.NewEventBroker()
+    stockAlerts := services.NewStockAlertService(events)
+    go stockAlerts.Run(cfg.StockCheckInterval)
+    
     // Initialize Gin router
     router := gin.Default()
     
@@ -26,57 +73,231 @@ func main() {
     router.Use(cors.New(cors.Config{
         AllowOrigins:     []string{"http://localhost:3000"},
         AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-        AllowHeaders:     []string{"*"},
+        AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
         AllowCredentials: true,
     }))
     
+    // Item images live on local disk; any blobstore.Store can replace it
+    images := blobstore.NewDisk(cfg.ImageDir)
+    
     // Initialize controllers
-    itemController := controllers.NewItemController()
-    invoiceController := controllers.NewInvoiceController()
+    itemController := controllers.NewItemController(images)
+    invoiceController := controllers.NewInvoiceController(invoiceChain)
     categoryController := controllers.NewCategoryController()
     customerController := controllers.NewCustomerController()
+    reportController := controllers.NewReportController()
+    authController := controllers.NewAuthController(authService)
+    userController := controllers.NewUserController()
+    settingsController := controllers.NewSettingsController()
+    approvalController := controllers.NewApprovalController()
+    drawerController := controllers.NewDrawerController()
+    auditController := controllers.NewAuditController()
+    priceRuleController := controllers.NewPriceRuleController()
+    inventoryController := controllers.NewInventoryController(stockAlerts)
+    eventController := controllers.NewEventController(events)
+    supplierController := controllers.NewSupplierController()
+    purchaseOrderController := controllers.NewPurchaseOrderController()
+    stockTakeController := controllers.NewStockTakeController()
+    imageController := controllers.NewImageController(images)
     
     // Setup routes
-    api := router.Group("/api/v1")
+    v1 := router.Group("/api/v1")
+    
+    // Public auth routes
+    v1.POST("/auth/login", authController.Login)
+    v1.POST("/auth/refresh", authController.Refresh)
+    
+    // Public menu for customers
+    v1.GET("/menu", categoryController.GetMenu)
+    v1.GET("/images/*key", imageController.GetImage)
+    
+    // Everything else requires a valid access token
+    api := v1.Group("", middleware.AuthRequired(authService))
+    
+    // Session routes
+    auth := api.Group("/auth")
+    {
+        auth.POST("/logout", authController.Logout)
+        auth.GET("/me", authController.Me)
+        auth.PUT("/password", authController.ChangePassword)
+        auth.PUT("/pin", authController.SetPin)
+    }
+    
+    // Each route is guarded by the permission it needs; see services/permissions.go
+    can := middleware.RequirePermission
     
     // Item routes
     items := api.Group("/items")
     {
-        items.GET("", itemController.GetItems)
-        items.POST("", itemController.CreateItem)
-        items.PUT("/:id", itemController.UpdateItem)
-        items.DELETE("/:id", itemController.DeleteItem)
+        items.GET("", can(services.PermViewMenu), itemController.GetItems)
+        items.GET("/lookup", can(services.PermViewMenu), itemController.LookupItem)
+        items.POST("", can(services.PermManageMenu), itemController.CreateItem)
+        items.POST("/import", can(services.PermImportData), itemController.ImportItems)
+        items.PUT("/:id", can(services.PermManageMenu), itemController.UpdateItem)
+        items.DELETE("/:id", can(services.PermDeleteMenu), itemController.DeleteItem)
+        items.POST("/:id/archive", can(services.PermDeleteMenu), itemController.ArchiveItem)
+        items.POST("/:id/restore", can(services.PermDeleteMenu), itemController.RestoreItem)
+        items.PUT("/:id/availability", can(services.PermSetAvailability), itemController.SetAvailability)
+        items.POST("/:id/image", can(services.PermManageMenu), itemController.UploadImage)
+        items.DELETE("/:id/image", can(services.PermManageMenu), itemController.DeleteImage)
+        items.GET("/:id/prices", can(services.PermViewMenu), itemController.GetPriceHistory)
+        items.POST("/:id/prices", can(services.PermManageMenu), itemController.SchedulePrice)
+        items.DELETE("/:id/prices/:priceId", can(services.PermManageMenu), itemController.CancelScheduledPrice)
+        items.GET("/:id/bundle", can(services.PermViewMenu), itemController.GetBundle)
+        items.PUT("/:id/bundle", can(services.PermManageMenu), itemController.SetBundle)
+        items.GET("/:id/recipe", can(services.PermViewInventory), inventoryController.GetRecipe)
+        items.PUT("/:id/recipe", can(services.PermManageInventory), inventoryController.SetRecipe)
+        items.POST("/:id/wastage", can(services.PermRecordWastage), inventoryController.RecordItemWastage)
     }
     
     // Category routes
     categories := api.Group("/categories")
     {
-        categories.GET("", categoryController.GetCategories)
-        categories.POST("", categoryController.CreateCategory)
-        categories.PUT("/:id", categoryController.UpdateCategory)
-        categories.DELETE("/:id", categoryController.DeleteCategory)
-        categories.GET("/:id", categoryController.GetCategory)
+        categories.GET("", can(services.PermViewMenu), categoryController.GetCategories)
+        categories.GET("/tree", can(services.PermViewMenu), categoryController.GetMenuTree)
+        categories.POST("", can(services.PermManageMenu), categoryController.CreateCategory)
+        categories.PUT("/:id", can(services.PermManageMenu), categoryController.UpdateCategory)
+        categories.DELETE("/:id", can(services.PermDeleteMenu), categoryController.DeleteCategory)
+        categories.POST("/:id/archive", can(services.PermDeleteMenu), categoryController.ArchiveCategory)
+        categories.POST("/:id/restore", can(services.PermDeleteMenu), categoryController.RestoreCategory)
+        categories.GET("/:id", can(services.PermViewMenu), categoryController.GetCategory)
     }
     
+    // Time-window price rules such as happy hour
+    priceRules := api.Group("/price-rules")
+    {
+        priceRules.GET("", can(services.PermViewMenu), priceRuleController.GetPriceRules)
+        priceRules.POST("", can(services.PermManageMenu), priceRuleController.CreatePriceRule)
+        priceRules.PUT("/:id", can(services.PermManageMenu), priceRuleController.UpdatePriceRule)
+        priceRules.DELETE("/:id", can(services.PermManageMenu), priceRuleController.DeletePriceRule)
+    }
+    
+    // Ingredient stock; sales deduct it through item recipes
+    ingredients := api.Group("/ingredients")
+    {
+        ingredients.GET("", can(services.PermViewInventory), inventoryController.GetIngredients)
+        ingredients.GET("/:id", can(services.PermViewInventory), inventoryController.GetIngredient)
+        ingredients.POST("", can(services.PermManageInventory), inventoryController.CreateIngredient)
+        ingredients.PUT("/:id", can(services.PermManageInventory), inventoryController.UpdateIngredient)
+        ingredients.DELETE("/:id", can(services.PermManageInventory), inventoryController.DeleteIngredient)
+        ingredients.POST("/:id/adjustments", can(services.PermManageInventory), inventoryController.AdjustStock)
+        ingredients.POST("/:id/wastage", can(services.PermRecordWastage), inventoryController.RecordIngredientWastage)
+    }
+    
+    api.GET("/stock-movements", can(services.PermViewInventory), inventoryController.GetMovements)
+    api.GET("/inventory/alerts", can(services.PermViewInventory), inventoryController.GetAlerts)
+    api.POST("/inventory/alerts/check", can(services.PermManageInventory), inventoryController.CheckAlerts)
+    
+    suppliers := api.Group("/suppliers")
+    {
+        suppliers.GET("", can(services.PermViewInventory), supplierController.GetSuppliers)
+        suppliers.GET("/:id", can(services.PermViewInventory), supplierController.GetSupplier)
+        suppliers.POST("", can(services.PermManageInventory), supplierController.CreateSupplier)
+        suppliers.PUT("/:id", can(services.PermManageInventory), supplierController.UpdateSupplier)
+        suppliers.DELETE("/:id", can(services.PermManageInventory), supplierController.DeleteSupplier)
+    }
+    
+    // Purchase orders: draft -> sent -> partially_received -> received
+    purchaseOrders := api.Group("/purchase-orders")
+    {
+        purchaseOrders.GET("", can(services.PermViewInventory), purchaseOrderController.GetPurchaseOrders)
+        purchaseOrders.GET("/:id", can(services.PermViewInventory), purchaseOrderController.GetPurchaseOrder)
+        purchaseOrders.GET("/:id/document", can(services.PermViewInventory), purchaseOrderController.GetDocument)
+        purchaseOrders.POST("", can(services.PermManageInventory), purchaseOrderController.CreatePurchaseOrder)
+        purchaseOrders.PUT("/:id", can(services.PermManageInventory), purchaseOrderController.UpdatePurchaseOrder)
+        purchaseOrders.DELETE("/:id", can(services.PermManageInventory), purchaseOrderController.DeletePurchaseOrder)
+        purchaseOrders.POST("/:id/send", can(services.PermManageInventory), purchaseOrderController.SendPurchaseOrder)
+        purchaseOrders.POST("/:id/cancel", can(services.PermManageInventory), purchaseOrderController.CancelPurchaseOrder)
+        purchaseOrders.POST("/:id/receive", can(services.PermManageInventory), purchaseOrderController.ReceivePurchaseOrder)
+    }
+    
+    // Stock counts: open, record counts, then post the variances to stock
+    stockTakes := api.Group("/stock-takes")
+    {
+        stockTakes.GET("", can(services.PermViewInventory), stockTakeController.GetStockTakes)
+        stockTakes.GET("/:id", can(services.PermViewInventory), stockTakeController.GetStockTake)
+        stockTakes.POST("", can(services.PermManageInventory), stockTakeController.CreateStockTake)
+        stockTakes.PUT("/:id/counts", can(services.PermManageInventory), stockTakeController.RecordCounts)
+        stockTakes.POST("/:id/post", can(services.PermManageInventory), stockTakeController.PostStockTake)
+        stockTakes.DELETE("/:id", can(services.PermManageInventory), stockTakeController.DeleteStockTake)
+    }
+    
+    // Server-sent events; each user only receives events their role may see
+    api.GET("/events", eventController.Stream)
+    
     // Invoice routes
     invoices := api.Group("/invoices")
     {
-        invoices.GET("", invoiceController.GetInvoices)
-        invoices.POST("", invoiceController.CreateInvoice)
-        invoices.GET("/:id", invoiceController.GetInvoice)
+        invoices.GET("", can(services.PermViewInvoices), invoiceController.GetInvoices)
+        invoices.POST("", can(services.PermCreateInvoices), invoiceController.CreateInvoice)
+        invoices.GET("/:id", can(services.PermViewInvoices), invoiceController.GetInvoice)
+        // Cashiers can void with a manager's approval token, so the service makes the final check
+        invoices.POST("/:id/void", can(services.PermCreateInvoices), invoiceController.VoidInvoice)
     }
     
     // Customer routes
     customers := api.Group("/customers")
     {
-        customers.GET("", customerController.GetCustomers)
-        customers.POST("", customerController.CreateCustomer)
-        customers.PUT("/:id", customerController.UpdateCustomer)
-        customers.DELETE("/:id", customerController.DeleteCustomer)
-        customers.GET("/:id", customerController.GetCustomer)
+        customers.GET("", can(services.PermViewCustomers), customerController.GetCustomers)
+        customers.POST("", can(services.PermCreateCustomers), customerController.CreateCustomer)
+        customers.POST("/import", can(services.PermImportData), customerController.ImportCustomers)
+        customers.PUT("/:id", can(services.PermManageCustomers), customerController.UpdateCustomer)
+        customers.DELETE("/:id", can(services.PermManageCustomers), customerController.DeleteCustomer)
+        customers.POST("/:id/archive", can(services.PermManageCustomers), customerController.ArchiveCustomer)
+        customers.POST("/:id/restore", can(services.PermManageCustomers), customerController.RestoreCustomer)
+        customers.GET("/:id", can(services.PermViewCustomers), customerController.GetCustomer)
+    }
+    
+    // Report routes
+    reports := api.Group("/reports", can(services.PermViewReports))
+    {
+        reports.GET("/tax", reportController.GetTaxReport)
+        reports.GET("/stock-variance", reportController.GetStockVarianceReport)
+        reports.GET("/margin", reportController.GetMarginReport)
+    }
+    
+    // Manager approvals for actions the signed-in user cannot perform alone
+    api.POST("/approvals", can(services.PermCreateInvoices), approvalController.CreateApproval)
+    
+    // Cash drawer openings without a sale
+    api.POST("/drawer/no-sale", can(services.PermCreateInvoices), drawerController.OpenDrawer)
+    api.GET("/drawer/no-sales", can(services.PermViewReports), drawerController.GetNoSales)
+    
+    // User administration routes
+    users := api.Group("/users", can(services.PermManageUsers))
+    {
+        users.GET("", userController.GetUsers)
+        users.POST("", userController.CreateUser)
+        users.PUT("/:id", userController.UpdateUser)
+    }
+    
+    // Audit trail
+    api.GET("/audit", can(services.PermViewAudit), auditController.GetAudit)
+    api.GET("/invoice-chain/verify", can(services.PermViewAudit), invoiceController.VerifyChain)
+    
+    // Settings routes
+    settings := api.Group("/settings", can(services.PermManageSettings))
+    {
+        settings.GET("", settingsController.GetSettings)
+        settings.PUT("/:key", settingsController.UpdateSetting)
     }
     
     // Start server
     log.Printf("Server starting on port %s", cfg.ServerPort)
     log.Fatal(router.Run(":" + cfg.ServerPort))
-}
\ No newline at end of file
+}
+
+// verifyChain prints the chain verification result and exits non-zero if the
+// chain is broken.
+func verifyChain(chain *services.InvoiceChain) {
+    result, err := chain.Verify()
+    if err != nil {
+        log.Fatal("Failed to verify invoice chain:", err)
+    }
+    
+    out, _ := json.MarshalIndent(result, "", "  ")
+    os.Stdout.Write(append(out, '\n'))
+    if !result.Valid {
+        os.Exit(1)
+    }
+}
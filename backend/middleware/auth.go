@@ -0,0 +1,77 @@
+package middleware
+
+import (
+    "log"
+    "net/http"
+    "strings"
+    "backend/models"
+    "backend/services"
+
+    "github.com/gin-gonic/gin"
+)
+
+const (
+    userKey   = "auth.user"
+    claimsKey = "auth.claims"
+)
+
+// AuthRequired rejects requests without a valid "Authorization: Bearer" access
+// token and stores the authenticated user on the context.
+func AuthRequired(authService *services.AuthService) gin.HandlerFunc {
+    return func(ctx *gin.Context) {
+        header := ctx.GetHeader("Authorization")
+        token, found := strings.CutPrefix(header, "Bearer ")
+        if !found || token == "" {
+            abortUnauthorized(ctx, "authentication required")
+            return
+        }
+
+        user, claims, err := authService.Authenticate(token)
+        if err != nil {
+            if appErr, ok := err.(*services.AppError); ok {
+                abortUnauthorized(ctx, appErr.Message)
+                return
+            }
+            log.Printf("authenticate: %v", err)
+            ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal server error", "code": "internal_error"})
+            return
+        }
+
+        ctx.Set(userKey, user)
+        ctx.Set(claimsKey, claims)
+        ctx.Next()
+    }
+}
+
+// CurrentUser returns the user authenticated by AuthRequired, or nil.
+func CurrentUser(ctx *gin.Context) *models.User {
+    if v, ok := ctx.Get(userKey); ok {
+        return v.(*models.User)
+    }
+    return nil
+}
+
+// CurrentClaims returns the access token claims stored by AuthRequired, or nil.
+func CurrentClaims(ctx *gin.Context) *services.AccessClaims {
+    if v, ok := ctx.Get(claimsKey); ok {
+        return v.(*services.AccessClaims)
+    }
+    return nil
+}
+
+func abortUnauthorized(ctx *gin.Context, message string) {
+    ctx.Header("WWW-Authenticate", `Bearer realm="api"`)
+    ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": message, "code": services.CodeUnauthorized})
+}
+
+// RequirePermission rejects the request with 403 unless the authenticated
+// user's role grants perm. It must run after AuthRequired.
+func RequirePermission(perm services.Permission) gin.HandlerFunc {
+    return func(ctx *gin.Context) {
+        if err := services.RequirePermission(CurrentUser(ctx), perm); err != nil {
+            ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": services.CodeForbidden})
+            return
+        }
+        ctx.Next()
+    }
+}
@@ -1,60 +1,661 @@
 package models
 
-import "time"
+import (
+    "encoding/json"
+    "time"
+)
 
 type Category struct {
-    CategoryID   int       `json:"category_id"`
-    CategoryName string    `json:"category_name"`
-    Description  string    `json:"description"`
+    CategoryID       int    `json:"category_id"`
+    CategoryName     string `json:"category_name" binding:"required,notblank,max=100"`
+    Description      string `json:"description" binding:"max=500"`
+    ParentCategoryID *int   `json:"parent_category_id" binding:"omitempty,gt=0,category_exists"`
+    SortOrder        int    `json:"sort_order" binding:"gte=0,lte=100000"`
+    // IsActive defaults to true on create and is left unchanged by updates
+    // that omit it. Inactive categories and everything under them are hidden.
+    IsActive *bool `json:"is_active"`
+    // ArchivedAt is set through the archive endpoint, like ArchivedAt on items
+    ArchivedAt *time.Time `json:"archived_at,omitempty" binding:"-"`
+}
+
+// MenuCategory is a category in the menu tree, with its items and
+// subcategories in display order.
+type MenuCategory struct {
+    Category
+    Items         []Item         `json:"items"`
+    Subcategories []MenuCategory `json:"subcategories"`
 }
 
 type Item struct {
     ItemID      int     `json:"item_id"`
-    ItemName    string  `json:"item_name"`     
-    CategoryID  int     `json:"category_id"`     
-    BasePrice   float64 `json:"base_price"`    
-    Description string  `json:"description"`  
-    Category    *Category `json:"category,omitempty"`
+    ItemName    string  `json:"item_name" binding:"required,notblank,max=100"`
+    CategoryID  int     `json:"category_id" binding:"required,gt=0,category_exists"`
+    BasePrice   float64 `json:"base_price" binding:"gte=0,lte=100000"`
+    Description string  `json:"description" binding:"max=500"`
+    SortOrder   int     `json:"sort_order" binding:"gte=0,lte=100000"`
+    Category    *Category `json:"category,omitempty" binding:"-"`
+    // Menu details for customers. Vegan items are always vegetarian; spicy
+    // level runs from 0 (mild) to 3 (hot).
+    Allergens  []string `json:"allergens" binding:"max=14,unique,dive,oneof=gluten dairy eggs nuts peanuts soy sesame fish shellfish molluscs celery mustard lupin sulphites"`
+    Vegetarian bool     `json:"vegetarian"`
+    Vegan      bool     `json:"vegan"`
+    SpicyLevel int      `json:"spicy_level" binding:"gte=0,lte=3"`
+    Calories   *int     `json:"calories" binding:"omitempty,gte=0,lte=10000"`
+    // Images are uploaded through their own endpoint
+    ImageURL     string `json:"image_url,omitempty" binding:"-"`
+    ThumbnailURL string `json:"thumbnail_url,omitempty" binding:"-"`
+    // Codes for quick entry at the till. Each is optional, and no two items
+    // may share a code, whichever kind it is.
+    SKU     string `json:"sku" binding:"omitempty,max=50"`
+    Barcode string `json:"barcode" binding:"omitempty,numeric,min=8,max=14"`
+    PLU     string `json:"plu" binding:"omitempty,numeric,max=5"`
+    // Availability is set through its own endpoint, not by create or update
+    Availability string     `json:"availability" binding:"-"`
+    SoldOutUntil *time.Time `json:"sold_out_until,omitempty" binding:"-"`
+    // ActivePrice is the price after any price rule active now, when one applies
+    ActivePrice       *float64 `json:"active_price,omitempty" binding:"-"`
+    ActivePriceRuleID *int     `json:"active_price_rule_id,omitempty" binding:"-"`
+    // FoodCost is the recipe priced at current ingredient costs; MarginPercent
+    // is the share of the base price left after it. Both are unset when the
+    // item has no fully costed recipe.
+    FoodCost      *float64 `json:"food_cost,omitempty" binding:"-"`
+    MarginPercent *float64 `json:"margin_percent,omitempty" binding:"-"`
+    // IsBundle is set for items sold with a choice of components, see BundleSlot
+    IsBundle bool `json:"is_bundle" binding:"-"`
+    // ArchivedAt is set when the item is archived rather than deleted. Archived
+    // items stay on past invoices but are left out of lists and cannot be sold.
+    ArchivedAt *time.Time `json:"archived_at,omitempty" binding:"-"`
 }
 
 type Customer struct {
     CustomerID   int    `json:"customer_id"`
-    CustomerName string `json:"customer_name"`
-    Phone        string `json:"phone"`
-    Email        string `json:"email"`
-    Address      string `json:"address"`
+    CustomerName string `json:"customer_name" binding:"required,notblank,max=100"`
+    Phone        string `json:"phone" binding:"omitempty,phone"`
+    Email        string `json:"email" binding:"omitempty,email,max=100"`
+    Address      string `json:"address" binding:"max=255"`
+    // ArchivedAt is set when the customer is archived; archived customers
+    // cannot be invoiced
+    ArchivedAt *time.Time `json:"archived_at,omitempty" binding:"-"`
 }
 
 type Invoice struct {
-    InvoiceID     int           `json:"invoice_id"`
-    InvoiceNumber string        `json:"invoice_number"`
-    CustomerID    int           `json:"customer_id"`
-    InvoiceDate   time.Time     `json:"invoice_date"`
-    SubTotal      float64       `json:"sub_total"`
-    TaxRate       float64       `json:"tax_rate"`
-    TaxAmount     float64       `json:"tax_amount"`
-    TotalAmount   float64       `json:"total_amount"`
-    Customer      *Customer     `json:"customer,omitempty"`
-    Items         []InvoiceItem `json:"items,omitempty"`
+    InvoiceID      int           `json:"invoice_id"`
+    InvoiceNumber  string        `json:"invoice_number"`
+    CustomerID     int           `json:"customer_id"`
+    InvoiceDate    time.Time     `json:"invoice_date"`
+    SubTotal       float64       `json:"sub_total"`
+    TaxRate        float64       `json:"tax_rate"`
+    TaxAmount      float64       `json:"tax_amount"`
+    TotalAmount    float64       `json:"total_amount"`
+    Status         string        `json:"status"`
+    VoidedAt       *time.Time    `json:"voided_at,omitempty"`
+    VoidedBy       *int          `json:"voided_by,omitempty"`
+    VoidReason     string        `json:"void_reason,omitempty"`
+    VoidApprovalID *int          `json:"void_approval_id,omitempty"`
+    Customer       *Customer     `json:"customer,omitempty"`
+    Items          []InvoiceItem `json:"items,omitempty"`
 }
 
 type InvoiceItem struct {
-    InvoiceItemID int     `json:"invoice_item_id"`
-    InvoiceID     int     `json:"invoice_id"`
-    ItemID        int     `json:"item_id"`
-    Quantity      int     `json:"quantity"`
-    UnitPrice     float64 `json:"unit_price"`
-    TotalPrice    float64 `json:"total_price"`
-    Item          *Item   `json:"item,omitempty"`
+    InvoiceItemID   int     `json:"invoice_item_id"`
+    InvoiceID       int     `json:"invoice_id"`
+    ItemID          int     `json:"item_id"`
+    Quantity        int     `json:"quantity"`
+    UnitPrice       float64 `json:"unit_price"`
+    TotalPrice      float64 `json:"total_price"`
+    PriceApprovalID *int    `json:"price_approval_id,omitempty"`
+    PriceRuleID     *int    `json:"price_rule_id,omitempty"`
+    // Item is the item as sold: its name, description and category are
+    // copied onto the line at sale time, so later edits do not change it.
+    Item *Item `json:"item,omitempty"`
+    // Components are the items chosen for a bundle line. They are priced at
+    // zero; the bundle line carries the price.
+    ParentInvoiceItemID *int          `json:"parent_invoice_item_id,omitempty"`
+    SlotName            string        `json:"slot_name,omitempty"`
+    Components          []InvoiceItem `json:"components,omitempty"`
 }
 
 type CreateInvoiceRequest struct {
-    CustomerID int                    `json:"customer_id"`
-    TaxRate    float64                `json:"tax_rate"`
-    Items      []CreateInvoiceItemRequest `json:"items"`
+    CustomerID int                    `json:"customer_id" binding:"required,gt=0,customer_exists"`
+    TaxRate    float64                `json:"tax_rate" binding:"gte=0,lte=100"`
+    Items      []CreateInvoiceItemRequest `json:"items" binding:"required,min=1,max=200,dive"`
+    // ApprovalToken authorises price overrides the cashier cannot make alone,
+    // and DiscountApprovalToken discounts beyond discount_limit_percent
+    ApprovalToken         string `json:"approval_token"`
+    DiscountApprovalToken string `json:"discount_approval_token"`
 }
 
+// CreateInvoiceItemRequest names the item by ItemID or by Code, which is its
+// SKU, barcode or PLU as scanned or typed at the till.
 type CreateInvoiceItemRequest struct {
-    ItemID   int `json:"item_id"`
-    Quantity int `json:"quantity"`
-}
\ No newline at end of file
+    ItemID   int    `json:"item_id" binding:"omitempty,gt=0,item_exists"`
+    Code     string `json:"code" binding:"max=50"`
+    Quantity int `json:"quantity" binding:"required,gt=0,lte=1000"`
+    // UnitPrice overrides the item's base price when set
+    UnitPrice *float64 `json:"unit_price" binding:"omitempty,gte=0,lte=100000"`
+    // Choices fill the slots of a bundle, one entry per unit of each slot
+    Choices []BundleSelection `json:"choices" binding:"max=50,dive"`
+}
+
+type BundleSelection struct {
+    SlotID int `json:"slot_id" binding:"required,gt=0"`
+    ItemID int `json:"item_id" binding:"required,gt=0"`
+}
+
+type TaxReportLine struct {
+    Period       string  `json:"period"`
+    TaxRate      float64 `json:"tax_rate"`
+    InvoiceCount int     `json:"invoice_count"`
+    TaxableSales float64 `json:"taxable_sales"`
+    ExemptSales  float64 `json:"exempt_sales"`
+    TaxCollected float64 `json:"tax_collected"`
+}
+
+type TaxReportPeriod struct {
+    Period       string          `json:"period"`
+    InvoiceCount int             `json:"invoice_count"`
+    TaxableSales float64         `json:"taxable_sales"`
+    ExemptSales  float64         `json:"exempt_sales"`
+    TaxCollected float64         `json:"tax_collected"`
+    Components   []TaxReportLine `json:"components"`
+}
+
+type TaxReport struct {
+    From         time.Time         `json:"from"`
+    To           time.Time         `json:"to"`
+    GroupBy      string            `json:"group_by"`
+    Periods      []TaxReportPeriod `json:"periods"`
+    InvoiceCount int               `json:"invoice_count"`
+    TaxableSales float64           `json:"taxable_sales"`
+    ExemptSales  float64           `json:"exempt_sales"`
+    TaxCollected float64           `json:"tax_collected"`
+}
+
+type ImportRowResult struct {
+    Row    int      `json:"row"`
+    Action string   `json:"action"`
+    ID     int      `json:"id,omitempty"`
+    Name   string   `json:"name,omitempty"`
+    Errors []string `json:"errors,omitempty"`
+}
+
+type ImportReport struct {
+    DryRun            bool              `json:"dry_run"`
+    Applied           bool              `json:"applied"`
+    Created           int               `json:"created"`
+    Updated           int               `json:"updated"`
+    Failed            int               `json:"failed"`
+    CategoriesCreated []string          `json:"categories_created,omitempty"`
+    Rows              []ImportRowResult `json:"rows"`
+}
+
+// ListParams holds the paging, sorting and search options shared by list endpoints.
+// A zero Limit means no paging.
+type ListParams struct {
+    Limit  int
+    Offset int
+    Sort   string
+    Desc   bool
+    Search string
+}
+
+type ItemFilter struct {
+    ListParams
+    CategoryID   int
+    Availability string
+    // Code matches an item's SKU, barcode or PLU exactly
+    Code            string
+    IncludeArchived bool
+}
+
+type CustomerFilter struct {
+    ListParams
+    IncludeArchived bool
+}
+
+type InvoiceFilter struct {
+    ListParams
+    From       *time.Time
+    To         *time.Time
+    CustomerID int
+    Status     string
+    MinTotal   *float64
+    MaxTotal   *float64
+}
+
+type Pagination struct {
+    Total      int    `json:"total"`
+    Limit      int    `json:"limit"`
+    Offset     int    `json:"offset"`
+    NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type User struct {
+    UserID    int       `json:"user_id"`
+    Username  string    `json:"username"`
+    FullName  string    `json:"full_name"`
+    Role      string    `json:"role"`
+    IsActive  bool      `json:"is_active"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+type CreateUserRequest struct {
+    Username string `json:"username" binding:"required,notblank,max=50"`
+    Password string `json:"password" binding:"required,min=8,max=72"`
+    FullName string `json:"full_name" binding:"max=100"`
+    Role     string `json:"role" binding:"required,oneof=cashier manager admin"`
+}
+
+type UpdateUserRequest struct {
+    FullName string `json:"full_name" binding:"max=100"`
+    Role     string `json:"role" binding:"required,oneof=cashier manager admin"`
+    IsActive bool   `json:"is_active"`
+    Password string `json:"password" binding:"omitempty,min=8,max=72"`
+}
+
+type Setting struct {
+    Key       string    `json:"key"`
+    Value     string    `json:"value"`
+    UpdatedAt time.Time `json:"updated_at"`
+}
+
+type VoidInvoiceRequest struct {
+    Reason        string `json:"reason" binding:"required,notblank,max=255"`
+    ApprovalToken string `json:"approval_token"`
+}
+
+// ApprovalRequest asks a manager to authorise one action by entering their PIN
+// on the signed-in cashier's till.
+type ApprovalRequest struct {
+    Action    string `json:"action" binding:"required,oneof=invoice.void invoice.price_override invoice.large_discount drawer.open"`
+    Username  string `json:"username" binding:"required"`
+    Pin       string `json:"pin" binding:"required"`
+    InvoiceID *int   `json:"invoice_id" binding:"omitempty,gt=0"`
+}
+
+// NoSaleRequest opens the cash drawer without a sale. ApprovalToken is needed
+// when the signed-in user may not open the drawer alone.
+type NoSaleRequest struct {
+    Reason        string `json:"reason" binding:"required,notblank,max=255"`
+    ApprovalToken string `json:"approval_token"`
+}
+
+// NoSale records one opening of the cash drawer without a sale.
+type NoSale struct {
+    NoSaleID   int       `json:"no_sale_id"`
+    UserID     int       `json:"user_id"`
+    Username   string    `json:"username"`
+    ApprovalID *int      `json:"approval_id,omitempty"`
+    Reason     string    `json:"reason"`
+    OpenedAt   time.Time `json:"opened_at"`
+}
+
+type ApprovalResponse struct {
+    ApprovalID    int    `json:"approval_id"`
+    ApprovalToken string `json:"approval_token"`
+    Action        string `json:"action"`
+    ExpiresIn     int    `json:"expires_in"`
+    ApprovedBy    *User  `json:"approved_by"`
+}
+
+type SetPinRequest struct {
+    Password string `json:"password" binding:"required"`
+    Pin      string `json:"pin" binding:"required,numeric,min=4,max=8"`
+}
+
+type LoginRequest struct {
+    Username string `json:"username" binding:"required"`
+    Password string `json:"password" binding:"required"`
+}
+
+type RefreshRequest struct {
+    RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type TokenResponse struct {
+    AccessToken  string `json:"access_token"`
+    RefreshToken string `json:"refresh_token"`
+    TokenType    string `json:"token_type"`
+    ExpiresIn    int    `json:"expires_in"`
+    User         *User  `json:"user"`
+}
+
+type ChangePasswordRequest struct {
+    CurrentPassword string `json:"current_password" binding:"required"`
+    NewPassword     string `json:"new_password" binding:"required,min=8,max=72"`
+}
+
+// AuditEntry records one change to a record. Before is empty for creations
+// and After is empty for deletions.
+type AuditEntry struct {
+    AuditID    int64           `json:"audit_id"`
+    OccurredAt time.Time       `json:"occurred_at"`
+    UserID     *int            `json:"user_id"`
+    Username   string          `json:"username"`
+    EntityType string          `json:"entity_type"`
+    EntityID   int             `json:"entity_id"`
+    Action     string          `json:"action"`
+    Before     json.RawMessage `json:"before,omitempty"`
+    After      json.RawMessage `json:"after,omitempty"`
+}
+
+type AuditFilter struct {
+    ListParams
+    EntityType string
+    EntityID   *int
+    UserID     *int
+    Action     string
+    From       *time.Time
+    To         *time.Time
+}
+
+// ChainVerification is the result of walking the invoice hash chain.
+type ChainVerification struct {
+    Valid              bool        `json:"valid"`
+    Checked            int         `json:"checked"`
+    Signed             int         `json:"signed"`
+    SignaturesVerified int         `json:"signatures_verified"`
+    HeadHash           string      `json:"head_hash"`
+    FirstBroken        *ChainBreak `json:"first_broken,omitempty"`
+}
+
+type ChainBreak struct {
+    Sequence  int    `json:"sequence"`
+    InvoiceID int    `json:"invoice_id"`
+    Reason    string `json:"reason"`
+}
+
+// ItemPrice is the price of an item for a period. EffectiveTo is nil for the
+// latest scheduled price.
+type ItemPrice struct {
+    ItemPriceID   int        `json:"item_price_id"`
+    ItemID        int        `json:"item_id"`
+    Price         float64    `json:"price"`
+    EffectiveFrom time.Time  `json:"effective_from"`
+    EffectiveTo   *time.Time `json:"effective_to"`
+    CreatedBy     *int       `json:"created_by,omitempty"`
+    CreatedAt     time.Time  `json:"created_at"`
+}
+
+type SchedulePriceRequest struct {
+    Price         *float64   `json:"price" binding:"required,gte=0,lte=100000"`
+    EffectiveFrom *time.Time `json:"effective_from"`
+}
+
+// PriceRule adjusts the price of an item, or of every item in a category,
+// during a weekly time window. Days are 0 (Sunday) to 6 (Saturday) and times
+// are HH:MM in the shop's local time; a window ending before it starts runs
+// past midnight. Exactly one of ItemID and CategoryID, and exactly one of
+// DiscountPercent and FixedPrice, must be set.
+type PriceRule struct {
+    PriceRuleID     int      `json:"price_rule_id"`
+    Name            string   `json:"name" binding:"required,notblank,max=100"`
+    Days            []int    `json:"days" binding:"required,min=1,max=7,unique,dive,gte=0,lte=6"`
+    StartTime       string   `json:"start_time" binding:"required,datetime=15:04"`
+    EndTime         string   `json:"end_time" binding:"required,datetime=15:04"`
+    ItemID          *int     `json:"item_id,omitempty" binding:"omitempty,gt=0,item_exists"`
+    CategoryID      *int     `json:"category_id,omitempty" binding:"omitempty,gt=0,category_exists"`
+    DiscountPercent *float64 `json:"discount_percent,omitempty" binding:"omitempty,gt=0,lte=100"`
+    FixedPrice      *float64 `json:"fixed_price,omitempty" binding:"omitempty,gte=0,lte=100000"`
+    IsActive        *bool    `json:"is_active"`
+}
+
+type SetAvailabilityRequest struct {
+    Status string     `json:"status" binding:"required,oneof=available sold_out hidden"`
+    Until  *time.Time `json:"until"`
+}
+
+// Ingredient is a stock item used in recipes. OnHand only changes through
+// stock movements.
+type Ingredient struct {
+    IngredientID int      `json:"ingredient_id"`
+    Name         string   `json:"name" binding:"required,notblank,max=100"`
+    Unit         string   `json:"unit" binding:"required,notblank,max=20"`
+    OnHand       float64  `json:"on_hand" binding:"-"`
+    // ReorderPoint raises a low-stock alert when OnHand falls to it
+    ReorderPoint *float64 `json:"reorder_point" binding:"omitempty,gte=0,lte=100000"`
+    // UnitCost is updated whenever goods are received against a purchase order
+    UnitCost     *float64 `json:"unit_cost" binding:"omitempty,gte=0,lte=100000"`
+}
+
+// RecipeLine is the quantity of an ingredient used to make one of an item.
+type RecipeLine struct {
+    IngredientID   int     `json:"ingredient_id" binding:"required,gt=0,ingredient_exists"`
+    Quantity       float64 `json:"quantity" binding:"required,gt=0,lte=100000"`
+    IngredientName string  `json:"ingredient_name" binding:"-"`
+    Unit           string  `json:"unit" binding:"-"`
+}
+
+type SetRecipeRequest struct {
+    Lines []RecipeLine `json:"lines" binding:"max=50,unique=IngredientID,dive"`
+}
+
+// BundleSlot is one part of a bundle, such as "2 large pizzas", filled with
+// Quantity items from Choices. A choice's surcharge is added to the bundle
+// price for each unit chosen.
+type BundleSlot struct {
+    SlotID   int            `json:"slot_id" binding:"-"`
+    Name     string         `json:"name" binding:"required,notblank,max=100"`
+    Quantity int            `json:"quantity" binding:"required,gt=0,lte=20"`
+    Choices  []BundleChoice `json:"choices" binding:"required,min=1,max=50,unique=ItemID,dive"`
+}
+
+type BundleChoice struct {
+    ItemID    int     `json:"item_id" binding:"required,gt=0,item_exists"`
+    Surcharge float64 `json:"surcharge" binding:"gte=0,lte=100000"`
+    ItemName  string  `json:"item_name" binding:"-"`
+}
+
+type SetBundleRequest struct {
+    Slots []BundleSlot `json:"slots" binding:"max=20,dive"`
+}
+
+// StockMovement is one change to an ingredient's on-hand quantity. Quantity is
+// negative when stock was used and positive when it came back.
+type StockMovement struct {
+    MovementID      int64     `json:"movement_id"`
+    IngredientID    int       `json:"ingredient_id"`
+    IngredientName  string    `json:"ingredient_name"`
+    Unit            string    `json:"unit"`
+    Quantity        float64   `json:"quantity"`
+    Reason          string    `json:"reason"`
+    InvoiceID       *int      `json:"invoice_id,omitempty"`
+    PurchaseOrderID *int      `json:"purchase_order_id,omitempty"`
+    UnitCost        *float64  `json:"unit_cost,omitempty"`
+    UserID          *int      `json:"user_id,omitempty"`
+    Note            string    `json:"note"`
+    OccurredAt      time.Time `json:"occurred_at"`
+}
+
+type StockMovementFilter struct {
+    ListParams
+    IngredientID    int
+    InvoiceID       int
+    PurchaseOrderID int
+    Reason          string
+    From            *time.Time
+    To              *time.Time
+}
+
+// StockAdjustmentRequest corrects an ingredient's on-hand quantity by a signed
+// amount, for example a delivery or a spill.
+type StockAdjustmentRequest struct {
+    Quantity float64 `json:"quantity" binding:"required,gte=-100000,lte=100000"`
+    Note     string  `json:"note" binding:"required,notblank,max=255"`
+}
+
+// StockAlert flags an ingredient at or below its reorder point. The suggested
+// quantity covers the reorder_cover_days setting at the average daily usage
+// over the last reorder_usage_days days of sales.
+type StockAlert struct {
+    AlertID           int        `json:"alert_id"`
+    IngredientID      int        `json:"ingredient_id"`
+    IngredientName    string     `json:"ingredient_name"`
+    Unit              string     `json:"unit"`
+    OnHand            float64    `json:"on_hand"`
+    ReorderPoint      float64    `json:"reorder_point"`
+    DailyUsage        float64    `json:"daily_usage"`
+    SuggestedQuantity float64    `json:"suggested_quantity"`
+    CreatedAt         time.Time  `json:"created_at"`
+    CheckedAt         time.Time  `json:"checked_at"`
+    ResolvedAt        *time.Time `json:"resolved_at,omitempty"`
+}
+
+type Supplier struct {
+    SupplierID  int    `json:"supplier_id"`
+    Name        string `json:"name" binding:"required,notblank,max=100"`
+    ContactName string `json:"contact_name" binding:"max=100"`
+    Phone       string `json:"phone" binding:"omitempty,phone"`
+    Email       string `json:"email" binding:"omitempty,email,max=100"`
+    Notes       string `json:"notes" binding:"max=500"`
+}
+
+// PurchaseOrder is an order of ingredients from a supplier. Only drafts can be
+// edited; goods are received against sent orders, line by line.
+type PurchaseOrder struct {
+    PurchaseOrderID int                 `json:"purchase_order_id"`
+    OrderNumber     string              `json:"order_number" binding:"-"`
+    SupplierID      int                 `json:"supplier_id" binding:"required,gt=0,supplier_exists"`
+    SupplierName    string              `json:"supplier_name" binding:"-"`
+    Status          string              `json:"status" binding:"-"`
+    Notes           string              `json:"notes" binding:"max=500"`
+    Lines           []PurchaseOrderLine `json:"lines" binding:"required,min=1,max=100,unique=IngredientID,dive"`
+    Total           float64             `json:"total" binding:"-"`
+    CreatedBy       *int                `json:"created_by,omitempty" binding:"-"`
+    CreatedAt       time.Time           `json:"created_at" binding:"-"`
+    SentAt          *time.Time          `json:"sent_at,omitempty" binding:"-"`
+    ReceivedAt      *time.Time          `json:"received_at,omitempty" binding:"-"`
+}
+
+type PurchaseOrderLine struct {
+    LineID           int     `json:"line_id" binding:"-"`
+    IngredientID     int     `json:"ingredient_id" binding:"required,gt=0,ingredient_exists"`
+    IngredientName   string  `json:"ingredient_name" binding:"-"`
+    Unit             string  `json:"unit" binding:"-"`
+    Quantity         float64 `json:"quantity" binding:"required,gt=0,lte=100000"`
+    UnitCost         float64 `json:"unit_cost" binding:"gte=0,lte=100000"`
+    ReceivedQuantity float64 `json:"received_quantity" binding:"-"`
+}
+
+type PurchaseOrderFilter struct {
+    ListParams
+    Status     string
+    SupplierID int
+}
+
+// ReceivePurchaseOrderRequest books goods delivered against a purchase order.
+// A line's unit cost defaults to the cost on the order.
+type ReceivePurchaseOrderRequest struct {
+    Lines []ReceiveLine `json:"lines" binding:"required,min=1,max=100,unique=LineID,dive"`
+    Note  string        `json:"note" binding:"max=255"`
+}
+
+type ReceiveLine struct {
+    LineID   int      `json:"line_id" binding:"required,gt=0"`
+    Quantity float64  `json:"quantity" binding:"required,gt=0,lte=100000"`
+    UnitCost *float64 `json:"unit_cost" binding:"omitempty,gte=0,lte=100000"`
+}
+
+// WastageRequest records stock lost without a sale. Quantity is in the
+// ingredient's unit, or a number of items for item wastage.
+type WastageRequest struct {
+    Quantity float64 `json:"quantity" binding:"required,gt=0,lte=100000"`
+    Reason   string  `json:"reason" binding:"required,notblank,max=150"`
+}
+
+// StockTake is a count of ingredients. Counts are compared with the on-hand
+// quantity when they are entered, and posting it adjusts stock by the
+// difference.
+type StockTake struct {
+    StockTakeID   int             `json:"stock_take_id"`
+    Status        string          `json:"status"`
+    Notes         string          `json:"notes"`
+    CreatedBy     *int            `json:"created_by,omitempty"`
+    CreatedAt     time.Time       `json:"created_at"`
+    PostedBy      *int            `json:"posted_by,omitempty"`
+    PostedAt      *time.Time      `json:"posted_at,omitempty"`
+    VarianceValue float64         `json:"variance_value"`
+    Lines         []StockTakeLine `json:"lines,omitempty"`
+}
+
+// StockTakeLine is one ingredient of a stock take. Expected is the on-hand
+// quantity when the stock take was started, replaced by the on-hand quantity
+// when the ingredient is counted. Variance is counted minus expected, and is
+// nil until the ingredient has been counted.
+type StockTakeLine struct {
+    IngredientID     int      `json:"ingredient_id"`
+    IngredientName   string   `json:"ingredient_name"`
+    Unit             string   `json:"unit"`
+    ExpectedQuantity float64  `json:"expected_quantity"`
+    CountedQuantity  *float64 `json:"counted_quantity"`
+    Variance         *float64 `json:"variance"`
+    VarianceValue    *float64 `json:"variance_value"`
+    Reason           string   `json:"reason"`
+}
+
+// CreateStockTakeRequest starts a stock take of the given ingredients, or of
+// every ingredient when none are listed.
+type CreateStockTakeRequest struct {
+    IngredientIDs []int  `json:"ingredient_ids" binding:"max=1000,unique,dive,gt=0,ingredient_exists"`
+    Notes         string `json:"notes" binding:"max=500"`
+}
+
+type StockCountRequest struct {
+    Counts []StockCount `json:"counts" binding:"required,min=1,max=1000,unique=IngredientID,dive"`
+}
+
+// StockCount records the counted quantity of an ingredient and, for a
+// variance, the reason for it.
+type StockCount struct {
+    IngredientID    int      `json:"ingredient_id" binding:"required,gt=0"`
+    CountedQuantity *float64 `json:"counted_quantity" binding:"required,gte=0,lte=1000000"`
+    Reason          string   `json:"reason" binding:"max=255"`
+}
+
+// StockVarianceLine totals the stock an ingredient lost or gained outside of
+// sales and deliveries. Negative quantities and values are losses.
+type StockVarianceLine struct {
+    IngredientID      int     `json:"ingredient_id"`
+    IngredientName    string  `json:"ingredient_name"`
+    Unit              string  `json:"unit"`
+    WastageQuantity   float64 `json:"wastage_quantity"`
+    WastageValue      float64 `json:"wastage_value"`
+    StockTakeQuantity float64 `json:"stock_take_quantity"`
+    StockTakeValue    float64 `json:"stock_take_value"`
+    TotalValue        float64 `json:"total_value"`
+}
+
+type StockVarianceReport struct {
+    From           time.Time           `json:"from"`
+    To             time.Time           `json:"to"`
+    Lines          []StockVarianceLine `json:"lines"`
+    WastageValue   float64             `json:"wastage_value"`
+    StockTakeValue float64             `json:"stock_take_value"`
+    TotalValue     float64             `json:"total_value"`
+}
+
+// MarginLine is the gross margin of one item or category. Cost of goods uses
+// the recipe cost stored on each sale, falling back to the current recipe
+// cost for older sales. Quantities sold without a known cost are counted in
+// UncostedQuantity and left out of the margin so they do not inflate it.
+type MarginLine struct {
+    ID               int      `json:"id"`
+    Name             string   `json:"name"`
+    QuantitySold     int      `json:"quantity_sold"`
+    Revenue          float64  `json:"revenue"`
+    CostOfGoods      float64  `json:"cost_of_goods"`
+    Margin           float64  `json:"margin"`
+    MarginPercent    *float64 `json:"margin_percent"`
+    UncostedQuantity int      `json:"uncosted_quantity"`
+}
+
+type MarginReport struct {
+    From          time.Time    `json:"from"`
+    To            time.Time    `json:"to"`
+    GroupBy       string       `json:"group_by"`
+    Lines         []MarginLine `json:"lines"`
+    Revenue       float64      `json:"revenue"`
+    CostOfGoods   float64      `json:"cost_of_goods"`
+    Margin        float64      `json:"margin"`
+    MarginPercent *float64     `json:"margin_percent"`
+}
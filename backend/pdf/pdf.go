@@ -0,0 +1,171 @@
+// Package pdf writes simple text-only PDF documents: A4 pages of lines in a
+// fixed-width font, which is enough for printable documents such as purchase
+// orders and keeps columns aligned without font metrics.
+package pdf
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+    "strings"
+)
+
+// A4 page size and layout, in points.
+const (
+    pageWidth  = 595
+    pageHeight = 842
+    margin     = 50
+)
+
+// ContentType is the MIME type of a PDF document.
+const ContentType = "application/pdf"
+
+// Fonts available to lines. Both are standard PDF fonts, so nothing is embedded.
+const (
+    Regular = iota
+    Bold
+)
+
+var fontNames = []string{"Courier", "Courier-Bold"}
+
+type line struct {
+    text string
+    font int
+    size int
+}
+
+// Document collects lines and lays them out on pages when written.
+type Document struct {
+    lines []line
+}
+
+func New() *Document {
+    return &Document{}
+}
+
+// Heading adds a line in a large bold font.
+func (d *Document) Heading(text string) {
+    d.lines = append(d.lines, line{text: text, font: Bold, size: 16})
+}
+
+// Line adds a line of regular text. Lines wider than the page are cut off.
+func (d *Document) Line(text string) {
+    d.lines = append(d.lines, line{text: text, font: Regular, size: 10})
+}
+
+// Paragraph adds regular text wrapped at word boundaries to the page width.
+func (d *Document) Paragraph(text string) {
+    width := (pageWidth - 2*margin) / 6 // Courier glyphs are 0.6 em wide
+    var current string
+    for _, word := range strings.Fields(text) {
+        if current != "" && len([]rune(current))+1+len([]rune(word)) > width {
+            d.Line(current)
+            current = ""
+        }
+        if current != "" {
+            current += " "
+        }
+        current += word
+    }
+    d.Line(current)
+}
+
+// BoldLine adds a line of bold text at the regular size.
+func (d *Document) BoldLine(text string) {
+    d.lines = append(d.lines, line{text: text, font: Bold, size: 10})
+}
+
+// Blank adds an empty line.
+func (d *Document) Blank() {
+    d.Line("")
+}
+
+// layout splits the lines into page content streams.
+func (d *Document) layout() []string {
+    var pages []string
+    var page strings.Builder
+    y := pageHeight - margin
+    for _, l := range d.lines {
+        leading := l.size * 14 / 10
+        if y-leading < margin && page.Len() > 0 {
+            pages = append(pages, page.String())
+            page.Reset()
+            y = pageHeight - margin
+        }
+        y -= leading
+        if l.text != "" {
+            fmt.Fprintf(&page, "BT /F%d %d Tf %d %d Td (%s) Tj ET\n", l.font+1, l.size, margin, y, escape(l.text))
+        }
+    }
+    return append(pages, page.String())
+}
+
+// WriteTo writes the document as a PDF file.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+    pages := d.layout()
+
+    // Objects 1 and 2 are the catalog and page tree, then one per font, then a
+    // page and its content stream for every page
+    fontBase := 3
+    pageBase := fontBase + len(fontNames)
+    var objects []string
+    objects = append(objects, "<< /Type /Catalog /Pages 2 0 R >>")
+
+    kids := make([]string, len(pages))
+    for i := range pages {
+        kids[i] = fmt.Sprintf("%d 0 R", pageBase+2*i)
+    }
+    objects = append(objects, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+
+    var fonts []string
+    for i, name := range fontNames {
+        objects = append(objects, fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", name))
+        fonts = append(fonts, fmt.Sprintf("/F%d %d 0 R", i+1, fontBase+i))
+    }
+
+    for i, content := range pages {
+        objects = append(objects, fmt.Sprintf(
+            "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << %s >> >> /Contents %d 0 R >>",
+            pageWidth, pageHeight, strings.Join(fonts, " "), pageBase+2*i+1))
+        objects = append(objects, fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", len(content), content))
+    }
+
+    var buf bytes.Buffer
+    buf.WriteString("%PDF-1.4\n")
+    offsets := make([]int, len(objects))
+    for i, obj := range objects {
+        offsets[i] = buf.Len()
+        fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+    }
+
+    xref := buf.Len()
+    fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+    for _, offset := range offsets {
+        fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+    }
+    fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+    return buf.WriteTo(w)
+}
+
+// escape encodes text as a PDF string body in WinAnsi. Characters outside
+// Latin-1 are replaced with '?'.
+func escape(text string) string {
+    var b strings.Builder
+    for _, r := range text {
+        switch {
+        case r == '\\' || r == '(' || r == ')':
+            b.WriteByte('\\')
+            b.WriteRune(r)
+        case r < 0x20:
+            b.WriteByte(' ')
+        case r < 0x80:
+            b.WriteRune(r)
+        case r < 0x100:
+            fmt.Fprintf(&b, "\\%03o", r)
+        default:
+            b.WriteByte('?')
+        }
+    }
+    return b.String()
+}
@@ -0,0 +1,121 @@
+package pdf
+
+import (
+    "bytes"
+    "fmt"
+    "regexp"
+    "strconv"
+    "strings"
+    "testing"
+)
+
+func write(t *testing.T, d *Document) string {
+    t.Helper()
+    var buf bytes.Buffer
+    n, err := d.WriteTo(&buf)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if n != int64(buf.Len()) {
+        t.Fatalf("WriteTo reported %d bytes, wrote %d", n, buf.Len())
+    }
+    return buf.String()
+}
+
+// checkStructure verifies the cross-reference table, which readers use to
+// find every object, and returns the number of objects.
+func checkStructure(t *testing.T, out string) int {
+    t.Helper()
+    if !strings.HasPrefix(out, "%PDF-1.4\n") || !strings.HasSuffix(out, "%%EOF\n") {
+        t.Fatal("missing PDF header or trailer")
+    }
+
+    m := regexp.MustCompile(`startxref\n(\d+)\n`).FindStringSubmatch(out)
+    if m == nil {
+        t.Fatal("missing startxref")
+    }
+    xref, _ := strconv.Atoi(m[1])
+    if !strings.HasPrefix(out[xref:], "xref\n") {
+        t.Fatalf("startxref %d does not point at the xref table", xref)
+    }
+
+    var count int
+    fmt.Sscanf(out[xref:], "xref\n0 %d\n", &count)
+    entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllStringSubmatch(out[xref:], -1)
+    if len(entries) != count-1 {
+        t.Fatalf("xref lists %d objects, header says %d", len(entries), count-1)
+    }
+    for i, entry := range entries {
+        offset, _ := strconv.Atoi(entry[1])
+        if want := fmt.Sprintf("%d 0 obj\n", i+1); !strings.HasPrefix(out[offset:], want) {
+            t.Errorf("xref entry %d points at %q", i+1, out[offset:offset+10])
+        }
+    }
+    return count - 1
+}
+
+func TestWriteTo(t *testing.T) {
+    d := New()
+    d.Heading("Purchase order PO-42")
+    d.Blank()
+    d.Line("Flour (00)")
+    d.BoldLine("Total")
+
+    out := write(t, d)
+    // Catalog, page tree, two fonts, one page and its content stream
+    if n := checkStructure(t, out); n != 6 {
+        t.Errorf("got %d objects, want 6", n)
+    }
+
+    for _, want := range []string{
+        "<< /Type /Pages /Kids [5 0 R] /Count 1 >>",
+        "/BaseFont /Courier /Encoding /WinAnsiEncoding",
+        "/BaseFont /Courier-Bold /Encoding /WinAnsiEncoding",
+        "BT /F2 16 Tf 50 770 Td (Purchase order PO-42) Tj ET\n" +
+            "BT /F1 10 Tf 50 742 Td (Flour \\(00\\)) Tj ET\n" +
+            "BT /F2 10 Tf 50 728 Td (Total) Tj ET\n",
+    } {
+        if !strings.Contains(out, want) {
+            t.Errorf("output does not contain %q", want)
+        }
+    }
+}
+
+func TestWriteToPages(t *testing.T) {
+    // 53 lines of regular text fit between the margins of one page
+    d := New()
+    for i := 0; i < 60; i++ {
+        d.Line(fmt.Sprintf("line %d", i))
+    }
+
+    out := write(t, d)
+    if n := checkStructure(t, out); n != 8 {
+        t.Errorf("got %d objects, want 8", n)
+    }
+    if !strings.Contains(out, "/Kids [5 0 R 7 0 R] /Count 2") {
+        t.Error("expected two pages")
+    }
+    if !strings.Contains(out, "(line 52) Tj") || !strings.Contains(out, "BT /F1 10 Tf 50 778 Td (line 53) Tj") {
+        t.Error("line 53 should start the second page")
+    }
+}
+
+func TestEscape(t *testing.T) {
+    tests := []struct {
+        text string
+        want string
+    }{
+        {"plain", "plain"},
+        {`a\b`, `a\\b`},
+        {"(x)", `\(x\)`},
+        {"tab\there", "tab here"},
+        {"café", `caf\351`},
+        {"€5", "?5"},
+    }
+
+    for _, tt := range tests {
+        if got := escape(tt.text); got != tt.want {
+            t.Errorf("escape(%q) = %q, want %q", tt.text, got, tt.want)
+        }
+    }
+}
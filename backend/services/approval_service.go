@@ -0,0 +1,210 @@
+package services
+
+import (
+    "database/sql"
+    "time"
+    "backend/models"
+    "backend/database"
+
+    "golang.org/x/crypto/bcrypt"
+)
+
+// Actions a manager can approve on behalf of another user.
+const (
+    ApprovalVoidInvoice   = "invoice.void"
+    ApprovalPriceOverride = "invoice.price_override"
+    ApprovalLargeDiscount = "invoice.large_discount"
+    ApprovalOpenDrawer    = "drawer.open"
+)
+
+// approvalPermissions is the permission an approver needs for each action.
+var approvalPermissions = map[string]Permission{
+    ApprovalVoidInvoice:   PermVoidInvoices,
+    ApprovalPriceOverride: PermOverridePrice,
+    ApprovalLargeDiscount: PermLargeDiscount,
+    ApprovalOpenDrawer:    PermOpenDrawer,
+}
+
+// Kinds of price override on an invoice line.
+const (
+    overrideNone = iota
+    // overrideDiscount lowers the price by no more than discount_limit_percent
+    overrideDiscount
+    overrideLargeDiscount
+    // overridePrice is any other change, such as raising the price
+    overridePrice
+)
+
+// classifyOverride tells which approval a line priced at override instead of
+// price needs. Discounts of up to limitPercent of the price need none.
+func classifyOverride(price, override, limitPercent float64) int {
+    switch {
+    case override == price:
+        return overrideNone
+    case override > price:
+        return overridePrice
+    case roundMoney(price-override) <= roundMoney(price*limitPercent/100):
+        return overrideDiscount
+    default:
+        return overrideLargeDiscount
+    }
+}
+
+const (
+    // approvalTTL is how long an approval token can be used after the PIN is entered
+    approvalTTL = 2 * time.Minute
+    // maxPinAttempts wrong PINs lock the approver's PIN for pinLockout
+    maxPinAttempts = 5
+    pinLockout     = 5 * time.Minute
+)
+
+type ApprovalService struct {
+    db *sql.DB
+}
+
+func NewApprovalService() *ApprovalService {
+    return &ApprovalService{
+        db: database.GetDB(),
+    }
+}
+
+// Approve checks a manager's PIN and issues a single-use token that lets the
+// requester perform the action. Void approvals are bound to one invoice.
+func (s *ApprovalService) Approve(req *models.ApprovalRequest, requester *models.User) (*models.ApprovalResponse, error) {
+    if req.Action == ApprovalVoidInvoice && req.InvoiceID == nil {
+        return nil, FieldError("invoice_id", "is required to approve a void")
+    }
+
+    tx, err := s.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    var approver models.User
+    var pinHash sql.NullString
+    var failedAttempts int
+    var lockedUntil sql.NullTime
+    err = tx.QueryRow(`
+        SELECT UserID, Username, FullName, Role, IsActive, CreatedAt, PinHash, PinFailedAttempts, PinLockedUntil
+        FROM Users WITH (UPDLOCK) WHERE Username = ?
+    `, req.Username).Scan(&approver.UserID, &approver.Username, &approver.FullName, &approver.Role,
+        &approver.IsActive, &approver.CreatedAt, &pinHash, &failedAttempts, &lockedUntil)
+    if err == sql.ErrNoRows {
+        bcrypt.CompareHashAndPassword(dummyHash, []byte(req.Pin))
+        return nil, FieldError("pin", "is incorrect")
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    now := time.Now()
+    if lockedUntil.Valid && lockedUntil.Time.After(now) {
+        return nil, ConflictError("PIN for %s is locked after too many failed attempts; try again later", approver.Username)
+    }
+
+    if !pinHash.Valid || !approver.IsActive || bcrypt.CompareHashAndPassword([]byte(pinHash.String), []byte(req.Pin)) != nil {
+        if pinHash.Valid {
+            if err := recordPinFailure(tx, approver.UserID, failedAttempts+1, now); err != nil {
+                return nil, err
+            }
+            if err := tx.Commit(); err != nil {
+                return nil, err
+            }
+        }
+        return nil, FieldError("pin", "is incorrect")
+    }
+
+    if err := RequirePermission(&approver, PermGrantApprovals); err != nil {
+        return nil, err
+    }
+    if err := RequirePermission(&approver, approvalPermissions[req.Action]); err != nil {
+        return nil, err
+    }
+
+    if _, err := tx.Exec(`UPDATE Users SET PinFailedAttempts = 0, PinLockedUntil = NULL WHERE UserID = ?`, approver.UserID); err != nil {
+        return nil, err
+    }
+
+    token := randomToken(32)
+    response := &models.ApprovalResponse{
+        ApprovalToken: token,
+        Action:        req.Action,
+        ExpiresIn:     int(approvalTTL.Seconds()),
+        ApprovedBy:    &approver,
+    }
+    err = tx.QueryRow(`
+        INSERT INTO Approvals (Action, RequestedBy, ApprovedBy, InvoiceID, TokenHash, ExpiresAt)
+        OUTPUT INSERTED.ApprovalID
+        VALUES (?, ?, ?, ?, ?, ?)
+    `, req.Action, requester.UserID, approver.UserID, req.InvoiceID, hashToken(token), now.Add(approvalTTL)).Scan(&response.ApprovalID)
+    if err != nil {
+        return nil, err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+
+    return response, nil
+}
+
+func recordPinFailure(tx *sql.Tx, userID, attempts int, now time.Time) error {
+    if attempts >= maxPinAttempts {
+        _, err := tx.Exec(`
+            UPDATE Users SET PinFailedAttempts = 0, PinLockedUntil = ?
+            WHERE UserID = ?
+        `, now.Add(pinLockout), userID)
+        return err
+    }
+
+    _, err := tx.Exec(`UPDATE Users SET PinFailedAttempts = ? WHERE UserID = ?`, attempts, userID)
+    return err
+}
+
+// authorizeAction decides who authorises an action inside tx. An actor holding
+// perm acts alone and no approval is returned. Otherwise the approval token is
+// consumed and its approver must hold perm; invoiceID binds void approvals to
+// the invoice they were issued for.
+func authorizeAction(tx *sql.Tx, actor *models.User, perm Permission, action, token string, invoiceID *int) (*int, error) {
+    if HasPermission(actor, perm) {
+        return nil, nil
+    }
+    if token == "" {
+        return nil, ForbiddenError(perm)
+    }
+
+    var approvalID int
+    var approver models.User
+    var boundInvoice sql.NullInt64
+    err := tx.QueryRow(`
+        SELECT a.ApprovalID, a.InvoiceID, u.UserID, u.Role, u.IsActive
+        FROM Approvals a WITH (UPDLOCK)
+        JOIN Users u ON a.ApprovedBy = u.UserID
+        WHERE a.TokenHash = ? AND a.Action = ? AND a.RequestedBy = ?
+              AND a.UsedAt IS NULL AND a.ExpiresAt > ?
+    `, hashToken(token), action, actor.UserID, time.Now()).Scan(&approvalID, &boundInvoice, &approver.UserID, &approver.Role, &approver.IsActive)
+    if err == sql.ErrNoRows {
+        return nil, FieldError("approval_token", "is invalid, expired or already used")
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    if boundInvoice.Valid && (invoiceID == nil || int(boundInvoice.Int64) != *invoiceID) {
+        return nil, FieldError("approval_token", "was issued for a different invoice")
+    }
+    // The approver's role is checked again in case it changed since the PIN was entered
+    if !approver.IsActive {
+        return nil, ForbiddenError(perm)
+    }
+    if err := RequirePermission(&approver, perm); err != nil {
+        return nil, err
+    }
+
+    if _, err := tx.Exec(`UPDATE Approvals SET UsedAt = GETDATE() WHERE ApprovalID = ?`, approvalID); err != nil {
+        return nil, err
+    }
+
+    return &approvalID, nil
+}
@@ -0,0 +1,30 @@
+package services
+
+import "testing"
+
+func TestClassifyOverride(t *testing.T) {
+    tests := []struct {
+        name     string
+        price    float64
+        override float64
+        limit    float64
+        want     int
+    }{
+        {"same price", 10, 10, 0, overrideNone},
+        {"raised", 10, 12, 50, overridePrice},
+        {"any discount needs approval by default", 10, 9.99, 0, overrideLargeDiscount},
+        {"within the limit", 10, 9, 10, overrideDiscount},
+        // 10% of 3.35 rounds to the 0.34 off that was given
+        {"at the limit after rounding", 3.35, 3.01, 10, overrideDiscount},
+        {"beyond the limit", 10, 8.99, 10, overrideLargeDiscount},
+        {"free", 10, 0, 100, overrideDiscount},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := classifyOverride(tt.price, tt.override, tt.limit); got != tt.want {
+                t.Errorf("classifyOverride(%v, %v, %v) = %d, want %d", tt.price, tt.override, tt.limit, got, tt.want)
+            }
+        })
+    }
+}
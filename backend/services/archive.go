@@ -0,0 +1,235 @@
+package services
+
+import (
+    "database/sql"
+    "fmt"
+    "backend/models"
+)
+
+// archiveTables maps an archivable entity to its table and key column.
+var archiveTables = map[string][2]string{
+    AuditItem:     {"Items", "ItemID"},
+    AuditCategory: {"Categories", "CategoryID"},
+    AuditCustomer: {"Customers", "CustomerID"},
+}
+
+// setArchived archives or restores one row inside tx.
+func setArchived(tx *sql.Tx, entity string, id int, archived bool) error {
+    table := archiveTables[entity]
+    value := "NULL"
+    if archived {
+        value = "GETDATE()"
+    }
+    result, err := tx.Exec(`UPDATE `+table[0]+` SET ArchivedAt = `+value+` WHERE `+table[1]+` = ?`, id)
+    if err != nil {
+        return err
+    }
+    return checkAffected(result, entity, id)
+}
+
+func isArchived(q querier, entity string, id int) (bool, error) {
+    table := archiveTables[entity]
+    var count int
+    err := q.QueryRow(`SELECT COUNT(*) FROM `+table[0]+` WHERE `+table[1]+` = ? AND ArchivedAt IS NOT NULL`, id).Scan(&count)
+    return count > 0, err
+}
+
+// checkNotArchived returns a validation error for field when the referenced
+// record is archived, so nothing new is attached to it.
+func checkNotArchived(q querier, entity string, id int, field string) error {
+    archived, err := isArchived(q, entity, id)
+    if err != nil {
+        return err
+    }
+    if archived {
+        return FieldError(field, fmt.Sprintf("%s %d is archived", entity, id))
+    }
+    return nil
+}
+
+// ArchiveItem takes an item off the menu and out of the item list while
+// keeping it on the invoices it was sold on.
+func (s *ItemService) ArchiveItem(itemID int, actor *models.User) (*models.Item, error) {
+    return s.setItemArchived(itemID, true, actor)
+}
+
+// RestoreItem brings an archived item back. Its category must not be archived.
+func (s *ItemService) RestoreItem(itemID int, actor *models.User) (*models.Item, error) {
+    return s.setItemArchived(itemID, false, actor)
+}
+
+func (s *ItemService) setItemArchived(itemID int, archived bool, actor *models.User) (*models.Item, error) {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    before, err := loadItem(tx, itemID)
+    if err != nil {
+        return nil, err
+    }
+    action := AuditArchive
+    if archived {
+        if before.ArchivedAt != nil {
+            return nil, ConflictError("item %d is already archived", itemID)
+        }
+    } else {
+        if before.ArchivedAt == nil {
+            return nil, ConflictError("item %d is not archived", itemID)
+        }
+        categoryArchived, err := isArchived(tx, AuditCategory, before.CategoryID)
+        if err != nil {
+            return nil, err
+        }
+        if categoryArchived {
+            return nil, ConflictError("cannot restore item: its category is archived")
+        }
+        action = AuditRestore
+    }
+
+    if err := setArchived(tx, AuditItem, itemID, archived); err != nil {
+        return nil, err
+    }
+    after, err := loadItem(tx, itemID)
+    if err != nil {
+        return nil, err
+    }
+    if err := writeAudit(tx, actor, AuditItem, itemID, action, before, after); err != nil {
+        return nil, err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+
+    return after, nil
+}
+
+// ArchiveCategory hides a category from the category list and the menu. Its
+// items and subcategories must be archived first.
+func (s *CategoryService) ArchiveCategory(categoryID int, actor *models.User) (*models.Category, error) {
+    return s.setCategoryArchived(categoryID, true, actor)
+}
+
+// RestoreCategory brings an archived category back. Its parent must not be
+// archived.
+func (s *CategoryService) RestoreCategory(categoryID int, actor *models.User) (*models.Category, error) {
+    return s.setCategoryArchived(categoryID, false, actor)
+}
+
+func (s *CategoryService) setCategoryArchived(categoryID int, archived bool, actor *models.User) (*models.Category, error) {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    before, err := loadCategory(tx, categoryID)
+    if err != nil {
+        return nil, err
+    }
+    action := AuditArchive
+    if archived {
+        if before.ArchivedAt != nil {
+            return nil, ConflictError("category %d is already archived", categoryID)
+        }
+        var items, subcategories int
+        err := tx.QueryRow(`
+            SELECT (SELECT COUNT(*) FROM Items WHERE CategoryID = ? AND ArchivedAt IS NULL),
+                   (SELECT COUNT(*) FROM Categories WHERE ParentCategoryID = ? AND ArchivedAt IS NULL)
+        `, categoryID, categoryID).Scan(&items, &subcategories)
+        if err != nil {
+            return nil, err
+        }
+        if items > 0 {
+            return nil, ConflictError("cannot archive category: it has %d items that are not archived", items)
+        }
+        if subcategories > 0 {
+            return nil, ConflictError("cannot archive category: it has %d subcategories that are not archived", subcategories)
+        }
+    } else {
+        if before.ArchivedAt == nil {
+            return nil, ConflictError("category %d is not archived", categoryID)
+        }
+        if before.ParentCategoryID != nil {
+            parentArchived, err := isArchived(tx, AuditCategory, *before.ParentCategoryID)
+            if err != nil {
+                return nil, err
+            }
+            if parentArchived {
+                return nil, ConflictError("cannot restore category: its parent is archived")
+            }
+        }
+        action = AuditRestore
+    }
+
+    if err := setArchived(tx, AuditCategory, categoryID, archived); err != nil {
+        return nil, err
+    }
+    after, err := loadCategory(tx, categoryID)
+    if err != nil {
+        return nil, err
+    }
+    if err := writeAudit(tx, actor, AuditCategory, categoryID, action, before, after); err != nil {
+        return nil, err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+
+    return after, nil
+}
+
+// ArchiveCustomer removes a customer from the customer list and from new
+// invoices while keeping their invoice history.
+func (s *CustomerService) ArchiveCustomer(customerID int, actor *models.User) (*models.Customer, error) {
+    return s.setCustomerArchived(customerID, true, actor)
+}
+
+// RestoreCustomer brings an archived customer back.
+func (s *CustomerService) RestoreCustomer(customerID int, actor *models.User) (*models.Customer, error) {
+    return s.setCustomerArchived(customerID, false, actor)
+}
+
+func (s *CustomerService) setCustomerArchived(customerID int, archived bool, actor *models.User) (*models.Customer, error) {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    before, err := loadCustomer(tx, customerID)
+    if err != nil {
+        return nil, err
+    }
+    action := AuditArchive
+    if archived {
+        if before.ArchivedAt != nil {
+            return nil, ConflictError("customer %d is already archived", customerID)
+        }
+    } else {
+        if before.ArchivedAt == nil {
+            return nil, ConflictError("customer %d is not archived", customerID)
+        }
+        action = AuditRestore
+    }
+
+    if err := setArchived(tx, AuditCustomer, customerID, archived); err != nil {
+        return nil, err
+    }
+    after, err := loadCustomer(tx, customerID)
+    if err != nil {
+        return nil, err
+    }
+    if err := writeAudit(tx, actor, AuditCustomer, customerID, action, before, after); err != nil {
+        return nil, err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+
+    return after, nil
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+    "database/sql"
+    "encoding/json"
+    "backend/models"
+    "backend/database"
+)
+
+// Audited entity types.
+const (
+    AuditItem          = "item"
+    AuditCategory      = "category"
+    AuditCustomer      = "customer"
+    AuditInvoice       = "invoice"
+    AuditPriceRule     = "price_rule"
+    AuditIngredient    = "ingredient"
+    AuditSupplier      = "supplier"
+    AuditPurchaseOrder = "purchase_order"
+    AuditStockTake     = "stock_take"
+)
+
+// Audited actions.
+const (
+    AuditCreate  = "create"
+    AuditUpdate  = "update"
+    AuditDelete  = "delete"
+    AuditImport  = "import"
+    AuditVoid    = "void"
+    AuditArchive = "archive"
+    AuditRestore = "restore"
+
+    AuditSchedulePrice = "schedule_price"
+    AuditCancelPrice   = "cancel_price"
+    AuditAvailability  = "availability"
+    AuditRecipe        = "recipe"
+    AuditBundle        = "bundle"
+    AuditImage         = "image"
+    AuditSend          = "send"
+    AuditReceive       = "receive"
+    AuditCancel        = "cancel"
+    AuditPost          = "post"
+)
+
+// writeAudit appends an audit entry inside the transaction making the change,
+// so the entry is stored if and only if the change is. before and after are
+// stored as JSON; either may be nil.
+func writeAudit(q querier, actor *models.User, entityType string, entityID int, action string, before, after interface{}) error {
+    beforeJSON, err := auditJSON(before)
+    if err != nil {
+        return err
+    }
+    afterJSON, err := auditJSON(after)
+    if err != nil {
+        return err
+    }
+
+    var userID interface{}
+    username := ""
+    if actor != nil {
+        userID = actor.UserID
+        username = actor.Username
+    }
+
+    _, err = q.Exec(`
+        INSERT INTO AuditLogs (UserID, Username, EntityType, EntityID, Action, BeforeData, AfterData)
+        VALUES (?, ?, ?, ?, ?, ?, ?)
+    `, userID, username, entityType, entityID, action, beforeJSON, afterJSON)
+    return err
+}
+
+func auditJSON(v interface{}) (sql.NullString, error) {
+    if v == nil {
+        return sql.NullString{}, nil
+    }
+    data, err := json.Marshal(v)
+    if err != nil {
+        return sql.NullString{}, err
+    }
+    // A typed nil pointer marshals to null and is stored as no data
+    if string(data) == "null" {
+        return sql.NullString{}, nil
+    }
+    return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+var auditSortColumns = map[string]string{
+    "occurred_at": "OccurredAt",
+    "entity_type": "EntityType",
+    "username":    "Username",
+    "action":      "Action",
+    "audit_id":    "AuditID",
+}
+
+type AuditService struct {
+    db *sql.DB
+}
+
+func NewAuditService() *AuditService {
+    return &AuditService{
+        db: database.GetDB(),
+    }
+}
+
+// ListAudit returns one page of audit entries matching the filter, newest
+// first unless another sort is requested, and the total number of matches.
+func (s *AuditService) ListAudit(filter models.AuditFilter) ([]models.AuditEntry, int, error) {
+    q := &listQuery{}
+    q.search(filter.Search, "Username", "BeforeData", "AfterData")
+    if filter.EntityType != "" {
+        q.where("EntityType = ?", filter.EntityType)
+    }
+    if filter.EntityID != nil {
+        q.where("EntityID = ?", *filter.EntityID)
+    }
+    if filter.UserID != nil {
+        q.where("UserID = ?", *filter.UserID)
+    }
+    if filter.Action != "" {
+        q.where("Action = ?", filter.Action)
+    }
+    if filter.From != nil {
+        q.where("OccurredAt >= ?", *filter.From)
+    }
+    if filter.To != nil {
+        q.where("OccurredAt < ?", *filter.To)
+    }
+
+    var total int
+    if err := s.db.QueryRow(`SELECT COUNT(*) FROM AuditLogs `+q.clause(), q.args...).Scan(&total); err != nil {
+        return nil, 0, err
+    }
+
+    order, err := orderAndPage(filter.ListParams, auditSortColumns, "AuditID DESC", "AuditID DESC")
+    if err != nil {
+        return nil, 0, err
+    }
+
+    rows, err := s.db.Query(`
+        SELECT AuditID, OccurredAt, UserID, Username, EntityType, EntityID, Action, BeforeData, AfterData
+        FROM AuditLogs
+        `+q.clause()+`
+        `+order, q.args...)
+    if err != nil {
+        return nil, 0, err
+    }
+    defer rows.Close()
+
+    entries := []models.AuditEntry{}
+    for rows.Next() {
+        var entry models.AuditEntry
+        var userID sql.NullInt64
+        var before, after sql.NullString
+        err := rows.Scan(&entry.AuditID, &entry.OccurredAt, &userID, &entry.Username,
+            &entry.EntityType, &entry.EntityID, &entry.Action, &before, &after)
+        if err != nil {
+            return nil, 0, err
+        }
+
+        if userID.Valid {
+            id := int(userID.Int64)
+            entry.UserID = &id
+        }
+        if before.Valid {
+            entry.Before = json.RawMessage(before.String)
+        }
+        if after.Valid {
+            entry.After = json.RawMessage(after.String)
+        }
+        entries = append(entries, entry)
+    }
+
+    return entries, total, rows.Err()
+}
@@ -0,0 +1,381 @@
+package services
+
+import (
+    "crypto/rand"
+    "crypto/sha256"
+    "database/sql"
+    "encoding/base64"
+    "encoding/hex"
+    "fmt"
+    "log"
+    "strconv"
+    "time"
+    "backend/config"
+    "backend/models"
+    "backend/database"
+
+    "github.com/golang-jwt/jwt/v5"
+    "golang.org/x/crypto/bcrypt"
+)
+
+const tokenIssuer = "pizzashop-billing"
+
+// dummyHash is compared against when a username is unknown, so failed logins
+// take the same time whether or not the account exists.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+
+// AccessClaims are the claims carried by an access token. The subject is the user id.
+type AccessClaims struct {
+    Username string `json:"username"`
+    jwt.RegisteredClaims
+}
+
+type AuthService struct {
+    db              *sql.DB
+    secret          []byte
+    accessTokenTTL  time.Duration
+    refreshTokenTTL time.Duration
+}
+
+func NewAuthService(cfg *config.Config) *AuthService {
+    secret := []byte(cfg.JWTSecret)
+    if len(secret) == 0 {
+        // Without a configured secret tokens only survive until the next restart
+        secret = make([]byte, 32)
+        if _, err := rand.Read(secret); err != nil {
+            log.Fatal("Failed to generate JWT secret:", err)
+        }
+        log.Println("JWT_SECRET is not set; using a random secret, all sessions end when the server restarts")
+    }
+
+    return &AuthService{
+        db:              database.GetDB(),
+        secret:          secret,
+        accessTokenTTL:  cfg.AccessTokenTTL,
+        refreshTokenTTL: cfg.RefreshTokenTTL,
+    }
+}
+
+// EnsureAdmin creates the first user account when the Users table is empty.
+// If no password is configured a random one is generated and logged once.
+func (s *AuthService) EnsureAdmin(username, password string) error {
+    var count int
+    if err := s.db.QueryRow(`SELECT COUNT(*) FROM Users`).Scan(&count); err != nil {
+        return err
+    }
+    if count > 0 {
+        return nil
+    }
+
+    generated := password == ""
+    if generated {
+        password = randomToken(12)
+    }
+
+    hash, err := HashPassword(password)
+    if err != nil {
+        return err
+    }
+
+    _, err = s.db.Exec(`
+        INSERT INTO Users (Username, PasswordHash, FullName, Role)
+        VALUES (?, ?, ?, ?)
+    `, username, hash, "Administrator", RoleAdmin)
+    if err != nil {
+        return err
+    }
+
+    if generated {
+        log.Printf("Created bootstrap admin %q with password %q; change it after signing in", username, password)
+    } else {
+        log.Printf("Created bootstrap admin %q", username)
+    }
+    return nil
+}
+
+// Login checks the username and password and issues a new token pair.
+func (s *AuthService) Login(username, password string) (*models.TokenResponse, error) {
+    var user models.User
+    var passwordHash string
+
+    err := s.db.QueryRow(`
+        SELECT UserID, Username, FullName, Role, IsActive, CreatedAt, PasswordHash
+        FROM Users WHERE Username = ?
+    `, username).Scan(&user.UserID, &user.Username, &user.FullName, &user.Role, &user.IsActive, &user.CreatedAt, &passwordHash)
+    if err == sql.ErrNoRows {
+        bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+        return nil, UnauthorizedError("invalid username or password")
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    if bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)) != nil || !user.IsActive {
+        return nil, UnauthorizedError("invalid username or password")
+    }
+
+    return s.issueTokens(&user)
+}
+
+// Refresh exchanges a valid refresh token for a new token pair. The old refresh
+// token is revoked so each one can only be used once.
+func (s *AuthService) Refresh(refreshToken string) (*models.TokenResponse, error) {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    var tokenID, userID int
+    err = tx.QueryRow(`
+        SELECT TokenID, UserID FROM RefreshTokens WITH (UPDLOCK)
+        WHERE TokenHash = ? AND RevokedAt IS NULL AND ExpiresAt > ?
+    `, hashToken(refreshToken), time.Now()).Scan(&tokenID, &userID)
+    if err == sql.ErrNoRows {
+        return nil, UnauthorizedError("refresh token is invalid or expired")
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    if _, err := tx.Exec(`UPDATE RefreshTokens SET RevokedAt = ? WHERE TokenID = ?`, time.Now(), tokenID); err != nil {
+        return nil, err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+
+    user, err := s.GetUserByID(userID)
+    if err != nil {
+        return nil, err
+    }
+    if !user.IsActive {
+        return nil, UnauthorizedError("account is disabled")
+    }
+
+    return s.issueTokens(user)
+}
+
+// Logout revokes the presented access token and, if given, the refresh token.
+func (s *AuthService) Logout(claims *AccessClaims, refreshToken string) error {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    _, err = tx.Exec(`
+        INSERT INTO RevokedTokens (TokenJTI, ExpiresAt)
+        VALUES (?, ?)
+    `, claims.ID, claims.ExpiresAt.Time)
+    if err != nil {
+        return err
+    }
+
+    if refreshToken != "" {
+        _, err = tx.Exec(`
+            UPDATE RefreshTokens SET RevokedAt = ?
+            WHERE TokenHash = ? AND UserID = ? AND RevokedAt IS NULL
+        `, time.Now(), hashToken(refreshToken), claims.Subject)
+        if err != nil {
+            return err
+        }
+    }
+
+    // Revocations only need to outlive the token they block
+    if _, err := tx.Exec(`DELETE FROM RevokedTokens WHERE ExpiresAt < ?`, time.Now()); err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+// Authenticate validates an access token and returns its active user and claims.
+func (s *AuthService) Authenticate(tokenString string) (*models.User, *AccessClaims, error) {
+    claims := &AccessClaims{}
+    _, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+        return s.secret, nil
+    }, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuer(tokenIssuer))
+    if err != nil {
+        return nil, nil, UnauthorizedError("access token is invalid or expired")
+    }
+
+    var revoked int
+    err = s.db.QueryRow(`SELECT COUNT(*) FROM RevokedTokens WHERE TokenJTI = ?`, claims.ID).Scan(&revoked)
+    if err != nil {
+        return nil, nil, err
+    }
+    if revoked > 0 {
+        return nil, nil, UnauthorizedError("access token has been revoked")
+    }
+
+    userID, err := strconv.Atoi(claims.Subject)
+    if err != nil {
+        return nil, nil, UnauthorizedError("access token is invalid or expired")
+    }
+
+    user, err := s.GetUserByID(userID)
+    if err != nil {
+        if appErr, ok := err.(*AppError); ok && appErr.Code == CodeNotFound {
+            return nil, nil, UnauthorizedError("account no longer exists")
+        }
+        return nil, nil, err
+    }
+    if !user.IsActive {
+        return nil, nil, UnauthorizedError("account is disabled")
+    }
+
+    return user, claims, nil
+}
+
+// ChangePassword replaces a user's password after checking the current one and
+// revokes their outstanding refresh tokens.
+func (s *AuthService) ChangePassword(userID int, currentPassword, newPassword string) error {
+    var passwordHash string
+    err := s.db.QueryRow(`SELECT PasswordHash FROM Users WHERE UserID = ?`, userID).Scan(&passwordHash)
+    if err == sql.ErrNoRows {
+        return NotFoundError("user", userID)
+    }
+    if err != nil {
+        return err
+    }
+
+    if bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(currentPassword)) != nil {
+        return FieldError("current_password", "is incorrect")
+    }
+
+    hash, err := HashPassword(newPassword)
+    if err != nil {
+        return err
+    }
+
+    tx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.Exec(`UPDATE Users SET PasswordHash = ? WHERE UserID = ?`, hash, userID); err != nil {
+        return err
+    }
+
+    _, err = tx.Exec(`
+        UPDATE RefreshTokens SET RevokedAt = ?
+        WHERE UserID = ? AND RevokedAt IS NULL
+    `, time.Now(), userID)
+    if err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+// SetPin sets the PIN a manager enters to approve actions on another user's
+// till. The account password is required so an unattended session cannot
+// change it.
+func (s *AuthService) SetPin(user *models.User, password, pin string) error {
+    if err := RequirePermission(user, PermGrantApprovals); err != nil {
+        return err
+    }
+
+    var passwordHash string
+    err := s.db.QueryRow(`SELECT PasswordHash FROM Users WHERE UserID = ?`, user.UserID).Scan(&passwordHash)
+    if err == sql.ErrNoRows {
+        return NotFoundError("user", user.UserID)
+    }
+    if err != nil {
+        return err
+    }
+
+    if bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)) != nil {
+        return FieldError("password", "is incorrect")
+    }
+
+    hash, err := HashPassword(pin)
+    if err != nil {
+        return err
+    }
+
+    _, err = s.db.Exec(`
+        UPDATE Users SET PinHash = ?, PinFailedAttempts = 0, PinLockedUntil = NULL
+        WHERE UserID = ?
+    `, hash, user.UserID)
+    return err
+}
+
+func (s *AuthService) GetUserByID(userID int) (*models.User, error) {
+    var user models.User
+    err := s.db.QueryRow(`
+        SELECT UserID, Username, FullName, Role, IsActive, CreatedAt
+        FROM Users WHERE UserID = ?
+    `, userID).Scan(&user.UserID, &user.Username, &user.FullName, &user.Role, &user.IsActive, &user.CreatedAt)
+    if err == sql.ErrNoRows {
+        return nil, NotFoundError("user", userID)
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    return &user, nil
+}
+
+func (s *AuthService) issueTokens(user *models.User) (*models.TokenResponse, error) {
+    now := time.Now()
+    claims := AccessClaims{
+        Username: user.Username,
+        RegisteredClaims: jwt.RegisteredClaims{
+            Issuer:    tokenIssuer,
+            Subject:   strconv.Itoa(user.UserID),
+            ID:        randomToken(16),
+            IssuedAt:  jwt.NewNumericDate(now),
+            ExpiresAt: jwt.NewNumericDate(now.Add(s.accessTokenTTL)),
+        },
+    }
+
+    accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+    if err != nil {
+        return nil, err
+    }
+
+    refreshToken := randomToken(32)
+    _, err = s.db.Exec(`
+        INSERT INTO RefreshTokens (UserID, TokenHash, ExpiresAt)
+        VALUES (?, ?, ?)
+    `, user.UserID, hashToken(refreshToken), now.Add(s.refreshTokenTTL))
+    if err != nil {
+        return nil, err
+    }
+
+    return &models.TokenResponse{
+        AccessToken:  accessToken,
+        RefreshToken: refreshToken,
+        TokenType:    "Bearer",
+        ExpiresIn:    int(s.accessTokenTTL.Seconds()),
+        User:         user,
+    }, nil
+}
+
+// HashPassword returns the bcrypt hash stored for a password.
+func HashPassword(password string) (string, error) {
+    hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+    if err != nil {
+        return "", fmt.Errorf("failed to hash password: %v", err)
+    }
+    return string(hash), nil
+}
+
+// randomToken returns n random bytes encoded as URL-safe base64.
+func randomToken(n int) string {
+    b := make([]byte, n)
+    if _, err := rand.Read(b); err != nil {
+        panic(err)
+    }
+    return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// hashToken stores refresh tokens as SHA-256 digests so a database leak does not expose live tokens.
+func hashToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
@@ -2,7 +2,8 @@ package services
 
 import (
     "database/sql"
-    "fmt"
+    "sort"
+    "time"
     "backend/models"
     "backend/database"
 )
@@ -17,78 +18,349 @@ func NewCategoryService() *CategoryService {
     }
 }
 
-func (s *CategoryService) GetAllCategories() ([]models.Category, error) {
-    query := `SELECT CategoryID, CategoryName, Description FROM Categories ORDER BY CategoryName`
+func (s *CategoryService) GetAllCategories(includeArchived bool) ([]models.Category, error) {
+    var categories []models.Category
+    err := s.EachCategory(includeArchived, func(category models.Category) error {
+        categories = append(categories, category)
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    
+    return categories, nil
+}
+
+// EachCategory streams the categories to fn in display order without holding
+// the full list in memory. Archived categories are skipped unless
+// includeArchived is set.
+func (s *CategoryService) EachCategory(includeArchived bool, fn func(models.Category) error) error {
+    where := "WHERE ArchivedAt IS NULL"
+    if includeArchived {
+        where = ""
+    }
+    query := `
+        SELECT CategoryID, CategoryName, Description, ParentCategoryID, SortOrder, IsActive, ArchivedAt
+        FROM Categories ` + where + ` ORDER BY SortOrder, CategoryName
+    `
     
     rows, err := s.db.Query(query)
     if err != nil {
-        return nil, err
+        return err
     }
     defer rows.Close()
     
-    var categories []models.Category
     for rows.Next() {
-        var category models.Category
-        err := rows.Scan(&category.CategoryID, &category.CategoryName, &category.Description)
+        category, err := scanCategory(rows)
         if err != nil {
-            return nil, err
+            return err
+        }
+        if err := fn(*category); err != nil {
+            return err
         }
-        categories = append(categories, category)
     }
     
-    return categories, nil
+    return rows.Err()
 }
 
-func (s *CategoryService) CreateCategory(category *models.Category) error {
+func (s *CategoryService) CreateCategory(category *models.Category, actor *models.User) error {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+    
+    if category.IsActive == nil {
+        active := true
+        category.IsActive = &active
+    }
+    if category.ParentCategoryID != nil {
+        if err := checkNotArchived(tx, AuditCategory, *category.ParentCategoryID, "parent_category_id"); err != nil {
+            return err
+        }
+    }
+    
     query := `
-        INSERT INTO Categories (CategoryName, Description)
+        INSERT INTO Categories (CategoryName, Description, ParentCategoryID, SortOrder, IsActive)
         OUTPUT INSERTED.CategoryID
-        VALUES (?, ?)
+        VALUES (?, ?, ?, ?, ?)
     `
     
-    err := s.db.QueryRow(query, category.CategoryName, category.Description).Scan(&category.CategoryID)
-    return err
+    err = tx.QueryRow(query, category.CategoryName, category.Description, category.ParentCategoryID,
+        category.SortOrder, *category.IsActive).Scan(&category.CategoryID)
+    if err != nil {
+        return err
+    }
+    
+    if err := writeAudit(tx, actor, AuditCategory, category.CategoryID, AuditCreate, nil, category); err != nil {
+        return err
+    }
+    
+    return tx.Commit()
 }
 
-func (s *CategoryService) UpdateCategory(category *models.Category) error {
+func (s *CategoryService) UpdateCategory(category *models.Category, actor *models.User) error {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+    
+    before, err := loadCategory(tx, category.CategoryID)
+    if err != nil {
+        return err
+    }
+    if category.IsActive == nil {
+        category.IsActive = before.IsActive
+    }
+    parentChanged := category.ParentCategoryID != nil &&
+        (before.ParentCategoryID == nil || *before.ParentCategoryID != *category.ParentCategoryID)
+    if parentChanged {
+        if err := checkCategoryParent(tx, category.CategoryID, *category.ParentCategoryID); err != nil {
+            return err
+        }
+        if err := checkNotArchived(tx, AuditCategory, *category.ParentCategoryID, "parent_category_id"); err != nil {
+            return err
+        }
+    }
+    category.ArchivedAt = before.ArchivedAt
+    
     query := `
         UPDATE Categories 
-        SET CategoryName = ?, Description = ?
+        SET CategoryName = ?, Description = ?, ParentCategoryID = ?, SortOrder = ?, IsActive = ?
         WHERE CategoryID = ?
     `
     
-    _, err := s.db.Exec(query, category.CategoryName, category.Description, category.CategoryID)
-    return err
+    result, err := tx.Exec(query, category.CategoryName, category.Description, category.ParentCategoryID,
+        category.SortOrder, *category.IsActive, category.CategoryID)
+    if err != nil {
+        return err
+    }
+    if err := checkAffected(result, "category", category.CategoryID); err != nil {
+        return err
+    }
+    
+    if err := writeAudit(tx, actor, AuditCategory, category.CategoryID, AuditUpdate, before, category); err != nil {
+        return err
+    }
+    
+    return tx.Commit()
 }
 
-func (s *CategoryService) DeleteCategory(categoryID int) error {
+func (s *CategoryService) DeleteCategory(categoryID int, actor *models.User) error {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+    
     // Check if category has items
     var count int
     checkQuery := `SELECT COUNT(*) FROM Items WHERE CategoryID = ?`
-    err := s.db.QueryRow(checkQuery, categoryID).Scan(&count)
+    err = tx.QueryRow(checkQuery, categoryID).Scan(&count)
     if err != nil {
         return err
     }
     
     if count > 0 {
-        return fmt.Errorf("cannot delete category: it has %d active items", count)
+        return ConflictError("cannot delete category: it has %d active items", count)
+    }
+    
+    err = tx.QueryRow(`SELECT COUNT(*) FROM Categories WHERE ParentCategoryID = ?`, categoryID).Scan(&count)
+    if err != nil {
+        return err
+    }
+    if count > 0 {
+        return ConflictError("cannot delete category: it has %d subcategories", count)
+    }
+    
+    before, err := loadCategory(tx, categoryID)
+    if err != nil {
+        return err
     }
     
     query := `DELETE FROM Categories WHERE CategoryID = ?`
-    _, err = s.db.Exec(query, categoryID)
-    return err
+    result, err := tx.Exec(query, categoryID)
+    if err != nil {
+        return err
+    }
+    if err := checkAffected(result, "category", categoryID); err != nil {
+        return err
+    }
+    
+    if err := writeAudit(tx, actor, AuditCategory, categoryID, AuditDelete, before, nil); err != nil {
+        return err
+    }
+    
+    return tx.Commit()
 }
 
 func (s *CategoryService) GetCategoryByID(categoryID int) (*models.Category, error) {
-    query := `SELECT CategoryID, CategoryName, Description FROM Categories WHERE CategoryID = ?`
+    return loadCategory(s.db, categoryID)
+}
+
+// loadCategory reads one category, locking the row when q is a transaction.
+func loadCategory(q querier, categoryID int) (*models.Category, error) {
+    rows, err := q.Query(`
+        SELECT CategoryID, CategoryName, Description, ParentCategoryID, SortOrder, IsActive, ArchivedAt
+        FROM Categories WITH (UPDLOCK) WHERE CategoryID = ?
+    `, categoryID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    
+    if !rows.Next() {
+        if err := rows.Err(); err != nil {
+            return nil, err
+        }
+        return nil, NotFoundError("category", categoryID)
+    }
     
+    return scanCategory(rows)
+}
+
+func scanCategory(rows *sql.Rows) (*models.Category, error) {
     var category models.Category
-    err := s.db.QueryRow(query, categoryID).Scan(
-        &category.CategoryID, &category.CategoryName, &category.Description,
-    )
+    var parentID sql.NullInt64
+    var active bool
+    var archivedAt sql.NullTime
+    err := rows.Scan(&category.CategoryID, &category.CategoryName, &category.Description,
+        &parentID, &category.SortOrder, &active, &archivedAt)
     if err != nil {
         return nil, err
     }
     
+    if parentID.Valid {
+        id := int(parentID.Int64)
+        category.ParentCategoryID = &id
+    }
+    category.IsActive = &active
+    if archivedAt.Valid {
+        category.ArchivedAt = &archivedAt.Time
+    }
+    
     return &category, nil
-}
\ No newline at end of file
+}
+
+// checkCategoryParent rejects a parent that would put a category inside its
+// own subtree.
+func checkCategoryParent(q querier, categoryID, parentID int) error {
+    var count int
+    err := q.QueryRow(`
+        WITH Ancestors AS (
+            SELECT CategoryID, ParentCategoryID FROM Categories WHERE CategoryID = ?
+            UNION ALL
+            SELECT c.CategoryID, c.ParentCategoryID
+            FROM Categories c JOIN Ancestors a ON c.CategoryID = a.ParentCategoryID
+        )
+        SELECT COUNT(*) FROM Ancestors WHERE CategoryID = ?
+    `, parentID, categoryID).Scan(&count)
+    if err != nil {
+        return err
+    }
+    if count > 0 {
+        return FieldError("parent_category_id", "must not be the category itself or one of its subcategories")
+    }
+    return nil
+}
+
+// GetPublicMenu returns the menu tree for customers: active categories and
+// visible items only, without costs.
+func (s *CategoryService) GetPublicMenu() ([]models.MenuCategory, error) {
+    tree, err := s.GetMenuTree(false)
+    if err != nil {
+        return nil, err
+    }
+    
+    var strip func([]models.MenuCategory)
+    strip = func(level []models.MenuCategory) {
+        for i := range level {
+            for j := range level[i].Items {
+                level[i].Items[j].FoodCost = nil
+                level[i].Items[j].MarginPercent = nil
+            }
+            strip(level[i].Subcategories)
+        }
+    }
+    strip(tree)
+    
+    return tree, nil
+}
+
+// GetMenuTree returns the categories as a tree with their items, both in
+// display order, for the till and the online menu. Unless includeHidden is
+// set, inactive categories with everything under them and hidden items are
+// left out. Items show the price a customer pays right now.
+func (s *CategoryService) GetMenuTree(includeHidden bool) ([]models.MenuCategory, error) {
+    var categories []models.Category
+    if err := s.EachCategory(false, func(category models.Category) error {
+        categories = append(categories, category)
+        return nil
+    }); err != nil {
+        return nil, err
+    }
+    
+    rules, err := loadPriceRules(s.db)
+    if err != nil {
+        return nil, err
+    }
+    now := time.Now()
+    
+    itemsByCategory := make(map[int][]models.Item)
+    items := &ItemService{db: s.db}
+    err = items.EachItem(models.ItemFilter{}, func(item models.Item) error {
+        if item.Availability == ItemHidden && !includeHidden {
+            return nil
+        }
+        if price, ruleID := rules.priceAt(item.ItemID, item.CategoryID, item.BasePrice, now); ruleID != nil {
+            item.ActivePrice = &price
+            item.ActivePriceRuleID = ruleID
+        }
+        item.Category = nil
+        itemsByCategory[item.CategoryID] = append(itemsByCategory[item.CategoryID], item)
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    
+    // Items arrive by name, so a stable sort keeps names in order within a position
+    for _, list := range itemsByCategory {
+        sort.SliceStable(list, func(i, j int) bool {
+            return list[i].SortOrder < list[j].SortOrder
+        })
+    }
+    
+    children := make(map[int][]models.Category)
+    var roots []models.Category
+    for _, category := range categories {
+        if category.ParentCategoryID == nil {
+            roots = append(roots, category)
+        } else {
+            children[*category.ParentCategoryID] = append(children[*category.ParentCategoryID], category)
+        }
+    }
+    
+    var build func([]models.Category) []models.MenuCategory
+    build = func(level []models.Category) []models.MenuCategory {
+        tree := []models.MenuCategory{}
+        for _, category := range level {
+            if !*category.IsActive && !includeHidden {
+                continue
+            }
+            node := models.MenuCategory{
+                Category:      category,
+                Items:         itemsByCategory[category.CategoryID],
+                Subcategories: build(children[category.CategoryID]),
+            }
+            if node.Items == nil {
+                node.Items = []models.Item{}
+            }
+            tree = append(tree, node)
+        }
+        return tree
+    }
+    
+    return build(roots), nil
+}
@@ -2,7 +2,6 @@ package services
 
 import (
     "database/sql"
-    "fmt"
     "backend/models"
     "backend/database"
 )
@@ -17,83 +16,214 @@ func NewCustomerService() *CustomerService {
     }
 }
 
+var customerSortColumns = map[string]string{
+    "customer_name": "CustomerName",
+    "customer_id":   "CustomerID",
+    "email":         "Email",
+    "phone":         "Phone",
+}
+
 func (s *CustomerService) GetAllCustomers() ([]models.Customer, error) {
-    query := `SELECT CustomerID, CustomerName, Phone, Email, Address FROM Customers ORDER BY CustomerName`
-    
-    rows, err := s.db.Query(query)
+    var customers []models.Customer
+    err := s.EachCustomer(models.CustomerFilter{}, func(customer models.Customer) error {
+        customers = append(customers, customer)
+        return nil
+    })
     if err != nil {
         return nil, err
     }
+    
+    return customers, nil
+}
+
+// ListCustomers returns one page of customers matching the filter and the total number of matches.
+func (s *CustomerService) ListCustomers(filter models.CustomerFilter) ([]models.Customer, int, error) {
+    var total int
+    q := customerListQuery(filter)
+    err := s.db.QueryRow(`SELECT COUNT(*) FROM Customers `+q.clause(), q.args...).Scan(&total)
+    if err != nil {
+        return nil, 0, err
+    }
+    
+    customers := []models.Customer{}
+    err = s.EachCustomer(filter, func(customer models.Customer) error {
+        customers = append(customers, customer)
+        return nil
+    })
+    if err != nil {
+        return nil, 0, err
+    }
+    
+    return customers, total, nil
+}
+
+func customerListQuery(filter models.CustomerFilter) *listQuery {
+    q := &listQuery{}
+    q.search(filter.Search, "CustomerName", "Phone", "Email")
+    if !filter.IncludeArchived {
+        q.where("ArchivedAt IS NULL")
+    }
+    return q
+}
+
+// EachCustomer streams the customers matching the filter to fn without
+// holding the full list in memory.
+func (s *CustomerService) EachCustomer(filter models.CustomerFilter, fn func(models.Customer) error) error {
+    q := customerListQuery(filter)
+    order, err := orderAndPage(filter.ListParams, customerSortColumns, "CustomerName, CustomerID", "CustomerID")
+    if err != nil {
+        return err
+    }
+    
+    query := `SELECT CustomerID, CustomerName, Phone, Email, Address, ArchivedAt FROM Customers ` + q.clause() + ` ` + order
+    
+    rows, err := s.db.Query(query, q.args...)
+    if err != nil {
+        return err
+    }
     defer rows.Close()
     
-    var customers []models.Customer
     for rows.Next() {
         var customer models.Customer
         var phone, email, address sql.NullString
+        var archivedAt sql.NullTime
         
-        err := rows.Scan(&customer.CustomerID, &customer.CustomerName, &phone, &email, &address)
+        err := rows.Scan(&customer.CustomerID, &customer.CustomerName, &phone, &email, &address, &archivedAt)
         if err != nil {
-            return nil, err
+            return err
         }
         
         customer.Phone = phone.String
         customer.Email = email.String
         customer.Address = address.String
-        customers = append(customers, customer)
+        if archivedAt.Valid {
+            customer.ArchivedAt = &archivedAt.Time
+        }
+        if err := fn(customer); err != nil {
+            return err
+        }
     }
     
-    return customers, nil
+    return rows.Err()
 }
 
-func (s *CustomerService) CreateCustomer(customer *models.Customer) error {
+func (s *CustomerService) CreateCustomer(customer *models.Customer, actor *models.User) error {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+    
     query := `
         INSERT INTO Customers (CustomerName, Phone, Email, Address)
         OUTPUT INSERTED.CustomerID
         VALUES (?, ?, ?, ?)
     `
     
-    err := s.db.QueryRow(query, customer.CustomerName, customer.Phone, customer.Email, customer.Address).Scan(&customer.CustomerID)
-    return err
+    err = tx.QueryRow(query, customer.CustomerName, customer.Phone, customer.Email, customer.Address).Scan(&customer.CustomerID)
+    if err != nil {
+        return err
+    }
+    
+    if err := writeAudit(tx, actor, AuditCustomer, customer.CustomerID, AuditCreate, nil, customer); err != nil {
+        return err
+    }
+    
+    return tx.Commit()
 }
 
-func (s *CustomerService) UpdateCustomer(customer *models.Customer) error {
+func (s *CustomerService) UpdateCustomer(customer *models.Customer, actor *models.User) error {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+    
+    before, err := loadCustomer(tx, customer.CustomerID)
+    if err != nil {
+        return err
+    }
+    
     query := `
         UPDATE Customers 
         SET CustomerName = ?, Phone = ?, Email = ?, Address = ?
         WHERE CustomerID = ?
     `
     
-    _, err := s.db.Exec(query, customer.CustomerName, customer.Phone, customer.Email, customer.Address, customer.CustomerID)
-    return err
+    result, err := tx.Exec(query, customer.CustomerName, customer.Phone, customer.Email, customer.Address, customer.CustomerID)
+    if err != nil {
+        return err
+    }
+    if err := checkAffected(result, "customer", customer.CustomerID); err != nil {
+        return err
+    }
+    customer.ArchivedAt = before.ArchivedAt
+    
+    if err := writeAudit(tx, actor, AuditCustomer, customer.CustomerID, AuditUpdate, before, customer); err != nil {
+        return err
+    }
+    
+    return tx.Commit()
 }
 
-func (s *CustomerService) DeleteCustomer(customerID int) error {
+func (s *CustomerService) DeleteCustomer(customerID int, actor *models.User) error {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+    
     // Check if customer has invoices
     var count int
     checkQuery := `SELECT COUNT(*) FROM Invoices WHERE CustomerID = ?`
-    err := s.db.QueryRow(checkQuery, customerID).Scan(&count)
+    err = tx.QueryRow(checkQuery, customerID).Scan(&count)
     if err != nil {
         return err
     }
     
     if count > 0 {
-        return fmt.Errorf("cannot delete customer: they have %d invoices", count)
+        return ConflictError("cannot delete customer: they have %d invoices; archive them instead", count)
+    }
+    
+    before, err := loadCustomer(tx, customerID)
+    if err != nil {
+        return err
     }
     
     query := `DELETE FROM Customers WHERE CustomerID = ?`
-    _, err = s.db.Exec(query, customerID)
-    return err
+    result, err := tx.Exec(query, customerID)
+    if err != nil {
+        return err
+    }
+    if err := checkAffected(result, "customer", customerID); err != nil {
+        return err
+    }
+    
+    if err := writeAudit(tx, actor, AuditCustomer, customerID, AuditDelete, before, nil); err != nil {
+        return err
+    }
+    
+    return tx.Commit()
 }
 
 func (s *CustomerService) GetCustomerByID(customerID int) (*models.Customer, error) {
-    query := `SELECT CustomerID, CustomerName, Phone, Email, Address FROM Customers WHERE CustomerID = ?`
+    return loadCustomer(s.db, customerID)
+}
+
+// loadCustomer reads one customer, locking the row when q is a transaction.
+func loadCustomer(q querier, customerID int) (*models.Customer, error) {
+    query := `SELECT CustomerID, CustomerName, Phone, Email, Address, ArchivedAt FROM Customers WITH (UPDLOCK) WHERE CustomerID = ?`
     
     var customer models.Customer
     var phone, email, address sql.NullString
+    var archivedAt sql.NullTime
     
-    err := s.db.QueryRow(query, customerID).Scan(
-        &customer.CustomerID, &customer.CustomerName, &phone, &email, &address,
+    err := q.QueryRow(query, customerID).Scan(
+        &customer.CustomerID, &customer.CustomerName, &phone, &email, &address, &archivedAt,
     )
+    if err == sql.ErrNoRows {
+        return nil, NotFoundError("customer", customerID)
+    }
     if err != nil {
         return nil, err
     }
@@ -101,6 +231,9 @@ func (s *CustomerService) GetCustomerByID(customerID int) (*models.Customer, err
     customer.Phone = phone.String
     customer.Email = email.String
     customer.Address = address.String
+    if archivedAt.Valid {
+        customer.ArchivedAt = &archivedAt.Time
+    }
     
     return &customer, nil
-}
\ No newline at end of file
+}
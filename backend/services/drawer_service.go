@@ -0,0 +1,83 @@
+package services
+
+import (
+    "database/sql"
+    "time"
+    "backend/models"
+    "backend/database"
+)
+
+// DrawerService records openings of the cash drawer outside a sale. The till
+// opens the drawer once the no-sale is recorded.
+type DrawerService struct {
+    db *sql.DB
+}
+
+func NewDrawerService() *DrawerService {
+    return &DrawerService{
+        db: database.GetDB(),
+    }
+}
+
+// OpenDrawer records a no-sale. Users without PermOpenDrawer need a manager's
+// approval, which is recorded with it.
+func (s *DrawerService) OpenDrawer(req *models.NoSaleRequest, actor *models.User) (*models.NoSale, error) {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    approvalID, err := authorizeAction(tx, actor, PermOpenDrawer, ApprovalOpenDrawer, req.ApprovalToken, nil)
+    if err != nil {
+        return nil, err
+    }
+
+    noSale := &models.NoSale{UserID: actor.UserID, Username: actor.Username, ApprovalID: approvalID, Reason: req.Reason}
+    err = tx.QueryRow(`
+        INSERT INTO NoSales (UserID, ApprovalID, Reason)
+        OUTPUT INSERTED.NoSaleID, INSERTED.OpenedAt
+        VALUES (?, ?, ?)
+    `, actor.UserID, approvalID, req.Reason).Scan(&noSale.NoSaleID, &noSale.OpenedAt)
+    if err != nil {
+        return nil, err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+
+    return noSale, nil
+}
+
+// GetNoSales lists the no-sales in [from, to), newest first.
+func (s *DrawerService) GetNoSales(from, to time.Time) ([]models.NoSale, error) {
+    rows, err := s.db.Query(`
+        SELECT n.NoSaleID, n.UserID, u.Username, n.ApprovalID, n.Reason, n.OpenedAt
+        FROM NoSales n
+        JOIN Users u ON n.UserID = u.UserID
+        WHERE n.OpenedAt >= ? AND n.OpenedAt < ?
+        ORDER BY n.OpenedAt DESC, n.NoSaleID DESC
+    `, from, to)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    noSales := []models.NoSale{}
+    for rows.Next() {
+        var noSale models.NoSale
+        var approvalID sql.NullInt64
+        err := rows.Scan(&noSale.NoSaleID, &noSale.UserID, &noSale.Username, &approvalID, &noSale.Reason, &noSale.OpenedAt)
+        if err != nil {
+            return nil, err
+        }
+        if approvalID.Valid {
+            id := int(approvalID.Int64)
+            noSale.ApprovalID = &id
+        }
+        noSales = append(noSales, noSale)
+    }
+
+    return noSales, rows.Err()
+}
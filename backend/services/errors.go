@@ -0,0 +1,77 @@
+package services
+
+import (
+    "database/sql"
+    "fmt"
+)
+
+// Error codes returned to clients. The controllers map each code to an HTTP status.
+const (
+    CodeInvalidRequest   = "invalid_request"
+    CodeUnauthorized     = "unauthorized"
+    CodeForbidden        = "forbidden"
+    CodeNotFound         = "not_found"
+    CodeValidationFailed = "validation_failed"
+    CodeConflict         = "conflict"
+    CodeConstraint       = "constraint_violation"
+)
+
+// AppError is a domain error that is safe to show to API clients.
+type AppError struct {
+    Code    string            `json:"code"`
+    Message string            `json:"message"`
+    Fields  map[string]string `json:"fields,omitempty"`
+}
+
+func (e *AppError) Error() string {
+    return e.Message
+}
+
+// NotFoundError reports a missing record, e.g. NotFoundError("invoice", 7).
+func NotFoundError(entity string, id int) *AppError {
+    return &AppError{Code: CodeNotFound, Message: fmt.Sprintf("%s %d not found", entity, id)}
+}
+
+// ValidationError reports invalid input. fields maps field names to messages
+// and may be nil when the problem is not tied to a single field.
+func ValidationError(message string, fields map[string]string) *AppError {
+    return &AppError{Code: CodeValidationFailed, Message: message, Fields: fields}
+}
+
+// FieldError reports a single invalid field.
+func FieldError(field, message string) *AppError {
+    return ValidationError(fmt.Sprintf("%s %s", field, message), map[string]string{field: message})
+}
+
+// ConflictError reports a request that clashes with the current state, such
+// as deleting a record that is still referenced.
+func ConflictError(format string, args ...interface{}) *AppError {
+    return &AppError{Code: CodeConflict, Message: fmt.Sprintf(format, args...)}
+}
+
+// ConstraintError reports a change rejected by a database constraint.
+func ConstraintError(message string) *AppError {
+    return &AppError{Code: CodeConstraint, Message: message}
+}
+
+// UnauthorizedError reports missing or invalid credentials.
+func UnauthorizedError(message string) *AppError {
+    return &AppError{Code: CodeUnauthorized, Message: message}
+}
+
+// ForbiddenError reports an action the signed-in user's role does not allow.
+func ForbiddenError(perm Permission) *AppError {
+    return &AppError{Code: CodeForbidden, Message: fmt.Sprintf("you do not have permission to perform this action (%s)", perm)}
+}
+
+// checkAffected turns an UPDATE or DELETE that matched no rows into a not found error.
+func checkAffected(result sql.Result, entity string, id int) error {
+    affected, err := result.RowsAffected()
+    if err != nil {
+        return err
+    }
+    if affected == 0 {
+        return NotFoundError(entity, id)
+    }
+    return nil
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+    "sync"
+    "time"
+    "backend/models"
+)
+
+// Event types published on the event stream.
+const (
+    EventStockLow      = "stock.low"
+    EventStockRestored = "stock.restored"
+)
+
+// eventBuffer is how many events a slow subscriber may fall behind before
+// further events are dropped for it.
+const eventBuffer = 32
+
+// Event is a notification sent to connected clients. Only users whose role
+// grants Permission receive it.
+type Event struct {
+    Type       string      `json:"type"`
+    Data       interface{} `json:"data"`
+    OccurredAt time.Time   `json:"occurred_at"`
+    Permission Permission  `json:"-"`
+}
+
+// EventBroker fans events out to the clients connected to the event stream.
+// Events are not stored; a client only sees what is published while it is
+// connected.
+type EventBroker struct {
+    mu          sync.Mutex
+    subscribers map[chan Event]*models.User
+}
+
+func NewEventBroker() *EventBroker {
+    return &EventBroker{
+        subscribers: make(map[chan Event]*models.User),
+    }
+}
+
+// Subscribe returns a channel receiving the events user may see. It must be
+// released with Unsubscribe.
+func (b *EventBroker) Subscribe(user *models.User) chan Event {
+    ch := make(chan Event, eventBuffer)
+    b.mu.Lock()
+    b.subscribers[ch] = user
+    b.mu.Unlock()
+    return ch
+}
+
+func (b *EventBroker) Unsubscribe(ch chan Event) {
+    b.mu.Lock()
+    delete(b.subscribers, ch)
+    b.mu.Unlock()
+}
+
+// Publish sends an event to every subscriber allowed to see it without
+// blocking on slow clients.
+func (b *EventBroker) Publish(eventType string, perm Permission, data interface{}) {
+    event := Event{Type: eventType, Data: data, OccurredAt: time.Now(), Permission: perm}
+
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    for ch, user := range b.subscribers {
+        if !HasPermission(user, perm) {
+            continue
+        }
+        select {
+        case ch <- event:
+        default:
+        }
+    }
+}
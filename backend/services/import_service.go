@@ -0,0 +1,381 @@
+package services
+
+import (
+    "database/sql"
+    "fmt"
+    "net/mail"
+    "strconv"
+    "strings"
+    "time"
+    "backend/models"
+    "backend/database"
+)
+
+type ImportService struct {
+    db *sql.DB
+}
+
+func NewImportService() *ImportService {
+    return &ImportService{
+        db: database.GetDB(),
+    }
+}
+
+// importSheet gives access to the cells of uploaded rows by header name.
+type importSheet struct {
+    columns map[string]int
+    rows    [][]string
+}
+
+func newImportSheet(rows [][]string, required ...string) (*importSheet, error) {
+    if len(rows) == 0 {
+        return nil, ValidationError("file is empty", nil)
+    }
+
+    sheet := &importSheet{columns: make(map[string]int), rows: rows[1:]}
+    for i, name := range rows[0] {
+        key := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), " ", "_")
+        if key != "" {
+            sheet.columns[key] = i
+        }
+    }
+
+    for _, name := range required {
+        if _, ok := sheet.columns[name]; !ok {
+            return nil, FieldError(name, "column is missing from the file")
+        }
+    }
+
+    return sheet, nil
+}
+
+func (s *importSheet) get(row []string, names ...string) string {
+    for _, name := range names {
+        if i, ok := s.columns[name]; ok && i < len(row) && row[i] != "" {
+            return row[i]
+        }
+    }
+    return ""
+}
+
+func isBlankRow(row []string) bool {
+    for _, v := range row {
+        if v != "" {
+            return false
+        }
+    }
+    return true
+}
+
+// finishImport commits the transaction only when every row was valid and this
+// is not a dry run; otherwise all changes are rolled back.
+func finishImport(tx *sql.Tx, report *models.ImportReport) error {
+    if report.DryRun || report.Failed > 0 {
+        return tx.Rollback()
+    }
+
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+    report.Applied = true
+    return nil
+}
+
+// ImportItems creates or updates menu items from spreadsheet rows. Rows are
+// matched to existing items by item_id, or by item_name when no id is given.
+// Categories are resolved by name and, if createCategories is set, created
+// when missing. All rows are applied in a single transaction and each change
+// is audited as an import by actor.
+func (s *ImportService) ImportItems(rows [][]string, dryRun, createCategories bool, actor *models.User) (*models.ImportReport, error) {
+    sheet, err := newImportSheet(rows, "item_name", "base_price")
+    if err != nil {
+        return nil, err
+    }
+
+    tx, err := s.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    report := &models.ImportReport{DryRun: dryRun, Rows: []models.ImportRowResult{}}
+    categoryIDs := make(map[string]int)
+
+    for i, row := range sheet.rows {
+        if isBlankRow(row) {
+            continue
+        }
+
+        // Row numbers match the spreadsheet, counting the header as row 1
+        result := models.ImportRowResult{Row: i + 2}
+        var item models.Item
+
+        item.ItemName = sheet.get(row, "item_name")
+        item.Description = sheet.get(row, "description")
+        result.Name = item.ItemName
+
+        if item.ItemName == "" {
+            result.Errors = append(result.Errors, "item_name is required")
+        }
+
+        price, err := strconv.ParseFloat(sheet.get(row, "base_price"), 64)
+        if err != nil {
+            result.Errors = append(result.Errors, "base_price must be a number")
+        } else if price < 0 {
+            result.Errors = append(result.Errors, "base_price must not be negative")
+        }
+        item.BasePrice = price
+
+        categoryName := sheet.get(row, "category_name", "category")
+        if categoryName == "" {
+            result.Errors = append(result.Errors, "category_name is required")
+        } else {
+            key := strings.ToLower(categoryName)
+            categoryID, ok := categoryIDs[key]
+            if !ok {
+                // An active category wins over an archived one of the same name
+                err := tx.QueryRow(`
+                    SELECT TOP 1 CategoryID FROM Categories WHERE CategoryName = ?
+                    ORDER BY CASE WHEN ArchivedAt IS NULL THEN 0 ELSE 1 END, CategoryID
+                `, categoryName).Scan(&categoryID)
+                var archived bool
+                if err == nil {
+                    archived, err = isArchived(tx, AuditCategory, categoryID)
+                }
+                switch {
+                case err == nil && archived:
+                    // Nothing new is placed in an archived category, as with CreateItem
+                    result.Errors = append(result.Errors, fmt.Sprintf("category %q is archived", categoryName))
+                case err == sql.ErrNoRows && createCategories:
+                    err = tx.QueryRow(`
+                        INSERT INTO Categories (CategoryName, Description)
+                        OUTPUT INSERTED.CategoryID
+                        VALUES (?, ?)
+                    `, categoryName, "").Scan(&categoryID)
+                    if err != nil {
+                        return nil, err
+                    }
+                    created := models.Category{CategoryID: categoryID, CategoryName: categoryName}
+                    if err := writeAudit(tx, actor, AuditCategory, categoryID, AuditImport, nil, created); err != nil {
+                        return nil, err
+                    }
+                    report.CategoriesCreated = append(report.CategoriesCreated, categoryName)
+                    categoryIDs[key] = categoryID
+                    ok = true
+                case err == sql.ErrNoRows:
+                    result.Errors = append(result.Errors, fmt.Sprintf("category %q does not exist", categoryName))
+                case err != nil:
+                    return nil, err
+                default:
+                    categoryIDs[key] = categoryID
+                    ok = true
+                }
+            }
+            if ok {
+                item.CategoryID = categoryID
+            }
+        }
+
+        if v := sheet.get(row, "item_id"); v != "" {
+            id, err := strconv.Atoi(v)
+            if err != nil {
+                result.Errors = append(result.Errors, "item_id must be a whole number")
+            } else {
+                var exists, archived int
+                err := tx.QueryRow(`
+                    SELECT COUNT(*), COUNT(ArchivedAt) FROM Items WHERE ItemID = ?
+                `, id).Scan(&exists, &archived)
+                if err != nil {
+                    return nil, err
+                }
+                if exists == 0 {
+                    result.Errors = append(result.Errors, fmt.Sprintf("item %d does not exist", id))
+                }
+                if archived > 0 {
+                    result.Errors = append(result.Errors, fmt.Sprintf("item %d is archived; restore it first", id))
+                }
+                item.ItemID = id
+            }
+        } else if item.ItemName != "" {
+            // Archived items are never matched by name, so their history stays as it was
+            err := tx.QueryRow(`SELECT ItemID FROM Items WHERE ItemName = ? AND ArchivedAt IS NULL`, item.ItemName).Scan(&item.ItemID)
+            if err != nil && err != sql.ErrNoRows {
+                return nil, err
+            }
+        }
+
+        if len(result.Errors) > 0 {
+            result.Action = "error"
+            report.Failed++
+            report.Rows = append(report.Rows, result)
+            continue
+        }
+
+        var before *models.Item
+        priceChanged := true
+        if item.ItemID == 0 {
+            err = tx.QueryRow(`
+                INSERT INTO Items (ItemName, CategoryID, BasePrice, Description)
+                OUTPUT INSERTED.ItemID
+                VALUES (?, ?, ?, ?)
+            `, item.ItemName, item.CategoryID, item.BasePrice, item.Description).Scan(&item.ItemID)
+            result.Action = "create"
+            report.Created++
+        } else {
+            if before, err = loadItem(tx, item.ItemID); err != nil {
+                return nil, err
+            }
+            priceChanged = before.BasePrice != item.BasePrice
+            _, err = tx.Exec(`
+                UPDATE Items
+                SET ItemName = ?, CategoryID = ?, BasePrice = ?, Description = ?
+                WHERE ItemID = ?
+            `, item.ItemName, item.CategoryID, item.BasePrice, item.Description, item.ItemID)
+            result.Action = "update"
+            report.Updated++
+        }
+        if err != nil {
+            return nil, err
+        }
+        if priceChanged {
+            if _, err := schedulePrice(tx, item.ItemID, item.BasePrice, time.Now(), actor); err != nil {
+                return nil, err
+            }
+        }
+        if err := writeAudit(tx, actor, AuditItem, item.ItemID, AuditImport, before, item); err != nil {
+            return nil, err
+        }
+
+        result.ID = item.ItemID
+        report.Rows = append(report.Rows, result)
+    }
+
+    if err := finishImport(tx, report); err != nil {
+        return nil, err
+    }
+
+    return report, nil
+}
+
+// ImportCustomers creates or updates customers from spreadsheet rows. Rows are
+// matched to existing customers by customer_id, then by email, then by phone.
+// All rows are applied in a single transaction and each change is audited as
+// an import by actor.
+func (s *ImportService) ImportCustomers(rows [][]string, dryRun bool, actor *models.User) (*models.ImportReport, error) {
+    sheet, err := newImportSheet(rows, "customer_name")
+    if err != nil {
+        return nil, err
+    }
+
+    tx, err := s.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    report := &models.ImportReport{DryRun: dryRun, Rows: []models.ImportRowResult{}}
+
+    for i, row := range sheet.rows {
+        if isBlankRow(row) {
+            continue
+        }
+
+        result := models.ImportRowResult{Row: i + 2}
+        var customer models.Customer
+
+        customer.CustomerName = sheet.get(row, "customer_name", "name")
+        customer.Phone = sheet.get(row, "phone")
+        customer.Email = sheet.get(row, "email")
+        customer.Address = sheet.get(row, "address")
+        result.Name = customer.CustomerName
+
+        if customer.CustomerName == "" {
+            result.Errors = append(result.Errors, "customer_name is required")
+        }
+
+        if customer.Email != "" {
+            if _, err := mail.ParseAddress(customer.Email); err != nil {
+                result.Errors = append(result.Errors, fmt.Sprintf("email %q is not a valid address", customer.Email))
+            }
+        }
+
+        if v := sheet.get(row, "customer_id"); v != "" {
+            id, err := strconv.Atoi(v)
+            if err != nil {
+                result.Errors = append(result.Errors, "customer_id must be a whole number")
+            } else {
+                var exists, archived int
+                err := tx.QueryRow(`
+                    SELECT COUNT(*), COUNT(ArchivedAt) FROM Customers WHERE CustomerID = ?
+                `, id).Scan(&exists, &archived)
+                if err != nil {
+                    return nil, err
+                }
+                if exists == 0 {
+                    result.Errors = append(result.Errors, fmt.Sprintf("customer %d does not exist", id))
+                }
+                if archived > 0 {
+                    result.Errors = append(result.Errors, fmt.Sprintf("customer %d is archived; restore it first", id))
+                }
+                customer.CustomerID = id
+            }
+        } else {
+            if customer.Email != "" {
+                err := tx.QueryRow(`SELECT TOP 1 CustomerID FROM Customers WHERE Email = ? AND ArchivedAt IS NULL`, customer.Email).Scan(&customer.CustomerID)
+                if err != nil && err != sql.ErrNoRows {
+                    return nil, err
+                }
+            }
+            if customer.CustomerID == 0 && customer.Phone != "" {
+                err := tx.QueryRow(`SELECT TOP 1 CustomerID FROM Customers WHERE Phone = ? AND ArchivedAt IS NULL`, customer.Phone).Scan(&customer.CustomerID)
+                if err != nil && err != sql.ErrNoRows {
+                    return nil, err
+                }
+            }
+        }
+
+        if len(result.Errors) > 0 {
+            result.Action = "error"
+            report.Failed++
+            report.Rows = append(report.Rows, result)
+            continue
+        }
+
+        var before *models.Customer
+        if customer.CustomerID == 0 {
+            err = tx.QueryRow(`
+                INSERT INTO Customers (CustomerName, Phone, Email, Address)
+                OUTPUT INSERTED.CustomerID
+                VALUES (?, ?, ?, ?)
+            `, customer.CustomerName, customer.Phone, customer.Email, customer.Address).Scan(&customer.CustomerID)
+            result.Action = "create"
+            report.Created++
+        } else {
+            if before, err = loadCustomer(tx, customer.CustomerID); err != nil {
+                return nil, err
+            }
+            _, err = tx.Exec(`
+                UPDATE Customers
+                SET CustomerName = ?, Phone = ?, Email = ?, Address = ?
+                WHERE CustomerID = ?
+            `, customer.CustomerName, customer.Phone, customer.Email, customer.Address, customer.CustomerID)
+            result.Action = "update"
+            report.Updated++
+        }
+        if err != nil {
+            return nil, err
+        }
+        if err := writeAudit(tx, actor, AuditCustomer, customer.CustomerID, AuditImport, before, customer); err != nil {
+            return nil, err
+        }
+
+        result.ID = customer.CustomerID
+        report.Rows = append(report.Rows, result)
+    }
+
+    if err := finishImport(tx, report); err != nil {
+        return nil, err
+    }
+
+    return report, nil
+}
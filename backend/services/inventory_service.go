@@ -0,0 +1,653 @@
+package services
+
+import (
+    "database/sql"
+    "sort"
+    "strings"
+    "backend/models"
+    "backend/database"
+)
+
+// Reasons recorded on stock movements. Quantities are negative when stock
+// leaves and positive when it comes back.
+const (
+    MovementSale       = "sale"
+    MovementVoid       = "void"
+    MovementAdjustment = "adjustment"
+    MovementReceipt    = "receipt"
+    MovementWastage    = "wastage"
+    MovementStockTake  = "stocktake"
+)
+
+var movementSortColumns = map[string]string{
+    "occurred_at":     "m.OccurredAt",
+    "ingredient_name": "g.Name",
+    "quantity":        "m.Quantity",
+    "movement_id":     "m.MovementID",
+}
+
+type InventoryService struct {
+    db *sql.DB
+}
+
+func NewInventoryService() *InventoryService {
+    return &InventoryService{
+        db: database.GetDB(),
+    }
+}
+
+func (s *InventoryService) GetAllIngredients() ([]models.Ingredient, error) {
+    rows, err := s.db.Query(`SELECT IngredientID, Name, Unit, OnHand, ReorderPoint, UnitCost FROM Ingredients ORDER BY Name`)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    ingredients := []models.Ingredient{}
+    for rows.Next() {
+        ingredient, err := scanIngredient(rows)
+        if err != nil {
+            return nil, err
+        }
+        ingredients = append(ingredients, *ingredient)
+    }
+
+    return ingredients, rows.Err()
+}
+
+// CreateIngredient adds an ingredient with no stock. Stock is added through
+// movements so every change to the on-hand quantity is traceable.
+func (s *InventoryService) CreateIngredient(ingredient *models.Ingredient, actor *models.User) error {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    ingredient.OnHand = 0
+    err = tx.QueryRow(`
+        INSERT INTO Ingredients (Name, Unit, ReorderPoint, UnitCost)
+        OUTPUT INSERTED.IngredientID
+        VALUES (?, ?, ?, ?)
+    `, ingredient.Name, ingredient.Unit, ingredient.ReorderPoint, ingredient.UnitCost).Scan(&ingredient.IngredientID)
+    if err != nil {
+        return err
+    }
+
+    if err := writeAudit(tx, actor, AuditIngredient, ingredient.IngredientID, AuditCreate, nil, ingredient); err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+// UpdateIngredient changes an ingredient's name, unit, reorder point and unit
+// cost. The on-hand quantity is not changed.
+func (s *InventoryService) UpdateIngredient(ingredient *models.Ingredient, actor *models.User) error {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    before, err := loadIngredient(tx, ingredient.IngredientID)
+    if err != nil {
+        return err
+    }
+
+    _, err = tx.Exec(`
+        UPDATE Ingredients SET Name = ?, Unit = ?, ReorderPoint = ?, UnitCost = ?
+        WHERE IngredientID = ?
+    `, ingredient.Name, ingredient.Unit, ingredient.ReorderPoint, ingredient.UnitCost, ingredient.IngredientID)
+    if err != nil {
+        return err
+    }
+    ingredient.OnHand = before.OnHand
+
+    if err := writeAudit(tx, actor, AuditIngredient, ingredient.IngredientID, AuditUpdate, before, ingredient); err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+func (s *InventoryService) DeleteIngredient(ingredientID int, actor *models.User) error {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    before, err := loadIngredient(tx, ingredientID)
+    if err != nil {
+        return err
+    }
+
+    var recipes, movements, documents int
+    err = tx.QueryRow(`
+        SELECT (SELECT COUNT(*) FROM RecipeLines WHERE IngredientID = ?),
+               (SELECT COUNT(*) FROM StockMovements WHERE IngredientID = ?),
+               (SELECT COUNT(*) FROM PurchaseOrderLines WHERE IngredientID = ?)
+                 + (SELECT COUNT(*) FROM StockTakeLines WHERE IngredientID = ?)
+    `, ingredientID, ingredientID, ingredientID, ingredientID).Scan(&recipes, &movements, &documents)
+    if err != nil {
+        return err
+    }
+    if recipes > 0 {
+        return ConflictError("cannot delete ingredient: it is used in %d recipes", recipes)
+    }
+    if movements > 0 {
+        return ConflictError("cannot delete ingredient: it has %d stock movements", movements)
+    }
+    if documents > 0 {
+        return ConflictError("cannot delete ingredient: it appears on %d purchase orders or stock takes", documents)
+    }
+
+    if _, err := tx.Exec(`DELETE FROM Ingredients WHERE IngredientID = ?`, ingredientID); err != nil {
+        return err
+    }
+
+    if err := writeAudit(tx, actor, AuditIngredient, ingredientID, AuditDelete, before, nil); err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+func (s *InventoryService) GetIngredientByID(ingredientID int) (*models.Ingredient, error) {
+    return loadIngredient(s.db, ingredientID)
+}
+
+func loadIngredient(q querier, ingredientID int) (*models.Ingredient, error) {
+    rows, err := q.Query(`
+        SELECT IngredientID, Name, Unit, OnHand, ReorderPoint, UnitCost
+        FROM Ingredients WITH (UPDLOCK) WHERE IngredientID = ?
+    `, ingredientID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    if !rows.Next() {
+        if err := rows.Err(); err != nil {
+            return nil, err
+        }
+        return nil, NotFoundError("ingredient", ingredientID)
+    }
+    return scanIngredient(rows)
+}
+
+func scanIngredient(rows *sql.Rows) (*models.Ingredient, error) {
+    var ingredient models.Ingredient
+    var reorderPoint, unitCost sql.NullFloat64
+    err := rows.Scan(&ingredient.IngredientID, &ingredient.Name, &ingredient.Unit, &ingredient.OnHand, &reorderPoint, &unitCost)
+    if err != nil {
+        return nil, err
+    }
+    if reorderPoint.Valid {
+        ingredient.ReorderPoint = &reorderPoint.Float64
+    }
+    if unitCost.Valid {
+        ingredient.UnitCost = &unitCost.Float64
+    }
+
+    return &ingredient, nil
+}
+
+// GetRecipe returns the ingredients used to make one of an item.
+func (s *InventoryService) GetRecipe(itemID int) ([]models.RecipeLine, error) {
+    if _, err := loadItem(s.db, itemID); err != nil {
+        return nil, err
+    }
+    return loadRecipe(s.db, itemID)
+}
+
+func loadRecipe(q querier, itemID int) ([]models.RecipeLine, error) {
+    rows, err := q.Query(`
+        SELECT r.IngredientID, g.Name, g.Unit, r.Quantity
+        FROM RecipeLines r
+        JOIN Ingredients g ON r.IngredientID = g.IngredientID
+        WHERE r.ItemID = ?
+        ORDER BY g.Name
+    `, itemID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    lines := []models.RecipeLine{}
+    for rows.Next() {
+        var line models.RecipeLine
+        if err := rows.Scan(&line.IngredientID, &line.IngredientName, &line.Unit, &line.Quantity); err != nil {
+            return nil, err
+        }
+        lines = append(lines, line)
+    }
+
+    return lines, rows.Err()
+}
+
+// SetRecipe replaces an item's recipe. An empty list removes it, after which
+// sales of the item no longer deduct stock.
+func (s *InventoryService) SetRecipe(itemID int, lines []models.RecipeLine, actor *models.User) ([]models.RecipeLine, error) {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    if _, err := loadItem(tx, itemID); err != nil {
+        return nil, err
+    }
+    before, err := loadRecipe(tx, itemID)
+    if err != nil {
+        return nil, err
+    }
+
+    if _, err := tx.Exec(`DELETE FROM RecipeLines WHERE ItemID = ?`, itemID); err != nil {
+        return nil, err
+    }
+    for _, line := range lines {
+        _, err := tx.Exec(`
+            INSERT INTO RecipeLines (ItemID, IngredientID, Quantity)
+            VALUES (?, ?, ?)
+        `, itemID, line.IngredientID, line.Quantity)
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    after, err := loadRecipe(tx, itemID)
+    if err != nil {
+        return nil, err
+    }
+
+    if err := syncStockAvailability(tx, `SELECT ?`, itemID); err != nil {
+        return nil, err
+    }
+    if err := writeAudit(tx, actor, AuditItem, itemID, AuditRecipe, before, after); err != nil {
+        return nil, err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+
+    return after, nil
+}
+
+// AdjustStock records a manual correction to an ingredient's on-hand quantity.
+func (s *InventoryService) AdjustStock(ingredientID int, req *models.StockAdjustmentRequest, actor *models.User) (*models.Ingredient, error) {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    if _, err := loadIngredient(tx, ingredientID); err != nil {
+        return nil, err
+    }
+
+    if err := recordMovement(tx, movement{ingredientID: ingredientID, quantity: req.Quantity, reason: MovementAdjustment, note: req.Note}, actor); err != nil {
+        return nil, err
+    }
+    if err := syncIngredientAvailability(tx, []int{ingredientID}); err != nil {
+        return nil, err
+    }
+
+    ingredient, err := loadIngredient(tx, ingredientID)
+    if err != nil {
+        return nil, err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+
+    return ingredient, nil
+}
+
+// RecordIngredientWastage removes spoiled or spilled stock of one ingredient.
+func (s *InventoryService) RecordIngredientWastage(ingredientID int, req *models.WastageRequest, actor *models.User) (*models.Ingredient, error) {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    if _, err := loadIngredient(tx, ingredientID); err != nil {
+        return nil, err
+    }
+
+    if err := recordMovement(tx, movement{ingredientID: ingredientID, quantity: -req.Quantity, reason: MovementWastage, note: req.Reason}, actor); err != nil {
+        return nil, err
+    }
+    if err := syncIngredientAvailability(tx, []int{ingredientID}); err != nil {
+        return nil, err
+    }
+
+    ingredient, err := loadIngredient(tx, ingredientID)
+    if err != nil {
+        return nil, err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+
+    return ingredient, nil
+}
+
+// RecordItemWastage removes the ingredients of items that were made but not
+// sold, such as a dropped pizza, and returns the affected ingredients. The
+// item must have a recipe.
+func (s *InventoryService) RecordItemWastage(itemID int, req *models.WastageRequest, actor *models.User) ([]models.Ingredient, error) {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    item, err := loadItem(tx, itemID)
+    if err != nil {
+        return nil, err
+    }
+
+    usage := make(map[int]float64)
+    if err := addRecipeUsage(tx, usage, itemID, req.Quantity); err != nil {
+        return nil, err
+    }
+    if len(usage) == 0 {
+        return nil, ConflictError("%s has no recipe; record wastage against its ingredients instead", item.ItemName)
+    }
+
+    ids := sortedIngredientIDs(usage)
+    for _, id := range ids {
+        err := recordMovement(tx, movement{ingredientID: id, quantity: -usage[id], reason: MovementWastage, note: item.ItemName + ": " + req.Reason}, actor)
+        if err != nil {
+            return nil, err
+        }
+    }
+    if err := syncIngredientAvailability(tx, ids); err != nil {
+        return nil, err
+    }
+
+    ingredients := make([]models.Ingredient, 0, len(ids))
+    for _, id := range ids {
+        ingredient, err := loadIngredient(tx, id)
+        if err != nil {
+            return nil, err
+        }
+        ingredients = append(ingredients, *ingredient)
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+
+    return ingredients, nil
+}
+
+// ListMovements returns one page of stock movements, newest first unless
+// another sort is requested, and the total number of matches.
+func (s *InventoryService) ListMovements(filter models.StockMovementFilter) ([]models.StockMovement, int, error) {
+    q := &listQuery{}
+    q.search(filter.Search, "g.Name", "m.Note")
+    if filter.IngredientID > 0 {
+        q.where("m.IngredientID = ?", filter.IngredientID)
+    }
+    if filter.InvoiceID > 0 {
+        q.where("m.InvoiceID = ?", filter.InvoiceID)
+    }
+    if filter.PurchaseOrderID > 0 {
+        q.where("m.PurchaseOrderID = ?", filter.PurchaseOrderID)
+    }
+    if filter.Reason != "" {
+        q.where("m.Reason = ?", filter.Reason)
+    }
+    if filter.From != nil {
+        q.where("m.OccurredAt >= ?", *filter.From)
+    }
+    if filter.To != nil {
+        q.where("m.OccurredAt < ?", *filter.To)
+    }
+
+    var total int
+    err := s.db.QueryRow(`
+        SELECT COUNT(*)
+        FROM StockMovements m
+        JOIN Ingredients g ON m.IngredientID = g.IngredientID
+        `+q.clause(), q.args...).Scan(&total)
+    if err != nil {
+        return nil, 0, err
+    }
+
+    order, err := orderAndPage(filter.ListParams, movementSortColumns, "m.MovementID DESC", "m.MovementID DESC")
+    if err != nil {
+        return nil, 0, err
+    }
+
+    rows, err := s.db.Query(`
+        SELECT m.MovementID, m.IngredientID, g.Name, g.Unit, m.Quantity, m.Reason,
+               m.InvoiceID, m.PurchaseOrderID, m.UnitCost, m.UserID, m.Note, m.OccurredAt
+        FROM StockMovements m
+        JOIN Ingredients g ON m.IngredientID = g.IngredientID
+        `+q.clause()+`
+        `+order, q.args...)
+    if err != nil {
+        return nil, 0, err
+    }
+    defer rows.Close()
+
+    movements := []models.StockMovement{}
+    for rows.Next() {
+        var m models.StockMovement
+        var invoiceID, purchaseOrderID, userID sql.NullInt64
+        var unitCost sql.NullFloat64
+        err := rows.Scan(&m.MovementID, &m.IngredientID, &m.IngredientName, &m.Unit, &m.Quantity, &m.Reason,
+            &invoiceID, &purchaseOrderID, &unitCost, &userID, &m.Note, &m.OccurredAt)
+        if err != nil {
+            return nil, 0, err
+        }
+
+        if invoiceID.Valid {
+            id := int(invoiceID.Int64)
+            m.InvoiceID = &id
+        }
+        if purchaseOrderID.Valid {
+            id := int(purchaseOrderID.Int64)
+            m.PurchaseOrderID = &id
+        }
+        if unitCost.Valid {
+            m.UnitCost = &unitCost.Float64
+        }
+        if userID.Valid {
+            id := int(userID.Int64)
+            m.UserID = &id
+        }
+        movements = append(movements, m)
+    }
+
+    return movements, total, rows.Err()
+}
+
+// movement is a stock change to record. The source fields that do not apply
+// are left nil.
+type movement struct {
+    ingredientID    int
+    quantity        float64
+    reason          string
+    invoiceID       *int
+    purchaseOrderID *int
+    stockTakeID     *int
+    unitCost        *float64
+    note            string
+}
+
+// recordMovement changes an ingredient's on-hand quantity and records why.
+// Movements without a unit cost are valued at the ingredient's current cost.
+func recordMovement(tx *sql.Tx, m movement, actor *models.User) error {
+    var userID interface{}
+    if actor != nil {
+        userID = actor.UserID
+    }
+
+    if _, err := tx.Exec(`UPDATE Ingredients SET OnHand = OnHand + ? WHERE IngredientID = ?`, m.quantity, m.ingredientID); err != nil {
+        return err
+    }
+
+    _, err := tx.Exec(`
+        INSERT INTO StockMovements (IngredientID, Quantity, Reason, InvoiceID, PurchaseOrderID, StockTakeID, UnitCost, UserID, Note)
+        SELECT IngredientID, ?, ?, ?, ?, ?, COALESCE(?, UnitCost), ?, ?
+        FROM Ingredients WHERE IngredientID = ?
+    `, m.quantity, m.reason, m.invoiceID, m.purchaseOrderID, m.stockTakeID, m.unitCost, userID, m.note, m.ingredientID)
+    return err
+}
+
+// deductStock removes the ingredients used by an invoice's lines. Stock may go
+// negative: the sale has happened, and the shortfall shows up in the movements.
+func deductStock(tx *sql.Tx, invoiceID int, actor *models.User) error {
+    // Read the stored lines so bundle components are deducted like any other item
+    rows, err := tx.Query(`
+        SELECT ItemID, SUM(Quantity) FROM InvoiceItems
+        WHERE InvoiceID = ?
+        GROUP BY ItemID
+    `, invoiceID)
+    if err != nil {
+        return err
+    }
+    sold := make(map[int]float64)
+    for rows.Next() {
+        var itemID int
+        var quantity float64
+        if err := rows.Scan(&itemID, &quantity); err != nil {
+            rows.Close()
+            return err
+        }
+        sold[itemID] = quantity
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return err
+    }
+
+    usage := make(map[int]float64)
+    for itemID, quantity := range sold {
+        if err := addRecipeUsage(tx, usage, itemID, quantity); err != nil {
+            return err
+        }
+    }
+
+    ids := sortedIngredientIDs(usage)
+    for _, id := range ids {
+        if err := recordMovement(tx, movement{ingredientID: id, quantity: -usage[id], reason: MovementSale, invoiceID: &invoiceID}, actor); err != nil {
+            return err
+        }
+    }
+
+    return syncIngredientAvailability(tx, ids)
+}
+
+// addRecipeUsage adds the ingredients used to make quantity of an item to usage.
+func addRecipeUsage(q querier, usage map[int]float64, itemID int, quantity float64) error {
+    recipe, err := loadRecipe(q, itemID)
+    if err != nil {
+        return err
+    }
+    for _, r := range recipe {
+        usage[r.IngredientID] += r.Quantity * quantity
+    }
+    return nil
+}
+
+// sortedIngredientIDs returns the keys of usage in ascending order. Stock is
+// updated in id order so concurrent transactions lock rows in the same order.
+func sortedIngredientIDs(usage map[int]float64) []int {
+    ids := make([]int, 0, len(usage))
+    for id := range usage {
+        ids = append(ids, id)
+    }
+    sort.Ints(ids)
+    return ids
+}
+
+// returnStock reverses the sale movements of an invoice.
+func returnStock(tx *sql.Tx, invoiceID int, actor *models.User) error {
+    rows, err := tx.Query(`
+        SELECT IngredientID, SUM(Quantity) FROM StockMovements
+        WHERE InvoiceID = ? AND Reason = ?
+        GROUP BY IngredientID
+        ORDER BY IngredientID
+    `, invoiceID, MovementSale)
+    if err != nil {
+        return err
+    }
+
+    usage := make(map[int]float64)
+    var ids []int
+    for rows.Next() {
+        var id int
+        var quantity float64
+        if err := rows.Scan(&id, &quantity); err != nil {
+            rows.Close()
+            return err
+        }
+        usage[id] = quantity
+        ids = append(ids, id)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return err
+    }
+
+    for _, id := range ids {
+        if err := recordMovement(tx, movement{ingredientID: id, quantity: -usage[id], reason: MovementVoid, invoiceID: &invoiceID}, actor); err != nil {
+            return err
+        }
+    }
+
+    return syncIngredientAvailability(tx, ids)
+}
+
+// syncIngredientAvailability updates the availability of every item made with
+// any of the given ingredients.
+func syncIngredientAvailability(tx *sql.Tx, ingredientIDs []int) error {
+    if len(ingredientIDs) == 0 {
+        return nil
+    }
+
+    placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ingredientIDs)), ", ")
+    args := make([]interface{}, len(ingredientIDs))
+    for i, id := range ingredientIDs {
+        args[i] = id
+    }
+    return syncStockAvailability(tx, `SELECT ItemID FROM RecipeLines WHERE IngredientID IN (`+placeholders+`)`, args...)
+}
+
+// syncStockAvailability marks the items selected by itemQuery sold out when
+// an ingredient is too low to make one, and available again once stock is
+// back. Only items whose availability was set by stock are made available, so
+// a manual 86 or a hidden item is left alone.
+func syncStockAvailability(tx *sql.Tx, itemQuery string, args ...interface{}) error {
+    const short = `EXISTS (
+            SELECT 1 FROM RecipeLines r
+            JOIN Ingredients g ON r.IngredientID = g.IngredientID
+            WHERE r.ItemID = i.ItemID AND g.OnHand < r.Quantity
+        )`
+
+    _, err := tx.Exec(`
+        UPDATE i SET Availability = ?, SoldOutUntil = NULL, AvailabilitySource = ?
+        FROM Items i
+        WHERE i.Availability = ? AND i.ItemID IN (`+itemQuery+`) AND `+short,
+        append([]interface{}{ItemSoldOut, AvailabilityStock, ItemAvailable}, args...)...)
+    if err != nil {
+        return err
+    }
+
+    _, err = tx.Exec(`
+        UPDATE i SET Availability = ?
+        FROM Items i
+        WHERE i.Availability = ? AND i.AvailabilitySource = ? AND i.ItemID IN (`+itemQuery+`) AND NOT `+short,
+        append([]interface{}{ItemAvailable, ItemSoldOut, AvailabilityStock}, args...)...)
+    return err
+}
@@ -0,0 +1,376 @@
+package services
+
+import (
+    "crypto/ed25519"
+    "crypto/sha256"
+    "database/sql"
+    "encoding/base64"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+    "backend/config"
+    "backend/models"
+    "backend/database"
+)
+
+// genesisHash is the previous hash of the first invoice in the chain.
+var genesisHash = strings.Repeat("0", 64)
+
+// Versions of the hashed invoice content. Each link records the version it
+// was hashed with, so links made before a change keep verifying. From
+// version 2 on the version is part of the hashed content, so a link cannot be
+// moved back to a version that hashes less.
+const (
+    // chainVersionLines hashes ids, quantities and amounts of the lines
+    chainVersionLines = 1
+    // chainVersionSnapshots also hashes what each line says was sold
+    chainVersionSnapshots = 2
+
+    currentChainVersion = chainVersionSnapshots
+)
+
+// InvoiceChain links every issued invoice to the one before it. Each link
+// stores sha256(previous hash | canonical invoice content), so altering,
+// removing or reordering an invoice breaks every later link. Links are
+// signed with Ed25519 when a signing key is configured.
+type InvoiceChain struct {
+    db    *sql.DB
+    key   ed25519.PrivateKey
+    keyID string
+}
+
+// NewInvoiceChain reads the optional signing key, a base64 encoded 32 byte
+// Ed25519 seed.
+func NewInvoiceChain(cfg *config.Config) (*InvoiceChain, error) {
+    chain := &InvoiceChain{db: database.GetDB()}
+    if cfg.InvoiceSigningKey == "" {
+        return chain, nil
+    }
+
+    seed, err := base64.StdEncoding.DecodeString(cfg.InvoiceSigningKey)
+    if err != nil || len(seed) != ed25519.SeedSize {
+        return nil, fmt.Errorf("INVOICE_SIGNING_KEY must be a base64 encoded %d byte seed", ed25519.SeedSize)
+    }
+    chain.key = ed25519.NewKeyFromSeed(seed)
+
+    // The key id lets verification tell a bad signature from one made by another key
+    sum := sha256.Sum256(chain.key.Public().(ed25519.PublicKey))
+    chain.keyID = hex.EncodeToString(sum[:8])
+    return chain, nil
+}
+
+// chainContent is the canonical form of an invoice that is hashed. Amounts are
+// formatted as strings so the encoding does not depend on float formatting,
+// and status is left out because voiding is not an alteration of the invoice.
+// Version is omitted for version 1 links, which were hashed without it.
+type chainContent struct {
+    Version       int         `json:"version,omitempty"`
+    InvoiceID     int         `json:"invoice_id"`
+    InvoiceNumber string      `json:"invoice_number"`
+    InvoiceDate   string      `json:"invoice_date"`
+    CustomerID    int         `json:"customer_id"`
+    SubTotal      string      `json:"sub_total"`
+    TaxRate       string      `json:"tax_rate"`
+    TaxAmount     string      `json:"tax_amount"`
+    TotalAmount   string      `json:"total_amount"`
+    Lines         []chainLine `json:"lines"`
+}
+
+// chainLine is one invoice line. Bundle components are hashed as lines of
+// their own; ParentInvoiceItemID is omitted for other lines so invoices
+// chained before bundles existed still verify. The item name, description,
+// category and slot recorded at sale time are hashed from version 2 on.
+type chainLine struct {
+    InvoiceItemID       int    `json:"invoice_item_id"`
+    ItemID              int    `json:"item_id"`
+    Quantity            int    `json:"quantity"`
+    UnitPrice           string `json:"unit_price"`
+    TotalPrice          string `json:"total_price"`
+    ParentInvoiceItemID int    `json:"parent_invoice_item_id,omitempty"`
+    ItemName            string `json:"item_name,omitempty"`
+    ItemDescription     string `json:"item_description,omitempty"`
+    CategoryID          int    `json:"category_id,omitempty"`
+    CategoryName        string `json:"category_name,omitempty"`
+    SlotName            string `json:"slot_name,omitempty"`
+}
+
+func chainHash(prevHash string, invoice *models.Invoice, version int) (string, error) {
+    content := chainContent{
+        InvoiceID:     invoice.InvoiceID,
+        InvoiceNumber: invoice.InvoiceNumber,
+        InvoiceDate:   invoice.InvoiceDate.Format("2006-01-02T15:04:05.000"),
+        CustomerID:    invoice.CustomerID,
+        SubTotal:      formatAmount(invoice.SubTotal),
+        TaxRate:       formatAmount(invoice.TaxRate),
+        TaxAmount:     formatAmount(invoice.TaxAmount),
+        TotalAmount:   formatAmount(invoice.TotalAmount),
+        Lines:         []chainLine{},
+    }
+    if version >= chainVersionSnapshots {
+        content.Version = version
+    }
+    for _, item := range invoice.Items {
+        content.Lines = append(content.Lines, newChainLine(item, version))
+        for _, component := range item.Components {
+            content.Lines = append(content.Lines, newChainLine(component, version))
+        }
+    }
+    sort.Slice(content.Lines, func(i, j int) bool {
+        return content.Lines[i].InvoiceItemID < content.Lines[j].InvoiceItemID
+    })
+
+    data, err := json.Marshal(content)
+    if err != nil {
+        return "", err
+    }
+
+    sum := sha256.Sum256(append([]byte(prevHash+"|"), data...))
+    return hex.EncodeToString(sum[:]), nil
+}
+
+func newChainLine(item models.InvoiceItem, version int) chainLine {
+    line := chainLine{
+        InvoiceItemID: item.InvoiceItemID,
+        ItemID:        item.ItemID,
+        Quantity:      item.Quantity,
+        UnitPrice:     formatAmount(item.UnitPrice),
+        TotalPrice:    formatAmount(item.TotalPrice),
+    }
+    if item.ParentInvoiceItemID != nil {
+        line.ParentInvoiceItemID = *item.ParentInvoiceItemID
+    }
+    if version >= chainVersionSnapshots {
+        line.SlotName = item.SlotName
+        if item.Item != nil {
+            line.ItemName = item.Item.ItemName
+            line.ItemDescription = item.Item.Description
+            if item.Item.Category != nil {
+                line.CategoryID = item.Item.Category.CategoryID
+                line.CategoryName = item.Item.Category.CategoryName
+            }
+        }
+    }
+    return line
+}
+
+func formatAmount(v float64) string {
+    return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// append links an invoice to the end of the chain inside tx. The chain head is
+// locked so concurrent invoices are chained one at a time.
+func (c *InvoiceChain) append(tx *sql.Tx, invoice *models.Invoice) error {
+    sequence, prevHash := 0, genesisHash
+    err := tx.QueryRow(`
+        SELECT TOP 1 Sequence, ChainHash FROM InvoiceChain WITH (UPDLOCK, HOLDLOCK)
+        ORDER BY Sequence DESC
+    `).Scan(&sequence, &prevHash)
+    if err != nil && err != sql.ErrNoRows {
+        return err
+    }
+
+    hash, err := chainHash(prevHash, invoice, currentChainVersion)
+    if err != nil {
+        return err
+    }
+
+    var signature, keyID sql.NullString
+    if c.key != nil {
+        raw, _ := hex.DecodeString(hash)
+        signature = sql.NullString{String: base64.StdEncoding.EncodeToString(ed25519.Sign(c.key, raw)), Valid: true}
+        keyID = sql.NullString{String: c.keyID, Valid: true}
+    }
+
+    _, err = tx.Exec(`
+        INSERT INTO InvoiceChain (Sequence, InvoiceID, PrevHash, ChainHash, Signature, KeyID, ContentVersion)
+        VALUES (?, ?, ?, ?, ?, ?, ?)
+    `, sequence+1, invoice.InvoiceID, prevHash, hash, signature, keyID, currentChainVersion)
+    return err
+}
+
+// backfillStep records in SchemaMigrations that the one-time backfill ran.
+const backfillStep = "invoice_chain_backfill"
+
+// Backfill chains the invoices issued before the chain existed, oldest first.
+// Those are the invoices older than the first chained one, or all of them
+// when nothing is chained yet. It runs once, from the chain-backfill command;
+// invoices that appear later without a link are left for Verify to report.
+func (c *InvoiceChain) Backfill() (int, error) {
+    var done int
+    err := c.db.QueryRow(`SELECT COUNT(*) FROM SchemaMigrations WHERE MigrationID = ?`, backfillStep).Scan(&done)
+    if err != nil {
+        return 0, err
+    }
+    if done > 0 {
+        return 0, ConflictError("the invoice chain has already been backfilled")
+    }
+
+    rows, err := c.db.Query(`
+        SELECT InvoiceID FROM Invoices
+        WHERE InvoiceID NOT IN (SELECT InvoiceID FROM InvoiceChain)
+          AND InvoiceID < COALESCE((SELECT MIN(InvoiceID) FROM InvoiceChain), 2147483647)
+        ORDER BY InvoiceID
+    `)
+    if err != nil {
+        return 0, err
+    }
+    var ids []int
+    for rows.Next() {
+        var id int
+        if err := rows.Scan(&id); err != nil {
+            rows.Close()
+            return 0, err
+        }
+        ids = append(ids, id)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return 0, err
+    }
+
+    for i, id := range ids {
+        tx, err := c.db.Begin()
+        if err != nil {
+            return i, err
+        }
+        invoice, err := loadInvoice(tx, id)
+        if err == nil {
+            err = c.append(tx, invoice)
+        }
+        if err == nil {
+            err = tx.Commit()
+        }
+        if err != nil {
+            tx.Rollback()
+            return i, err
+        }
+    }
+
+    if _, err := c.db.Exec(`INSERT INTO SchemaMigrations (MigrationID) VALUES (?)`, backfillStep); err != nil {
+        return len(ids), err
+    }
+    return len(ids), nil
+}
+
+// Verify walks the chain from the start, recomputing every hash from the
+// stored invoices and checking signatures made with the configured key. It
+// stops at the first broken link. With a key configured, every link from the
+// first signed one on must carry a valid signature by that key: otherwise an
+// edited invoice could be hidden by recomputing the later hashes and dropping
+// their signatures.
+func (c *InvoiceChain) Verify() (*models.ChainVerification, error) {
+    rows, err := c.db.Query(`
+        SELECT Sequence, InvoiceID, PrevHash, ChainHash, Signature, KeyID, ContentVersion
+        FROM InvoiceChain ORDER BY Sequence
+    `)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    result := &models.ChainVerification{Valid: true, HeadHash: genesisHash}
+    lastVersion := chainVersionLines
+    broken := func(sequence, invoiceID int, format string, args ...interface{}) {
+        result.Valid = false
+        result.FirstBroken = &models.ChainBreak{Sequence: sequence, InvoiceID: invoiceID, Reason: fmt.Sprintf(format, args...)}
+    }
+
+    for rows.Next() {
+        var sequence, invoiceID, version int
+        var prevHash, hash string
+        var signature, keyID sql.NullString
+        if err := rows.Scan(&sequence, &invoiceID, &prevHash, &hash, &signature, &keyID, &version); err != nil {
+            return nil, err
+        }
+
+        if sequence != result.Checked+1 {
+            broken(sequence, invoiceID, "expected sequence %d, found %d", result.Checked+1, sequence)
+            return result, nil
+        }
+        if prevHash != result.HeadHash {
+            broken(sequence, invoiceID, "previous hash does not match the preceding link")
+            return result, nil
+        }
+        // Versions only ever go up, so a lower one means a link was rewritten
+        if version > currentChainVersion {
+            broken(sequence, invoiceID, "unknown content version %d", version)
+            return result, nil
+        }
+        if version < lastVersion {
+            broken(sequence, invoiceID, "content version %d follows version %d", version, lastVersion)
+            return result, nil
+        }
+        lastVersion = version
+
+        invoice, err := loadInvoice(c.db, invoiceID)
+        if appErr, ok := err.(*AppError); ok && appErr.Code == CodeNotFound {
+            broken(sequence, invoiceID, "invoice %d no longer exists", invoiceID)
+            return result, nil
+        }
+        if err != nil {
+            return nil, err
+        }
+
+        expected, err := chainHash(prevHash, invoice, version)
+        if err != nil {
+            return nil, err
+        }
+        if expected != hash {
+            broken(sequence, invoiceID, "invoice %s has been altered since it was issued", invoice.InvoiceNumber)
+            return result, nil
+        }
+
+        if signature.Valid {
+            result.Signed++
+        }
+        if c.key != nil && result.Signed > 0 {
+            if reason := c.checkSignature(hash, signature, keyID); reason != "" {
+                broken(sequence, invoiceID, "%s", reason)
+                return result, nil
+            }
+            result.SignaturesVerified++
+        }
+
+        result.Checked++
+        result.HeadHash = hash
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    // Invoices missing from the chain were inserted around the application,
+    // or predate the chain and chain-backfill has not been run
+    var missing int
+    err = c.db.QueryRow(`
+        SELECT TOP 1 InvoiceID FROM Invoices
+        WHERE InvoiceID NOT IN (SELECT InvoiceID FROM InvoiceChain)
+        ORDER BY InvoiceID
+    `).Scan(&missing)
+    if err == nil {
+        broken(0, missing, "invoice %d is not in the chain", missing)
+    } else if err != sql.ErrNoRows {
+        return nil, err
+    }
+
+    return result, nil
+}
+
+// checkSignature returns why a link's signature does not prove it was made
+// with the configured key, or "" when it does.
+func (c *InvoiceChain) checkSignature(hash string, signature, keyID sql.NullString) string {
+    if !signature.Valid {
+        return "link is not signed, but earlier links are"
+    }
+    if keyID.String != c.keyID {
+        return fmt.Sprintf("link is signed with unknown key %q", keyID.String)
+    }
+    raw, _ := hex.DecodeString(hash)
+    sig, err := base64.StdEncoding.DecodeString(signature.String)
+    if err != nil || !ed25519.Verify(c.key.Public().(ed25519.PublicKey), raw, sig) {
+        return "signature does not match"
+    }
+    return ""
+}
@@ -0,0 +1,219 @@
+package services
+
+import (
+    "crypto/ed25519"
+    "crypto/sha256"
+    "database/sql"
+    "encoding/base64"
+    "encoding/hex"
+    "strings"
+    "testing"
+    "time"
+    "backend/config"
+    "backend/models"
+)
+
+// The canonical content of an invoice is what every stored link was hashed
+// from. These tests pin it, so a change to field names, field order or
+// amount formatting fails here instead of breaking verification of every
+// existing chain.
+
+func intPtr(v int) *int {
+    return &v
+}
+
+func chainTestInvoice() *models.Invoice {
+    return &models.Invoice{
+        InvoiceID:     7,
+        InvoiceNumber: "INV-1700000000",
+        CustomerID:    3,
+        InvoiceDate:   time.Date(2024, 3, 1, 12, 30, 45, 123000000, time.UTC),
+        SubTotal:      24.5,
+        TaxRate:       10,
+        TaxAmount:     2.45,
+        TotalAmount:   26.95,
+        Status:        InvoiceStatusIssued,
+    }
+}
+
+func TestChainHash(t *testing.T) {
+    plain := chainTestInvoice()
+    // Lines are hashed in id order whatever order they are loaded in
+    plain.Items = []models.InvoiceItem{
+        {InvoiceItemID: 12, ItemID: 5, Quantity: 1, UnitPrice: 7.5, TotalPrice: 7.5},
+        {InvoiceItemID: 11, ItemID: 2, Quantity: 2, UnitPrice: 8.5, TotalPrice: 17},
+    }
+
+    bundle := chainTestInvoice()
+    bundle.Items = []models.InvoiceItem{
+        {InvoiceItemID: 21, ItemID: 9, Quantity: 1, UnitPrice: 24.5, TotalPrice: 24.5, Components: []models.InvoiceItem{
+            {InvoiceItemID: 22, ItemID: 2, Quantity: 1, ParentInvoiceItemID: intPtr(21), SlotName: "Pizza"},
+            {InvoiceItemID: 23, ItemID: 4, Quantity: 2, ParentInvoiceItemID: intPtr(21), SlotName: "Drinks"},
+        }},
+    }
+
+    // Voiding does not alter the invoice, so status is not part of the hash
+    voided := chainTestInvoice()
+    voided.Status = InvoiceStatusVoid
+    voided.Items = plain.Items
+
+    // From version 2 the sale-time snapshot of each line is hashed as well
+    snapshot := chainTestInvoice()
+    snapshot.Items = []models.InvoiceItem{
+        {InvoiceItemID: 11, ItemID: 2, Quantity: 2, UnitPrice: 8.5, TotalPrice: 17, Item: &models.Item{
+            ItemID: 2, ItemName: "Margherita", Description: "Tomato, mozzarella", CategoryID: 4,
+            Category: &models.Category{CategoryID: 4, CategoryName: "Pizza"},
+        }},
+        {InvoiceItemID: 12, ItemID: 5, Quantity: 1, UnitPrice: 7.5, TotalPrice: 7.5, Item: &models.Item{ItemID: 5, ItemName: "Cola"}},
+    }
+
+    const header = `{"invoice_id":7,"invoice_number":"INV-1700000000","invoice_date":"2024-03-01T12:30:45.123",` +
+        `"customer_id":3,"sub_total":"24.5","tax_rate":"10","tax_amount":"2.45","total_amount":"26.95",`
+    // Version 2 content names its version, so a link cannot be moved back to version 1
+    versioned := `{"version":2,` + header[1:]
+    plainContent := header + `"lines":[` +
+        `{"invoice_item_id":11,"item_id":2,"quantity":2,"unit_price":"8.5","total_price":"17"},` +
+        `{"invoice_item_id":12,"item_id":5,"quantity":1,"unit_price":"7.5","total_price":"7.5"}]}`
+
+    tests := []struct {
+        name     string
+        prevHash string
+        invoice  *models.Invoice
+        version  int
+        content  string
+        want     string
+    }{
+        {
+            name:     "plain lines",
+            prevHash: genesisHash,
+            invoice:  plain,
+            version:  chainVersionLines,
+            content:  plainContent,
+            want:     "e45314ae583be55fc92646c1cd1598fddaf40f53072553f42afa7072d89db351",
+        },
+        {
+            name:     "bundle with components",
+            prevHash: "ab" + genesisHash[2:],
+            invoice:  bundle,
+            version:  chainVersionLines,
+            content: header + `"lines":[` +
+                `{"invoice_item_id":21,"item_id":9,"quantity":1,"unit_price":"24.5","total_price":"24.5"},` +
+                `{"invoice_item_id":22,"item_id":2,"quantity":1,"unit_price":"0","total_price":"0","parent_invoice_item_id":21},` +
+                `{"invoice_item_id":23,"item_id":4,"quantity":2,"unit_price":"0","total_price":"0","parent_invoice_item_id":21}]}`,
+            want: "a13a989ec6cd3fc11428480d7a187630401636891259ad623a56614038fcc7e8",
+        },
+        {
+            name:     "void invoice",
+            prevHash: genesisHash,
+            invoice:  voided,
+            version:  chainVersionLines,
+            content:  plainContent,
+            want:     "e45314ae583be55fc92646c1cd1598fddaf40f53072553f42afa7072d89db351",
+        },
+        {
+            // Version 1 links were hashed without snapshots and must keep verifying
+            name:     "snapshots at version 1",
+            prevHash: genesisHash,
+            invoice:  snapshot,
+            version:  chainVersionLines,
+            content:  plainContent,
+            want:     "e45314ae583be55fc92646c1cd1598fddaf40f53072553f42afa7072d89db351",
+        },
+        {
+            name:     "snapshots",
+            prevHash: genesisHash,
+            invoice:  snapshot,
+            version:  chainVersionSnapshots,
+            content: versioned + `"lines":[` +
+                `{"invoice_item_id":11,"item_id":2,"quantity":2,"unit_price":"8.5","total_price":"17",` +
+                `"item_name":"Margherita","item_description":"Tomato, mozzarella","category_id":4,"category_name":"Pizza"},` +
+                `{"invoice_item_id":12,"item_id":5,"quantity":1,"unit_price":"7.5","total_price":"7.5","item_name":"Cola"}]}`,
+            want: "d20babe6e02cf52852b97c021eb2688cb8394cf20eada84a1587a86fc60eca2d",
+        },
+        {
+            name:     "bundle slots",
+            prevHash: "ab" + genesisHash[2:],
+            invoice:  bundle,
+            version:  chainVersionSnapshots,
+            content: versioned + `"lines":[` +
+                `{"invoice_item_id":21,"item_id":9,"quantity":1,"unit_price":"24.5","total_price":"24.5"},` +
+                `{"invoice_item_id":22,"item_id":2,"quantity":1,"unit_price":"0","total_price":"0","parent_invoice_item_id":21,"slot_name":"Pizza"},` +
+                `{"invoice_item_id":23,"item_id":4,"quantity":2,"unit_price":"0","total_price":"0","parent_invoice_item_id":21,"slot_name":"Drinks"}]}`,
+            want: "6d38537da7758d6057e2a7bbb873d53ba1c19049a92d8a8ef70ab5e3aeb9ae2e",
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := chainHash(tt.prevHash, tt.invoice, tt.version)
+            if err != nil {
+                t.Fatal(err)
+            }
+
+            sum := sha256.Sum256([]byte(tt.prevHash + "|" + tt.content))
+            if expected := hex.EncodeToString(sum[:]); got != expected {
+                t.Errorf("hash does not match the canonical content\n got  %s\n want %s", got, expected)
+            }
+            if got != tt.want {
+                t.Errorf("hash changed\n got  %s\n want %s", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestFormatAmount(t *testing.T) {
+    tests := []struct {
+        amount float64
+        want   string
+    }{
+        {0, "0"},
+        {17, "17"},
+        {8.5, "8.5"},
+        {2.45, "2.45"},
+        {1.0 / 3, "0.3333333333333333"},
+        {1234567.89, "1234567.89"},
+    }
+
+    for _, tt := range tests {
+        if got := formatAmount(tt.amount); got != tt.want {
+            t.Errorf("formatAmount(%v) = %q, want %q", tt.amount, got, tt.want)
+        }
+    }
+}
+
+func TestCheckSignature(t *testing.T) {
+    seed := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", ed25519.SeedSize)))
+    chain, err := NewInvoiceChain(&config.Config{InvoiceSigningKey: seed})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    hash := "ab" + genesisHash[2:]
+    raw, _ := hex.DecodeString(hash)
+    valid := sql.NullString{String: base64.StdEncoding.EncodeToString(ed25519.Sign(chain.key, raw)), Valid: true}
+    keyID := sql.NullString{String: chain.keyID, Valid: true}
+
+    tests := []struct {
+        name      string
+        hash      string
+        signature sql.NullString
+        keyID     sql.NullString
+        ok        bool
+    }{
+        {"valid", hash, valid, keyID, true},
+        // A rewritten link has no signature, or one the verifier cannot check
+        {"unsigned", hash, sql.NullString{}, sql.NullString{}, false},
+        {"unknown key", hash, valid, sql.NullString{String: "0011223344556677", Valid: true}, false},
+        {"other hash", genesisHash, valid, keyID, false},
+        {"not base64", hash, sql.NullString{String: "%%", Valid: true}, keyID, false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            reason := chain.checkSignature(tt.hash, tt.signature, tt.keyID)
+            if (reason == "") != tt.ok {
+                t.Errorf("got %q, want ok=%v", reason, tt.ok)
+            }
+        })
+    }
+}
@@ -8,35 +8,108 @@ import (
     "time"
 )
 
+// Invoice statuses.
+const (
+    InvoiceStatusIssued = "issued"
+    InvoiceStatusVoid   = "void"
+)
+
 type InvoiceService struct {
-    db *sql.DB
+    db    *sql.DB
+    chain *InvoiceChain
 }
 
-func NewInvoiceService() *InvoiceService {
+func NewInvoiceService(chain *InvoiceChain) *InvoiceService {
     return &InvoiceService{
-        db: database.GetDB(),
+        db:    database.GetDB(),
+        chain: chain,
     }
 }
 
-func (s *InvoiceService) CreateInvoice(req *models.CreateInvoiceRequest) (*models.Invoice, error) {
+// CreateInvoice prices each line at the item's price in effect when the order
+// is placed, after any active price rule, unless the request overrides it.
+// Bundle lines add the surcharges of their choices and are expanded into
+// component lines. Discounts within discount_limit_percent need no approval;
+// larger discounts need PermLargeDiscount and other overrides PermOverridePrice,
+// or a manager's approval token for each. The issued invoice is appended to the
+// hash chain in the same transaction.
+func (s *InvoiceService) CreateInvoice(req *models.CreateInvoiceRequest, actor *models.User) (*models.Invoice, error) {
     tx, err := s.db.Begin()
     if err != nil {
         return nil, err
     }
     defer tx.Rollback()
     
+    if err := checkNotArchived(tx, AuditCustomer, req.CustomerID, "customer_id"); err != nil {
+        return nil, err
+    }
+    
     // Generate invoice number
     invoiceNumber := fmt.Sprintf("INV-%d", time.Now().Unix())
     
-    // Calculate totals
+    // Calculate totals at the prices in effect when the order is placed
+    orderedAt := time.Now()
+    rules, err := loadPriceRules(tx)
+    if err != nil {
+        return nil, err
+    }
+    
+    discountLimit, err := settingFloat(tx, SettingDiscountLimit)
+    if err != nil {
+        return nil, err
+    }
+    
     var subTotal float64
-    for _, item := range req.Items {
-        var unitPrice float64
-        err := tx.QueryRow("SELECT BasePrice FROM Items WHERE ItemID = ?", item.ItemID).Scan(&unitPrice)
+    unitPrices := make([]float64, len(req.Items))
+    ruleIDs := make([]*int, len(req.Items))
+    overrides := make([]int, len(req.Items))
+    components := make([][]bundleComponent, len(req.Items))
+    overrideKinds := make(map[int]bool)
+    for i, item := range req.Items {
+        // Scanned lines carry a code instead of an item id
+        if item.ItemID, err = lineItemID(tx, item, fmt.Sprintf("items[%d]", i)); err != nil {
+            return nil, err
+        }
+        req.Items[i].ItemID = item.ItemID
+        price, categoryID, err := resolvePrice(tx, item.ItemID, orderedAt)
+        if err == sql.ErrNoRows {
+            return nil, FieldError(fmt.Sprintf("items[%d].item_id", i), fmt.Sprintf("item %d does not exist", item.ItemID))
+        }
+        if err != nil {
+            return nil, err
+        }
+        if err := checkAvailable(tx, item.ItemID, fmt.Sprintf("items[%d].item_id", i)); err != nil {
+            return nil, err
+        }
+        var surcharge float64
+        components[i], surcharge, err = expandBundle(tx, item.ItemID, item.Choices, fmt.Sprintf("items[%d]", i))
+        if err != nil {
+            return nil, err
+        }
+        unitPrices[i], ruleIDs[i] = rules.priceAt(item.ItemID, categoryID, price, orderedAt)
+        unitPrices[i] += surcharge
+        if item.UnitPrice != nil && *item.UnitPrice != unitPrices[i] {
+            overrides[i] = classifyOverride(unitPrices[i], *item.UnitPrice, discountLimit)
+            overrideKinds[overrides[i]] = true
+            unitPrices[i] = *item.UnitPrice
+            ruleIDs[i] = nil
+        }
+        subTotal += unitPrices[i] * float64(item.Quantity)
+    }
+    
+    // One approval of each kind covers every line of that kind on the invoice
+    lineApprovals := make(map[int]*int)
+    if overrideKinds[overridePrice] {
+        lineApprovals[overridePrice], err = authorizeAction(tx, actor, PermOverridePrice, ApprovalPriceOverride, req.ApprovalToken, nil)
+        if err != nil {
+            return nil, err
+        }
+    }
+    if overrideKinds[overrideLargeDiscount] {
+        lineApprovals[overrideLargeDiscount], err = authorizeAction(tx, actor, PermLargeDiscount, ApprovalLargeDiscount, req.DiscountApprovalToken, nil)
         if err != nil {
             return nil, err
         }
-        subTotal += unitPrice * float64(item.Quantity)
     }
     
     taxAmount := subTotal * (req.TaxRate / 100)
@@ -56,23 +129,49 @@ func (s *InvoiceService) CreateInvoice(req *models.CreateInvoiceRequest) (*model
     }
     
     // Create invoice items
-    for _, item := range req.Items {
-        var unitPrice float64
-        err := tx.QueryRow("SELECT BasePrice FROM Items WHERE ItemID = ?", item.ItemID).Scan(&unitPrice)
-        if err != nil {
-            return nil, err
-        }
-        
+    for i, item := range req.Items {
+        unitPrice := unitPrices[i]
         totalPrice := unitPrice * float64(item.Quantity)
         
-        _, err = tx.Exec(`
-            INSERT INTO InvoiceItems (InvoiceID, ItemID, Quantity, UnitPrice, TotalPrice)
-            VALUES (?, ?, ?, ?, ?)
-        `, invoiceID, item.ItemID, item.Quantity, unitPrice, totalPrice)
+        approvalID := lineApprovals[overrides[i]]
+        
+        // The line keeps today's recipe cost and names so later edits do not rewrite it
+        var invoiceItemID int
+        err = tx.QueryRow(`
+            INSERT INTO InvoiceItems (InvoiceID, ItemID, Quantity, UnitPrice, TotalPrice, PriceApprovalID, PriceRuleID, UnitCost,
+                                      `+lineSnapshotColumns+`)
+            OUTPUT INSERTED.InvoiceItemID
+            SELECT ?, i.ItemID, ?, ?, ?, ?, ?, fc.FoodCost, `+lineSnapshotValues+`
+            FROM Items i
+            LEFT JOIN Categories c ON i.CategoryID = c.CategoryID
+            `+foodCostApply+`
+            WHERE i.ItemID = ?
+        `, invoiceID, item.Quantity, unitPrice, totalPrice, approvalID, ruleIDs[i], item.ItemID).Scan(&invoiceItemID)
         
         if err != nil {
             return nil, err
         }
+        
+        // Bundles go to the kitchen and stock as the items chosen for them
+        if err := insertBundleComponents(tx, invoiceID, invoiceItemID, item.Quantity, components[i]); err != nil {
+            return nil, err
+        }
+    }
+    
+    // Stock leaves with the sale, so a failed deduction fails the invoice
+    if err := deductStock(tx, invoiceID, actor); err != nil {
+        return nil, err
+    }
+    
+    invoice, err := loadInvoice(tx, invoiceID)
+    if err != nil {
+        return nil, err
+    }
+    if err := writeAudit(tx, actor, AuditInvoice, invoiceID, AuditCreate, nil, invoice); err != nil {
+        return nil, err
+    }
+    if err := s.chain.append(tx, invoice); err != nil {
+        return nil, err
     }
     
     err = tx.Commit()
@@ -80,52 +179,335 @@ func (s *InvoiceService) CreateInvoice(req *models.CreateInvoiceRequest) (*model
         return nil, err
     }
     
-    // Return created invoice
-    return s.GetInvoiceByID(invoiceID)
+    return invoice, nil
+}
+
+var invoiceSortColumns = map[string]string{
+    "invoice_date":   "i.InvoiceDate",
+    "invoice_number": "i.InvoiceNumber",
+    "total_amount":   "i.TotalAmount",
+    "customer_name":  "c.CustomerName",
+    "invoice_id":     "i.InvoiceID",
+}
+
+// VoidInvoice cancels an issued invoice and returns its ingredients to stock.
+// Managers may only void invoices up to the manager_void_limit setting; larger
+// invoices need an admin. Users without the permission can void with an
+// approval token from someone who has it.
+func (s *InvoiceService) VoidInvoice(invoiceID int, reason, approvalToken string, actor *models.User) (*models.Invoice, error) {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+    
+    var status string
+    var totalAmount float64
+    err = tx.QueryRow(`SELECT Status, TotalAmount FROM Invoices WITH (UPDLOCK) WHERE InvoiceID = ?`, invoiceID).Scan(&status, &totalAmount)
+    if err == sql.ErrNoRows {
+        return nil, NotFoundError("invoice", invoiceID)
+    }
+    if err != nil {
+        return nil, err
+    }
+    
+    if status == InvoiceStatusVoid {
+        return nil, ConflictError("invoice %d is already void", invoiceID)
+    }
+    
+    limit, err := settingFloat(tx, SettingManagerVoidLimit)
+    if err != nil {
+        return nil, err
+    }
+    perm := PermVoidInvoices
+    if limit > 0 && totalAmount > limit {
+        perm = PermVoidAnyAmount
+    }
+    approvalID, err := authorizeAction(tx, actor, perm, ApprovalVoidInvoice, approvalToken, &invoiceID)
+    if err != nil {
+        return nil, err
+    }
+    
+    before, err := loadInvoice(tx, invoiceID)
+    if err != nil {
+        return nil, err
+    }
+    
+    _, err = tx.Exec(`
+        UPDATE Invoices
+        SET Status = ?, VoidedAt = GETDATE(), VoidedBy = ?, VoidReason = ?, VoidApprovalID = ?
+        WHERE InvoiceID = ?
+    `, InvoiceStatusVoid, actor.UserID, reason, approvalID, invoiceID)
+    if err != nil {
+        return nil, err
+    }
+    if err := returnStock(tx, invoiceID, actor); err != nil {
+        return nil, err
+    }
+    
+    after, err := loadInvoice(tx, invoiceID)
+    if err != nil {
+        return nil, err
+    }
+    if err := writeAudit(tx, actor, AuditInvoice, invoiceID, AuditVoid, before, after); err != nil {
+        return nil, err
+    }
+    
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+    
+    return after, nil
 }
 
 func (s *InvoiceService) GetAllInvoices() ([]models.Invoice, error) {
+    var invoices []models.Invoice
+    err := s.EachInvoice(models.InvoiceFilter{}, func(invoice models.Invoice) error {
+        invoices = append(invoices, invoice)
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    
+    return invoices, nil
+}
+
+// ListInvoices returns one page of invoices matching the filter and the total number of matches.
+func (s *InvoiceService) ListInvoices(filter models.InvoiceFilter) ([]models.Invoice, int, error) {
+    var total int
+    q := invoiceListQuery(filter)
+    err := s.db.QueryRow(`
+        SELECT COUNT(*)
+        FROM Invoices i
+        LEFT JOIN Customers c ON i.CustomerID = c.CustomerID
+        `+q.clause(), q.args...).Scan(&total)
+    if err != nil {
+        return nil, 0, err
+    }
+    
+    invoices := []models.Invoice{}
+    err = s.EachInvoice(filter, func(invoice models.Invoice) error {
+        invoices = append(invoices, invoice)
+        return nil
+    })
+    if err != nil {
+        return nil, 0, err
+    }
+    
+    return invoices, total, nil
+}
+
+func invoiceListQuery(filter models.InvoiceFilter) *listQuery {
+    q := &listQuery{}
+    q.search(filter.Search, "i.InvoiceNumber", "c.CustomerName", "c.Phone", "c.Email")
+    if filter.From != nil {
+        q.where("i.InvoiceDate >= ?", *filter.From)
+    }
+    if filter.To != nil {
+        q.where("i.InvoiceDate < ?", *filter.To)
+    }
+    if filter.CustomerID > 0 {
+        q.where("i.CustomerID = ?", filter.CustomerID)
+    }
+    if filter.Status != "" {
+        q.where("i.Status = ?", filter.Status)
+    }
+    if filter.MinTotal != nil {
+        q.where("i.TotalAmount >= ?", *filter.MinTotal)
+    }
+    if filter.MaxTotal != nil {
+        q.where("i.TotalAmount <= ?", *filter.MaxTotal)
+    }
+    return q
+}
+
+// EachInvoice streams the invoices matching the filter, newest first unless
+// another sort is requested, to fn without holding the full list in memory.
+func (s *InvoiceService) EachInvoice(filter models.InvoiceFilter, fn func(models.Invoice) error) error {
+    q := invoiceListQuery(filter)
+    order, err := orderAndPage(filter.ListParams, invoiceSortColumns, "i.InvoiceDate DESC, i.InvoiceID DESC", "i.InvoiceID")
+    if err != nil {
+        return err
+    }
+    
     query := `
         SELECT i.InvoiceID, i.InvoiceNumber, i.CustomerID, i.InvoiceDate, 
-               i.SubTotal, i.TaxRate, i.TaxAmount, i.TotalAmount,
+               i.SubTotal, i.TaxRate, i.TaxAmount, i.TotalAmount, i.Status,
                c.CustomerName, c.Phone, c.Email, c.Address
         FROM Invoices i
         LEFT JOIN Customers c ON i.CustomerID = c.CustomerID
-    `
+        ` + q.clause() + `
+        ` + order
     
-    rows, err := s.db.Query(query)
+    rows, err := s.db.Query(query, q.args...)
     if err != nil {
-        return nil, err
+        return err
     }
     defer rows.Close()
     
-    var invoices []models.Invoice
     for rows.Next() {
         var invoice models.Invoice
         var customer models.Customer
+        var customerName, phone, email, address sql.NullString
         
         err := rows.Scan(
             &invoice.InvoiceID, &invoice.InvoiceNumber, &invoice.CustomerID, &invoice.InvoiceDate,
-            &invoice.SubTotal, &invoice.TaxRate, &invoice.TaxAmount, &invoice.TotalAmount,
-            &customer.CustomerName, &customer.Phone, &customer.Email, &customer.Address,
+            &invoice.SubTotal, &invoice.TaxRate, &invoice.TaxAmount, &invoice.TotalAmount, &invoice.Status,
+            &customerName, &phone, &email, &address,
         )
         if err != nil {
-            return nil, err
+            return err
         }
         
         customer.CustomerID = invoice.CustomerID
+        customer.CustomerName = customerName.String
+        customer.Phone = phone.String
+        customer.Email = email.String
+        customer.Address = address.String
         invoice.Customer = &customer
-        invoices = append(invoices, invoice)
+        if err := fn(invoice); err != nil {
+            return err
+        }
     }
     
-    return invoices, nil
+    return rows.Err()
+}
+
+// EachInvoiceWithItems streams the invoices matching the filter, with their
+// customer and line items, to fn. Paging is ignored. Rows are read in invoice
+// order so only one invoice is held at a time.
+func (s *InvoiceService) EachInvoiceWithItems(filter models.InvoiceFilter, fn func(*models.Invoice) error) error {
+    q := invoiceListQuery(filter)
+    query := `
+        SELECT i.InvoiceID, i.InvoiceNumber, i.CustomerID, i.InvoiceDate,
+               i.SubTotal, i.TaxRate, i.TaxAmount, i.TotalAmount, i.Status,
+               c.CustomerName, c.Phone, c.Email, c.Address,
+               ii.InvoiceItemID, ii.ItemID, ii.Quantity, ii.UnitPrice, ii.TotalPrice,
+               ii.ParentInvoiceItemID, ii.SlotName, ii.ItemName, ii.ItemDescription, ii.CategoryID, ii.CategoryName
+        FROM Invoices i
+        LEFT JOIN Customers c ON i.CustomerID = c.CustomerID
+        LEFT JOIN InvoiceItems ii ON ii.InvoiceID = i.InvoiceID
+        ` + q.clause() + `
+        ORDER BY i.InvoiceID, ii.InvoiceItemID
+    `
+    
+    rows, err := s.db.Query(query, q.args...)
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+    
+    var current *models.Invoice
+    for rows.Next() {
+        var invoice models.Invoice
+        var customerName, phone, email, address sql.NullString
+        var invoiceItemID, itemID, quantity, parentID sql.NullInt64
+        var unitPrice, totalPrice sql.NullFloat64
+        var slotName sql.NullString
+        var snapshot lineSnapshot
+        
+        err := rows.Scan(
+            &invoice.InvoiceID, &invoice.InvoiceNumber, &invoice.CustomerID, &invoice.InvoiceDate,
+            &invoice.SubTotal, &invoice.TaxRate, &invoice.TaxAmount, &invoice.TotalAmount, &invoice.Status,
+            &customerName, &phone, &email, &address,
+            &invoiceItemID, &itemID, &quantity, &unitPrice, &totalPrice,
+            &parentID, &slotName, &snapshot.itemName, &snapshot.description, &snapshot.categoryID, &snapshot.categoryName,
+        )
+        if err != nil {
+            return err
+        }
+        
+        if current == nil || current.InvoiceID != invoice.InvoiceID {
+            if current != nil {
+                if err := fn(current); err != nil {
+                    return err
+                }
+            }
+            invoice.Customer = &models.Customer{
+                CustomerID:   invoice.CustomerID,
+                CustomerName: customerName.String,
+                Phone:        phone.String,
+                Email:        email.String,
+                Address:      address.String,
+            }
+            current = &invoice
+        }
+        
+        // Invoices without lines still produce one row from the LEFT JOIN
+        if !invoiceItemID.Valid {
+            continue
+        }
+        
+        // Lines stay flat here, with bundle components pointing at their bundle line
+        line := models.InvoiceItem{
+            InvoiceItemID: int(invoiceItemID.Int64),
+            InvoiceID:     current.InvoiceID,
+            ItemID:        int(itemID.Int64),
+            Quantity:      int(quantity.Int64),
+            UnitPrice:     unitPrice.Float64,
+            TotalPrice:    totalPrice.Float64,
+            SlotName:      slotName.String,
+            Item:          snapshot.item(int(itemID.Int64)),
+        }
+        if parentID.Valid {
+            id := int(parentID.Int64)
+            line.ParentInvoiceItemID = &id
+        }
+        current.Items = append(current.Items, line)
+    }
+    
+    if err := rows.Err(); err != nil {
+        return err
+    }
+    
+    if current != nil {
+        return fn(current)
+    }
+    return nil
 }
 
 func (s *InvoiceService) GetInvoiceByID(invoiceID int) (*models.Invoice, error) {
+    return loadInvoice(s.db, invoiceID)
+}
+
+// lineSnapshotColumns are the InvoiceItems columns that record what was sold,
+// filled by lineSnapshotValues from an Items query aliased i joined to its
+// category as c.
+const (
+    lineSnapshotColumns = `ItemName, ItemDescription, CategoryID, CategoryName`
+    lineSnapshotValues  = `i.ItemName, i.Description, i.CategoryID, c.CategoryName`
+)
+
+// lineSnapshot is the item as recorded on an invoice line.
+type lineSnapshot struct {
+    itemName     sql.NullString
+    description  sql.NullString
+    categoryID   sql.NullInt64
+    categoryName sql.NullString
+}
+
+func (l *lineSnapshot) item(itemID int) *models.Item {
+    item := &models.Item{
+        ItemID:      itemID,
+        ItemName:    l.itemName.String,
+        Description: l.description.String,
+    }
+    if l.categoryID.Valid {
+        item.CategoryID = int(l.categoryID.Int64)
+        item.Category = &models.Category{CategoryID: item.CategoryID, CategoryName: l.categoryName.String}
+    }
+    return item
+}
+
+// loadInvoice reads an invoice with its customer and line items. Inside a
+// transaction it sees the transaction's own uncommitted changes.
+func loadInvoice(q querier, invoiceID int) (*models.Invoice, error) {
     // Get invoice details
     query := `
         SELECT i.InvoiceID, i.InvoiceNumber, i.CustomerID, i.InvoiceDate, 
-               i.SubTotal, i.TaxRate, i.TaxAmount, i.TotalAmount,
+               i.SubTotal, i.TaxRate, i.TaxAmount, i.TotalAmount, i.Status,
+               i.VoidedAt, i.VoidedBy, i.VoidReason, i.VoidApprovalID,
                c.CustomerName, c.Phone, c.Email, c.Address
         FROM Invoices i
         LEFT JOIN Customers c ON i.CustomerID = c.CustomerID
@@ -134,59 +516,108 @@ func (s *InvoiceService) GetInvoiceByID(invoiceID int) (*models.Invoice, error)
     
     var invoice models.Invoice
     var customer models.Customer
+    var voidedAt sql.NullTime
+    var voidedBy sql.NullInt64
+    var voidReason sql.NullString
+    var voidApprovalID sql.NullInt64
+    var customerName, phone, email, address sql.NullString
     
-    err := s.db.QueryRow(query, invoiceID).Scan(
+    err := q.QueryRow(query, invoiceID).Scan(
         &invoice.InvoiceID, &invoice.InvoiceNumber, &invoice.CustomerID, &invoice.InvoiceDate,
-        &invoice.SubTotal, &invoice.TaxRate, &invoice.TaxAmount, &invoice.TotalAmount,
-        &customer.CustomerName, &customer.Phone, &customer.Email, &customer.Address,
+        &invoice.SubTotal, &invoice.TaxRate, &invoice.TaxAmount, &invoice.TotalAmount, &invoice.Status,
+        &voidedAt, &voidedBy, &voidReason, &voidApprovalID,
+        &customerName, &phone, &email, &address,
     )
+    if err == sql.ErrNoRows {
+        return nil, NotFoundError("invoice", invoiceID)
+    }
     if err != nil {
         return nil, err
     }
     
+    if voidedAt.Valid {
+        invoice.VoidedAt = &voidedAt.Time
+    }
+    if voidedBy.Valid {
+        id := int(voidedBy.Int64)
+        invoice.VoidedBy = &id
+    }
+    invoice.VoidReason = voidReason.String
+    if voidApprovalID.Valid {
+        id := int(voidApprovalID.Int64)
+        invoice.VoidApprovalID = &id
+    }
+    
     customer.CustomerID = invoice.CustomerID
+    customer.CustomerName = customerName.String
+    customer.Phone = phone.String
+    customer.Email = email.String
+    customer.Address = address.String
     invoice.Customer = &customer
     
-    // Get invoice items
+    // Get invoice items; components follow their bundle line in id order
     itemsQuery := `
-        SELECT ii.InvoiceItemID, ii.InvoiceID, ii.ItemID, ii.Quantity, ii.UnitPrice, ii.TotalPrice,
-               i.ItemName, i.Description
+        SELECT ii.InvoiceItemID, ii.InvoiceID, ii.ItemID, ii.Quantity, ii.UnitPrice, ii.TotalPrice, ii.PriceApprovalID, ii.PriceRuleID,
+               ii.ParentInvoiceItemID, ii.SlotName, ii.ItemName, ii.ItemDescription, ii.CategoryID, ii.CategoryName
         FROM InvoiceItems ii
-        LEFT JOIN Items i ON ii.ItemID = i.ItemID
         WHERE ii.InvoiceID = ?
+        ORDER BY ii.InvoiceItemID
     `
     
-    rows, err := s.db.Query(itemsQuery, invoiceID)
+    rows, err := q.Query(itemsQuery, invoiceID)
     if err != nil {
         return nil, err
     }
     defer rows.Close()
     
     var items []models.InvoiceItem
+    lineIndex := make(map[int]int)
     for rows.Next() {
         var item models.InvoiceItem
-        var itemDetails models.Item
+        var priceApprovalID, priceRuleID, parentID sql.NullInt64
+        var slotName sql.NullString
+        var snapshot lineSnapshot
         
         err := rows.Scan(
             &item.InvoiceItemID, &item.InvoiceID, &item.ItemID, &item.Quantity,
-            &item.UnitPrice, &item.TotalPrice,
-            &itemDetails.ItemName, &itemDetails.Description,
+            &item.UnitPrice, &item.TotalPrice, &priceApprovalID, &priceRuleID,
+            &parentID, &slotName, &snapshot.itemName, &snapshot.description, &snapshot.categoryID, &snapshot.categoryName,
         )
         if err != nil {
             return nil, err
         }
+        if priceApprovalID.Valid {
+            id := int(priceApprovalID.Int64)
+            item.PriceApprovalID = &id
+        }
+        if priceRuleID.Valid {
+            id := int(priceRuleID.Int64)
+            item.PriceRuleID = &id
+        }
         
-        itemDetails.ItemID = item.ItemID
-        item.Item = &itemDetails
+        item.Item = snapshot.item(item.ItemID)
+        item.SlotName = slotName.String
+        if parentID.Valid {
+            id := int(parentID.Int64)
+            item.ParentInvoiceItemID = &id
+            if i, ok := lineIndex[id]; ok {
+                items[i].Components = append(items[i].Components, item)
+                continue
+            }
+        }
+        lineIndex[item.InvoiceItemID] = len(items)
         items = append(items, item)
     }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
     
     invoice.Items = items
     return &invoice, nil
 }
 
 func (s *InvoiceService) GetAllCustomers() ([]models.Customer, error) {
-    query := `SELECT CustomerID, CustomerName, Phone, Email, Address FROM Customers ORDER BY CustomerName`
+    query := `SELECT CustomerID, CustomerName, Phone, Email, Address FROM Customers WHERE ArchivedAt IS NULL ORDER BY CustomerName`
     
     rows, err := s.db.Query(query)
     if err != nil {
@@ -197,23 +628,22 @@ func (s *InvoiceService) GetAllCustomers() ([]models.Customer, error) {
     var customers []models.Customer
     for rows.Next() {
         var customer models.Customer
-        err := rows.Scan(&customer.CustomerID, &customer.CustomerName, &customer.Phone, &customer.Email, &customer.Address)
+        var phone, email, address sql.NullString
+        err := rows.Scan(&customer.CustomerID, &customer.CustomerName, &phone, &email, &address)
         if err != nil {
             return nil, err
         }
+        customer.Phone = phone.String
+        customer.Email = email.String
+        customer.Address = address.String
         customers = append(customers, customer)
     }
     
-    return customers, nil
+    return customers, rows.Err()
 }
 
-func (s *InvoiceService) CreateCustomer(customer *models.Customer) error {
-    query := `
-        INSERT INTO Customers (CustomerName, Phone, Email, Address)
-        OUTPUT INSERTED.CustomerID
-        VALUES (?, ?, ?, ?)
-    `
-    
-    err := s.db.QueryRow(query, customer.CustomerName, customer.Phone, customer.Email, customer.Address).Scan(&customer.CustomerID)
-    return err
+func (s *InvoiceService) CreateCustomer(customer *models.Customer, actor *models.User) error {
+    // Shares the customer service's insert so the change is audited the same way
+    customers := &CustomerService{db: s.db}
+    return customers.CreateCustomer(customer, actor)
 }
\ No newline at end of file
@@ -0,0 +1,122 @@
+package services
+
+import (
+    "database/sql"
+    "fmt"
+    "time"
+    "backend/models"
+)
+
+// Item availability states. Sold out items come back automatically once
+// SoldOutUntil has passed; hidden items are off the menu until shown again.
+const (
+    ItemAvailable = "available"
+    ItemSoldOut   = "sold_out"
+    ItemHidden    = "hidden"
+)
+
+// Sources of an availability change. Stock-driven changes only undo
+// availability that stock set, so a manual "86" is never cleared by a delivery.
+const (
+    AvailabilityManual = "manual"
+    AvailabilityStock  = "stock"
+)
+
+// availabilityExpr is the effective availability of an Items row aliased i.
+const availabilityExpr = `CASE WHEN i.Availability = 'sold_out' AND i.SoldOutUntil <= GETDATE() THEN 'available' ELSE i.Availability END`
+
+// SetAvailability marks an item available, sold out (optionally until a
+// time) or hidden.
+func (s *ItemService) SetAvailability(itemID int, req *models.SetAvailabilityRequest, actor *models.User) (*models.Item, error) {
+    if req.Status != ItemSoldOut && req.Until != nil {
+        return nil, FieldError("until", "can only be set when status is sold_out")
+    }
+    if req.Until != nil && !req.Until.After(time.Now()) {
+        return nil, FieldError("until", "must be in the future")
+    }
+
+    tx, err := s.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    before, err := loadItem(tx, itemID)
+    if err != nil {
+        return nil, err
+    }
+
+    if err := setAvailability(tx, itemID, req.Status, req.Until, AvailabilityManual); err != nil {
+        return nil, err
+    }
+
+    after, err := loadItem(tx, itemID)
+    if err != nil {
+        return nil, err
+    }
+
+    if err := writeAudit(tx, actor, AuditItem, itemID, AuditAvailability, before, after); err != nil {
+        return nil, err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+
+    return after, nil
+}
+
+// setAvailability stores an item's availability inside tx.
+func setAvailability(tx *sql.Tx, itemID int, status string, until *time.Time, source string) error {
+    result, err := tx.Exec(`
+        UPDATE Items SET Availability = ?, SoldOutUntil = ?, AvailabilitySource = ?
+        WHERE ItemID = ?
+    `, status, until, source, itemID)
+    if err != nil {
+        return err
+    }
+    return checkAffected(result, "item", itemID)
+}
+
+// checkAvailable returns a validation error for field when the item cannot be
+// sold right now. Items in an inactive category, or under one, are treated as
+// hidden, and archived items cannot be sold at all.
+func checkAvailable(q querier, itemID int, field string) error {
+    var name, status string
+    var until, archivedAt sql.NullTime
+    var inactive int
+    err := q.QueryRow(`
+        WITH Ancestors AS (
+            SELECT c.CategoryID, c.ParentCategoryID, c.IsActive
+            FROM Items i JOIN Categories c ON i.CategoryID = c.CategoryID
+            WHERE i.ItemID = ?
+            UNION ALL
+            SELECT c.CategoryID, c.ParentCategoryID, c.IsActive
+            FROM Categories c JOIN Ancestors a ON c.CategoryID = a.ParentCategoryID
+        )
+        SELECT i.ItemName, `+availabilityExpr+`, i.SoldOutUntil, i.ArchivedAt,
+               (SELECT COUNT(*) FROM Ancestors WHERE IsActive = 0)
+        FROM Items i WHERE i.ItemID = ?
+    `, itemID, itemID).Scan(&name, &status, &until, &archivedAt, &inactive)
+    if err != nil {
+        return err
+    }
+    if inactive > 0 {
+        status = ItemHidden
+    }
+
+    var message string
+    switch {
+    case archivedAt.Valid:
+        message = fmt.Sprintf("%s is archived", name)
+    case status == ItemSoldOut && until.Valid:
+        message = fmt.Sprintf("%s is sold out until %s", name, until.Time.Format("2006-01-02 15:04"))
+    case status == ItemSoldOut:
+        message = fmt.Sprintf("%s is sold out", name)
+    case status == ItemHidden:
+        message = fmt.Sprintf("%s is not on sale", name)
+    default:
+        return nil
+    }
+    return ValidationError(message, map[string]string{field: message})
+}
@@ -0,0 +1,253 @@
+package services
+
+import (
+    "database/sql"
+    "fmt"
+    "backend/models"
+)
+
+// GetBundle returns the slots of a bundle item. It is empty for plain items.
+func (s *ItemService) GetBundle(itemID int) ([]models.BundleSlot, error) {
+    if _, err := loadItem(s.db, itemID); err != nil {
+        return nil, err
+    }
+    return loadBundle(s.db, itemID)
+}
+
+// SetBundle replaces the slots of a bundle item. An empty list turns the item
+// back into a plain item. Bundles cannot contain other bundles.
+func (s *ItemService) SetBundle(itemID int, slots []models.BundleSlot, actor *models.User) ([]models.BundleSlot, error) {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    if _, err := loadItem(tx, itemID); err != nil {
+        return nil, err
+    }
+    before, err := loadBundle(tx, itemID)
+    if err != nil {
+        return nil, err
+    }
+
+    if len(slots) > 0 {
+        var count int
+        if err := tx.QueryRow(`SELECT COUNT(*) FROM BundleChoices WHERE ItemID = ?`, itemID).Scan(&count); err != nil {
+            return nil, err
+        }
+        if count > 0 {
+            return nil, ConflictError("item %d is a choice in another bundle and cannot be a bundle itself", itemID)
+        }
+    }
+    for i, slot := range slots {
+        for j, choice := range slot.Choices {
+            field := fmt.Sprintf("slots[%d].choices[%d].item_id", i, j)
+            if choice.ItemID == itemID {
+                return nil, FieldError(field, "a bundle cannot contain itself")
+            }
+            var count int
+            if err := tx.QueryRow(`SELECT COUNT(*) FROM BundleSlots WHERE BundleItemID = ?`, choice.ItemID).Scan(&count); err != nil {
+                return nil, err
+            }
+            if count > 0 {
+                return nil, FieldError(field, fmt.Sprintf("item %d is a bundle; bundles cannot contain other bundles", choice.ItemID))
+            }
+        }
+    }
+
+    if err := deleteBundle(tx, itemID); err != nil {
+        return nil, err
+    }
+    for i, slot := range slots {
+        var slotID int
+        err := tx.QueryRow(`
+            INSERT INTO BundleSlots (BundleItemID, Name, Quantity, SortOrder)
+            OUTPUT INSERTED.SlotID
+            VALUES (?, ?, ?, ?)
+        `, itemID, slot.Name, slot.Quantity, i).Scan(&slotID)
+        if err != nil {
+            return nil, err
+        }
+        for _, choice := range slot.Choices {
+            _, err := tx.Exec(`
+                INSERT INTO BundleChoices (SlotID, ItemID, Surcharge)
+                VALUES (?, ?, ?)
+            `, slotID, choice.ItemID, choice.Surcharge)
+            if err != nil {
+                return nil, err
+            }
+        }
+    }
+
+    after, err := loadBundle(tx, itemID)
+    if err != nil {
+        return nil, err
+    }
+    if err := writeAudit(tx, actor, AuditItem, itemID, AuditBundle, before, after); err != nil {
+        return nil, err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+
+    return after, nil
+}
+
+func deleteBundle(tx *sql.Tx, itemID int) error {
+    _, err := tx.Exec(`
+        DELETE FROM BundleChoices
+        WHERE SlotID IN (SELECT SlotID FROM BundleSlots WHERE BundleItemID = ?)
+    `, itemID)
+    if err != nil {
+        return err
+    }
+    _, err = tx.Exec(`DELETE FROM BundleSlots WHERE BundleItemID = ?`, itemID)
+    return err
+}
+
+func loadBundle(q querier, itemID int) ([]models.BundleSlot, error) {
+    rows, err := q.Query(`
+        SELECT s.SlotID, s.Name, s.Quantity, c.ItemID, i.ItemName, c.Surcharge
+        FROM BundleSlots s
+        JOIN BundleChoices c ON c.SlotID = s.SlotID
+        JOIN Items i ON c.ItemID = i.ItemID
+        WHERE s.BundleItemID = ?
+        ORDER BY s.SortOrder, s.SlotID, i.ItemName
+    `, itemID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    slots := []models.BundleSlot{}
+    for rows.Next() {
+        var slot models.BundleSlot
+        var choice models.BundleChoice
+        if err := rows.Scan(&slot.SlotID, &slot.Name, &slot.Quantity, &choice.ItemID, &choice.ItemName, &choice.Surcharge); err != nil {
+            return nil, err
+        }
+
+        // Rows arrive grouped by slot, so a new slot starts whenever the id changes
+        if len(slots) == 0 || slots[len(slots)-1].SlotID != slot.SlotID {
+            slots = append(slots, slot)
+        }
+        last := &slots[len(slots)-1]
+        last.Choices = append(last.Choices, choice)
+    }
+
+    return slots, rows.Err()
+}
+
+// bundleComponent is one item chosen for a bundle, with the quantity of it in
+// a single bundle.
+type bundleComponent struct {
+    slotName string
+    itemID   int
+    quantity int
+}
+
+// expandBundle checks the choices made for one invoice line against the
+// item's bundle slots and returns the chosen components and the total
+// surcharge for one bundle. field names the line for error messages. Plain
+// items have no components and take no choices.
+func expandBundle(q querier, itemID int, choices []models.BundleSelection, field string) ([]bundleComponent, float64, error) {
+    slots, err := loadBundle(q, itemID)
+    if err != nil {
+        return nil, 0, err
+    }
+    if len(slots) == 0 {
+        if len(choices) > 0 {
+            return nil, 0, FieldError(field+".choices", fmt.Sprintf("item %d is not a bundle", itemID))
+        }
+        return nil, 0, nil
+    }
+
+    slotByID := make(map[int]*models.BundleSlot, len(slots))
+    for i := range slots {
+        slotByID[slots[i].SlotID] = &slots[i]
+    }
+
+    var components []bundleComponent
+    var surcharge float64
+    index := make(map[[2]int]int)
+    chosen := make(map[int]int)
+    for j, selection := range choices {
+        slot, ok := slotByID[selection.SlotID]
+        if !ok {
+            return nil, 0, FieldError(fmt.Sprintf("%s.choices[%d].slot_id", field, j),
+                fmt.Sprintf("slot %d is not part of item %d", selection.SlotID, itemID))
+        }
+
+        itemField := fmt.Sprintf("%s.choices[%d].item_id", field, j)
+        var choice *models.BundleChoice
+        for k := range slot.Choices {
+            if slot.Choices[k].ItemID == selection.ItemID {
+                choice = &slot.Choices[k]
+            }
+        }
+        if choice == nil {
+            return nil, 0, FieldError(itemField, fmt.Sprintf("item %d is not a choice for %s", selection.ItemID, slot.Name))
+        }
+        if err := checkAvailable(q, selection.ItemID, itemField); err != nil {
+            return nil, 0, err
+        }
+
+        surcharge += choice.Surcharge
+        chosen[slot.SlotID]++
+        key := [2]int{slot.SlotID, selection.ItemID}
+        if k, ok := index[key]; ok {
+            components[k].quantity++
+            continue
+        }
+        index[key] = len(components)
+        components = append(components, bundleComponent{slotName: slot.Name, itemID: selection.ItemID, quantity: 1})
+    }
+
+    for _, slot := range slots {
+        if chosen[slot.SlotID] != slot.Quantity {
+            return nil, 0, FieldError(field+".choices",
+                fmt.Sprintf("choose %d for %s, got %d", slot.Quantity, slot.Name, chosen[slot.SlotID]))
+        }
+    }
+
+    return components, surcharge, nil
+}
+
+// insertBundleComponents adds the components of a sold bundle as zero-priced
+// lines under its line, then costs the bundle line as the sum of its
+// components plus any recipe of its own, such as packaging.
+func insertBundleComponents(tx *sql.Tx, invoiceID, parentID, quantity int, components []bundleComponent) error {
+    if len(components) == 0 {
+        return nil
+    }
+
+    for _, c := range components {
+        _, err := tx.Exec(`
+            INSERT INTO InvoiceItems (InvoiceID, ItemID, Quantity, UnitPrice, TotalPrice, UnitCost, ParentInvoiceItemID, SlotName,
+                                      `+lineSnapshotColumns+`)
+            SELECT ?, i.ItemID, ?, 0, 0, fc.FoodCost, ?, ?, `+lineSnapshotValues+`
+            FROM Items i
+            LEFT JOIN Categories c ON i.CategoryID = c.CategoryID
+            `+foodCostApply+`
+            WHERE i.ItemID = ?
+        `, invoiceID, c.quantity*quantity, parentID, c.slotName, c.itemID)
+        if err != nil {
+            return err
+        }
+    }
+
+    _, err := tx.Exec(`
+        UPDATE p SET UnitCost = cc.Cost / p.Quantity + COALESCE(fc.FoodCost, 0)
+        FROM InvoiceItems p
+        JOIN Items i ON p.ItemID = i.ItemID
+        `+foodCostApply+`
+        CROSS APPLY (
+            SELECT CASE WHEN COUNT(c.UnitCost) = COUNT(*) THEN SUM(c.Quantity * c.UnitCost) END AS Cost
+            FROM InvoiceItems c WHERE c.ParentInvoiceItemID = p.InvoiceItemID
+        ) cc
+        WHERE p.InvoiceItemID = ?
+    `, parentID)
+    return err
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+    "database/sql"
+    "fmt"
+    "strings"
+    "backend/models"
+)
+
+// LookupItem finds the item with the given SKU, barcode or PLU, priced as
+// the item list prices it, so a scanner can resolve a code in one call.
+func (s *ItemService) LookupItem(code string) (*models.Item, error) {
+    code = strings.TrimSpace(code)
+    items, _, err := s.ListItems(models.ItemFilter{Code: code})
+    if err != nil {
+        return nil, err
+    }
+    if len(items) == 0 {
+        return nil, &AppError{Code: CodeNotFound, Message: fmt.Sprintf("no item has code %q", code)}
+    }
+    return &items[0], nil
+}
+
+// nullCode stores an unset code as NULL, which the unique indexes ignore.
+func nullCode(code string) interface{} {
+    if code == "" {
+        return nil
+    }
+    return code
+}
+
+// checkItemCodes rejects codes that another item already uses. A lookup
+// matches any kind of code, so a PLU may not equal another item's SKU either.
+func checkItemCodes(q querier, item *models.Item) error {
+    codes := []struct{ field, code string }{{"sku", item.SKU}, {"barcode", item.Barcode}, {"plu", item.PLU}}
+    for _, c := range codes {
+        if c.code == "" {
+            continue
+        }
+        var otherID int
+        err := q.QueryRow(`
+            SELECT TOP 1 ItemID FROM Items
+            WHERE ItemID <> ? AND (SKU = ? OR Barcode = ? OR PLU = ?)
+        `, item.ItemID, c.code, c.code, c.code).Scan(&otherID)
+        if err == sql.ErrNoRows {
+            continue
+        }
+        if err != nil {
+            return err
+        }
+        return FieldError(c.field, fmt.Sprintf("is already used by item %d", otherID))
+    }
+    return nil
+}
+
+// resolveItemCode finds the item with the given SKU, barcode or PLU.
+func resolveItemCode(q querier, code string) (int, error) {
+    var itemID int
+    err := q.QueryRow(`
+        SELECT ItemID FROM Items WHERE SKU = ? OR Barcode = ? OR PLU = ?
+    `, code, code, code).Scan(&itemID)
+    if err == sql.ErrNoRows {
+        return 0, &AppError{Code: CodeNotFound, Message: fmt.Sprintf("no item has code %q", code)}
+    }
+    return itemID, err
+}
+
+// lineItemID returns the item an invoice line is for, looking it up by code
+// when the line has one. field names the line for error messages.
+func lineItemID(q querier, line models.CreateInvoiceItemRequest, field string) (int, error) {
+    code := strings.TrimSpace(line.Code)
+    if code == "" {
+        if line.ItemID == 0 {
+            return 0, FieldError(field+".item_id", "item_id or code is required")
+        }
+        return line.ItemID, nil
+    }
+
+    itemID, err := resolveItemCode(q, code)
+    if appErr, ok := err.(*AppError); ok && appErr.Code == CodeNotFound {
+        return 0, FieldError(field+".code", appErr.Message)
+    }
+    if err != nil {
+        return 0, err
+    }
+    if line.ItemID != 0 && line.ItemID != itemID {
+        return 0, FieldError(field+".code", fmt.Sprintf("code %q belongs to item %d, not item %d", code, itemID, line.ItemID))
+    }
+    return itemID, nil
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+    "database/sql"
+    "math"
+    "backend/models"
+)
+
+// foodCostApply joins the theoretical cost of one unit onto an Items query
+// aliased i, as fc.FoodCost: the recipe priced at each ingredient's latest
+// purchase cost. It is NULL for items without a recipe and for recipes with
+// an ingredient that has never been bought, since a partial cost would
+// overstate the margin.
+const foodCostApply = `
+        OUTER APPLY (
+            SELECT CASE WHEN COUNT(g.UnitCost) = COUNT(*) THEN SUM(r.Quantity * g.UnitCost) END AS FoodCost
+            FROM RecipeLines r
+            JOIN Ingredients g ON r.IngredientID = g.IngredientID
+            WHERE r.ItemID = i.ItemID
+        ) fc`
+
+// marginPercentExpr is the margin of the current price over fc.FoodCost, for sorting.
+const marginPercentExpr = `CASE WHEN COALESCE(cp.Price, i.BasePrice) > 0
+        THEN (COALESCE(cp.Price, i.BasePrice) - fc.FoodCost) * 100 / COALESCE(cp.Price, i.BasePrice) END`
+
+// setFoodCost fills in the item's food cost and its margin over the base
+// price. Both stay unset when the cost is unknown.
+func setFoodCost(item *models.Item, cost sql.NullFloat64) {
+    if !cost.Valid {
+        return
+    }
+
+    foodCost := roundMoney(cost.Float64)
+    item.FoodCost = &foodCost
+    item.MarginPercent = marginPercent(item.BasePrice, cost.Float64)
+}
+
+// marginPercent is the share of revenue left after cost, to one decimal
+// place. It is nil when there is no revenue to take a share of.
+func marginPercent(revenue, cost float64) *float64 {
+    if revenue <= 0 {
+        return nil
+    }
+    margin := math.Round((revenue-cost)*1000/revenue) / 10
+    return &margin
+}
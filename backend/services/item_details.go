@@ -0,0 +1,67 @@
+package services
+
+import (
+    "database/sql"
+    "strings"
+    "backend/models"
+)
+
+// itemDetailColumns selects the menu details, codes and archive time of an
+// Items query aliased i, in the order itemDetails.targets scans them.
+const itemDetailColumns = `i.Allergens, i.IsVegetarian, i.IsVegan, i.SpicyLevel, i.Calories, i.ImageKey, i.ThumbnailKey,
+               i.SKU, i.Barcode, i.PLU, i.ArchivedAt`
+
+// itemDetails holds the detail columns that need converting after a scan.
+type itemDetails struct {
+    allergens    string
+    calories     sql.NullInt64
+    imageKey     sql.NullString
+    thumbnailKey sql.NullString
+    sku          sql.NullString
+    barcode      sql.NullString
+    plu          sql.NullString
+    archivedAt   sql.NullTime
+}
+
+func (d *itemDetails) targets(item *models.Item) []interface{} {
+    return []interface{}{&d.allergens, &item.Vegetarian, &item.Vegan, &item.SpicyLevel, &d.calories, &d.imageKey, &d.thumbnailKey,
+        &d.sku, &d.barcode, &d.plu, &d.archivedAt}
+}
+
+func (d *itemDetails) apply(item *models.Item) {
+    item.Allergens = []string{}
+    if d.allergens != "" {
+        item.Allergens = strings.Split(d.allergens, ",")
+    }
+    if d.calories.Valid {
+        calories := int(d.calories.Int64)
+        item.Calories = &calories
+    }
+    if d.imageKey.Valid {
+        item.ImageURL = ImageURLPrefix + d.imageKey.String
+    }
+    if d.thumbnailKey.Valid {
+        item.ThumbnailURL = ImageURLPrefix + d.thumbnailKey.String
+    }
+    item.SKU = d.sku.String
+    item.Barcode = d.barcode.String
+    item.PLU = d.plu.String
+    if d.archivedAt.Valid {
+        item.ArchivedAt = &d.archivedAt.Time
+    }
+}
+
+// normalizeItemDetails makes vegan items vegetarian, trims the item's codes
+// and returns the allergens as stored.
+func normalizeItemDetails(item *models.Item) string {
+    if item.Vegan {
+        item.Vegetarian = true
+    }
+    item.SKU = strings.TrimSpace(item.SKU)
+    item.Barcode = strings.TrimSpace(item.Barcode)
+    item.PLU = strings.TrimSpace(item.PLU)
+    if item.Allergens == nil {
+        item.Allergens = []string{}
+    }
+    return strings.Join(item.Allergens, ",")
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+    "bytes"
+    "fmt"
+    "log"
+    "strings"
+    "backend/models"
+    "backend/imaging"
+)
+
+// ImageURLPrefix is the path the image route serves stored images under.
+const ImageURLPrefix = "/api/v1/images/"
+
+const (
+    // maxImagePixels stops oversized uploads before their pixels are decoded
+    maxImagePixels = 40_000_000
+    // thumbnailSize is the longest side of a thumbnail, in pixels
+    thumbnailSize = 320
+)
+
+// SetImage stores an uploaded JPEG or PNG as the item's image, with a
+// thumbnail. The upload is encoded again rather than stored as sent, so EXIF
+// data such as the camera's GPS position is not published with the menu. Each
+// upload gets new keys, so stored images never change and can be cached
+// indefinitely. The previous image is removed.
+func (s *ItemService) SetImage(itemID int, data []byte, actor *models.User) (*models.Item, error) {
+    img, format, err := imaging.Decode(data, maxImagePixels)
+    if err != nil {
+        return nil, FieldError("image", err.Error())
+    }
+    var original bytes.Buffer
+    if err := imaging.Encode(&original, img, format); err != nil {
+        return nil, err
+    }
+    var thumbnail bytes.Buffer
+    if err := imaging.Encode(&thumbnail, imaging.Thumbnail(img, thumbnailSize), format); err != nil {
+        return nil, err
+    }
+
+    ext := "jpg"
+    if format == imaging.PNG {
+        ext = "png"
+    }
+    base := fmt.Sprintf("items/%d-%s", itemID, randomToken(9))
+    imageKey, thumbnailKey := base+"."+ext, base+"-thumb."+ext
+
+    // Blobs are written first; if the database update fails they are removed again
+    if err := s.images.Put(imageKey, &original); err != nil {
+        return nil, err
+    }
+    if err := s.images.Put(thumbnailKey, &thumbnail); err != nil {
+        s.removeImages(imageKey)
+        return nil, err
+    }
+
+    item, before, err := s.saveImage(itemID, imageKey, thumbnailKey, actor)
+    if err != nil {
+        s.removeImages(imageKey, thumbnailKey)
+        return nil, err
+    }
+    s.removeImages(imageKeys(before)...)
+
+    return item, nil
+}
+
+// DeleteImage removes the item's image and thumbnail.
+func (s *ItemService) DeleteImage(itemID int, actor *models.User) (*models.Item, error) {
+    item, before, err := s.saveImage(itemID, nil, nil, actor)
+    if err != nil {
+        return nil, err
+    }
+    s.removeImages(imageKeys(before)...)
+
+    return item, nil
+}
+
+// saveImage points the item at new image keys, or none, and returns the
+// item after and before the change.
+func (s *ItemService) saveImage(itemID int, imageKey, thumbnailKey interface{}, actor *models.User) (*models.Item, *models.Item, error) {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return nil, nil, err
+    }
+    defer tx.Rollback()
+
+    before, err := loadItem(tx, itemID)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    _, err = tx.Exec(`UPDATE Items SET ImageKey = ?, ThumbnailKey = ? WHERE ItemID = ?`, imageKey, thumbnailKey, itemID)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    after, err := loadItem(tx, itemID)
+    if err != nil {
+        return nil, nil, err
+    }
+    if err := writeAudit(tx, actor, AuditItem, itemID, AuditImage, before, after); err != nil {
+        return nil, nil, err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, nil, err
+    }
+
+    return after, before, nil
+}
+
+// imageKeys returns the stored keys behind an item's image URLs.
+func imageKeys(item *models.Item) []string {
+    var keys []string
+    for _, url := range []string{item.ImageURL, item.ThumbnailURL} {
+        if url != "" {
+            keys = append(keys, strings.TrimPrefix(url, ImageURLPrefix))
+        }
+    }
+    return keys
+}
+
+// removeImages deletes blobs that are no longer referenced. The change that
+// released them has already happened, so failures are only logged.
+func (s *ItemService) removeImages(keys ...string) {
+    for _, key := range keys {
+        if err := s.images.Delete(key); err != nil {
+            log.Printf("remove image %s: %v", key, err)
+        }
+    }
+}
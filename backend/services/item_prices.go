@@ -0,0 +1,237 @@
+package services
+
+import (
+    "database/sql"
+    "time"
+    "backend/models"
+)
+
+// currentPriceApply joins the price in effect now onto an Items query aliased
+// i, as cp.Price. It is NULL for items without price history.
+const currentPriceApply = `
+        OUTER APPLY (
+            SELECT TOP 1 p.Price FROM ItemPrices p
+            WHERE p.ItemID = i.ItemID AND p.EffectiveFrom <= GETDATE()
+              AND (p.EffectiveTo IS NULL OR p.EffectiveTo > GETDATE())
+            ORDER BY p.EffectiveFrom DESC
+        ) cp`
+
+// priceScheduleTolerance allows for clock skew when a change is scheduled "now".
+const priceScheduleTolerance = time.Minute
+
+// GetPriceHistory returns every price period of an item, latest first,
+// including scheduled future prices.
+func (s *ItemService) GetPriceHistory(itemID int) ([]models.ItemPrice, error) {
+    if _, err := loadItem(s.db, itemID); err != nil {
+        return nil, err
+    }
+
+    rows, err := s.db.Query(`
+        SELECT ItemPriceID, ItemID, Price, EffectiveFrom, EffectiveTo, CreatedBy, CreatedAt
+        FROM ItemPrices WHERE ItemID = ?
+        ORDER BY EffectiveFrom DESC
+    `, itemID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    prices := []models.ItemPrice{}
+    for rows.Next() {
+        var price models.ItemPrice
+        var effectiveTo sql.NullTime
+        var createdBy sql.NullInt64
+        err := rows.Scan(&price.ItemPriceID, &price.ItemID, &price.Price, &price.EffectiveFrom,
+            &effectiveTo, &createdBy, &price.CreatedAt)
+        if err != nil {
+            return nil, err
+        }
+
+        if effectiveTo.Valid {
+            price.EffectiveTo = &effectiveTo.Time
+        }
+        if createdBy.Valid {
+            id := int(createdBy.Int64)
+            price.CreatedBy = &id
+        }
+        prices = append(prices, price)
+    }
+
+    return prices, rows.Err()
+}
+
+// SchedulePrice records a price for an item from the given time, which
+// defaults to now and may not be in the past. The price stays in effect until
+// the next scheduled change.
+func (s *ItemService) SchedulePrice(itemID int, req *models.SchedulePriceRequest, actor *models.User) (*models.ItemPrice, error) {
+    now := time.Now()
+    from := now
+    if req.EffectiveFrom != nil {
+        if req.EffectiveFrom.Before(now.Add(-priceScheduleTolerance)) {
+            return nil, FieldError("effective_from", "must not be in the past")
+        }
+        from = *req.EffectiveFrom
+    }
+
+    tx, err := s.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    before, err := loadItem(tx, itemID)
+    if err != nil {
+        return nil, err
+    }
+
+    price, err := schedulePrice(tx, itemID, *req.Price, from, actor)
+    if err != nil {
+        return nil, err
+    }
+
+    if err := writeAudit(tx, actor, AuditItem, itemID, AuditSchedulePrice, before, price); err != nil {
+        return nil, err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+
+    return price, nil
+}
+
+// CancelScheduledPrice removes a price change that has not yet taken effect.
+// The period before it is extended to cover its time span.
+func (s *ItemService) CancelScheduledPrice(itemID, itemPriceID int, actor *models.User) error {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    if _, err := loadItem(tx, itemID); err != nil {
+        return err
+    }
+
+    var price models.ItemPrice
+    var effectiveTo sql.NullTime
+    err = tx.QueryRow(`
+        SELECT ItemPriceID, ItemID, Price, EffectiveFrom, EffectiveTo
+        FROM ItemPrices WITH (UPDLOCK) WHERE ItemPriceID = ? AND ItemID = ?
+    `, itemPriceID, itemID).Scan(&price.ItemPriceID, &price.ItemID, &price.Price, &price.EffectiveFrom, &effectiveTo)
+    if err == sql.ErrNoRows {
+        return NotFoundError("price", itemPriceID)
+    }
+    if err != nil {
+        return err
+    }
+    if effectiveTo.Valid {
+        price.EffectiveTo = &effectiveTo.Time
+    }
+
+    if !price.EffectiveFrom.After(time.Now()) {
+        return ConflictError("price %d is already in effect and can only be replaced by a new price", itemPriceID)
+    }
+
+    if _, err := tx.Exec(`DELETE FROM ItemPrices WHERE ItemPriceID = ?`, itemPriceID); err != nil {
+        return err
+    }
+
+    _, err = tx.Exec(`
+        UPDATE ItemPrices SET EffectiveTo = ?
+        WHERE ItemID = ? AND EffectiveTo = ?
+    `, effectiveTo, itemID, price.EffectiveFrom)
+    if err != nil {
+        return err
+    }
+
+    if err := writeAudit(tx, actor, AuditItem, itemID, AuditCancelPrice, price, nil); err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+// schedulePrice inserts a price period starting at from inside tx. The period
+// in effect at that time is closed, and the new one runs until the next
+// scheduled change. A period starting at exactly the same time is replaced.
+func schedulePrice(tx *sql.Tx, itemID int, price float64, from time.Time, actor *models.User) (*models.ItemPrice, error) {
+    // DATETIME cannot store nanoseconds, so equal times must be whole seconds to compare equal
+    from = from.Truncate(time.Second)
+
+    var createdBy interface{}
+    if actor != nil {
+        createdBy = actor.UserID
+    }
+
+    result := &models.ItemPrice{ItemID: itemID, Price: price, EffectiveFrom: from}
+    var effectiveTo sql.NullTime
+    err := tx.QueryRow(`
+        UPDATE ItemPrices SET Price = ?, CreatedBy = ?, CreatedAt = GETDATE()
+        OUTPUT INSERTED.ItemPriceID, INSERTED.EffectiveTo, INSERTED.CreatedAt
+        WHERE ItemID = ? AND EffectiveFrom = ?
+    `, price, createdBy, itemID, from).Scan(&result.ItemPriceID, &effectiveTo, &result.CreatedAt)
+    if err != nil && err != sql.ErrNoRows {
+        return nil, err
+    }
+
+    if err == sql.ErrNoRows {
+        err = tx.QueryRow(`
+            SELECT MIN(EffectiveFrom) FROM ItemPrices WHERE ItemID = ? AND EffectiveFrom > ?
+        `, itemID, from).Scan(&effectiveTo)
+        if err != nil {
+            return nil, err
+        }
+
+        _, err = tx.Exec(`
+            UPDATE ItemPrices SET EffectiveTo = ?
+            WHERE ItemID = ? AND EffectiveFrom < ? AND (EffectiveTo IS NULL OR EffectiveTo > ?)
+        `, from, itemID, from, from)
+        if err != nil {
+            return nil, err
+        }
+
+        err = tx.QueryRow(`
+            INSERT INTO ItemPrices (ItemID, Price, EffectiveFrom, EffectiveTo, CreatedBy)
+            OUTPUT INSERTED.ItemPriceID, INSERTED.CreatedAt
+            VALUES (?, ?, ?, ?, ?)
+        `, itemID, price, from, effectiveTo, createdBy).Scan(&result.ItemPriceID, &result.CreatedAt)
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    if effectiveTo.Valid {
+        result.EffectiveTo = &effectiveTo.Time
+    }
+    if actor != nil {
+        result.CreatedBy = &actor.UserID
+    }
+
+    // BasePrice keeps the latest price that has taken effect for older readers
+    if !from.After(time.Now()) {
+        if _, err := tx.Exec(`UPDATE Items SET BasePrice = ? WHERE ItemID = ?`, price, itemID); err != nil {
+            return nil, err
+        }
+    }
+
+    return result, nil
+}
+
+// resolvePrice returns the price of an item in effect at the given time,
+// falling back to BasePrice for items without price history, and the item's
+// category for evaluating price rules.
+func resolvePrice(q querier, itemID int, at time.Time) (float64, int, error) {
+    var price float64
+    var categoryID int
+    err := q.QueryRow(`
+        SELECT COALESCE((
+            SELECT TOP 1 p.Price FROM ItemPrices p
+            WHERE p.ItemID = i.ItemID AND p.EffectiveFrom <= ?
+              AND (p.EffectiveTo IS NULL OR p.EffectiveTo > ?)
+            ORDER BY p.EffectiveFrom DESC
+        ), i.BasePrice), i.CategoryID
+        FROM Items i WHERE i.ItemID = ?
+    `, at, at, itemID).Scan(&price, &categoryID)
+    return price, categoryID, err
+}
@@ -2,116 +2,353 @@ package services
 
 import (
     "database/sql"
-    "fmt"
+    "time"
     "backend/models"
     "backend/database"
+    "backend/blobstore"
 )
 
 type ItemService struct {
-    db *sql.DB
+    db     *sql.DB
+    images blobstore.Store
 }
 
-func NewItemService() *ItemService {
+func NewItemService(images blobstore.Store) *ItemService {
     return &ItemService{
-        db: database.GetDB(),
+        db:     database.GetDB(),
+        images: images,
     }
 }
 
+var itemSortColumns = map[string]string{
+    "item_name":      "i.ItemName",
+    "base_price":     "COALESCE(cp.Price, i.BasePrice)",
+    "category_name":  "c.CategoryName",
+    "item_id":        "i.ItemID",
+    "food_cost":      "fc.FoodCost",
+    "margin_percent": marginPercentExpr,
+    "sort_order":     "i.SortOrder",
+}
+
 func (s *ItemService) GetAllItems() ([]models.Item, error) {
+    var items []models.Item
+    err := s.EachItem(models.ItemFilter{}, func(item models.Item) error {
+        items = append(items, item)
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    
+    return items, nil
+}
+
+// ListItems returns one page of items matching the filter and the total number of matches.
+func (s *ItemService) ListItems(filter models.ItemFilter) ([]models.Item, int, error) {
+    var total int
+    q := itemListQuery(filter)
+    err := s.db.QueryRow(`
+        SELECT COUNT(*)
+        FROM Items i
+        LEFT JOIN Categories c ON i.CategoryID = c.CategoryID
+        `+q.clause(), q.args...).Scan(&total)
+    if err != nil {
+        return nil, 0, err
+    }
+    
+    // Show the price a customer pays right now so the menu can display happy-hour prices
+    rules, err := loadPriceRules(s.db)
+    if err != nil {
+        return nil, 0, err
+    }
+    now := time.Now()
+    
+    items := []models.Item{}
+    err = s.EachItem(filter, func(item models.Item) error {
+        if price, ruleID := rules.priceAt(item.ItemID, item.CategoryID, item.BasePrice, now); ruleID != nil {
+            item.ActivePrice = &price
+            item.ActivePriceRuleID = ruleID
+        }
+        items = append(items, item)
+        return nil
+    })
+    if err != nil {
+        return nil, 0, err
+    }
+    
+    return items, total, nil
+}
+
+func itemListQuery(filter models.ItemFilter) *listQuery {
+    q := &listQuery{}
+    q.search(filter.Search, "i.ItemName")
+    if filter.CategoryID > 0 {
+        q.where("i.CategoryID = ?", filter.CategoryID)
+    }
+    if filter.Availability != "" {
+        q.where(availabilityExpr+" = ?", filter.Availability)
+    }
+    if !filter.IncludeArchived {
+        q.where("i.ArchivedAt IS NULL")
+    }
+    if filter.Code != "" {
+        q.where("(i.SKU = ? OR i.Barcode = ? OR i.PLU = ?)", filter.Code, filter.Code, filter.Code)
+    }
+    return q
+}
+
+// EachItem streams the items matching the filter to fn without holding the
+// full list in memory.
+func (s *ItemService) EachItem(filter models.ItemFilter, fn func(models.Item) error) error {
+    q := itemListQuery(filter)
+    order, err := orderAndPage(filter.ListParams, itemSortColumns, "i.ItemName, i.ItemID", "i.ItemID")
+    if err != nil {
+        return err
+    }
+    
     query := `
-        SELECT i.ItemID, i.ItemName, i.CategoryID, i.BasePrice, i.Description, c.CategoryName
+        SELECT i.ItemID, i.ItemName, i.CategoryID, COALESCE(cp.Price, i.BasePrice), i.Description, i.SortOrder,
+               ` + availabilityExpr + `, i.SoldOutUntil, c.CategoryName, fc.FoodCost,
+               CASE WHEN EXISTS (SELECT 1 FROM BundleSlots bs WHERE bs.BundleItemID = i.ItemID) THEN 1 ELSE 0 END,
+               ` + itemDetailColumns + `
         FROM Items i
         LEFT JOIN Categories c ON i.CategoryID = c.CategoryID
-        ORDER BY i.ItemName
-    `
-    // This query retrieves all items along with their category names.
-    rows, err := s.db.Query(query)
+        ` + currentPriceApply + `
+        ` + foodCostApply + `
+        ` + q.clause() + `
+        ` + order
+    // This query retrieves the items along with their category names.
+    rows, err := s.db.Query(query, q.args...)
     if err != nil {
-        return nil, err
+        return err
     }
     defer rows.Close()
     
-    var items []models.Item
     for rows.Next() {
         var item models.Item
         var category models.Category
+        var soldOutUntil sql.NullTime
+        var foodCost sql.NullFloat64
+        var details itemDetails
         
         // Scan the row into the item and category fields
-        err := rows.Scan(
+        dest := []interface{}{
             &item.ItemID, &item.ItemName, &item.CategoryID, &item.BasePrice,
-            &item.Description,
-            &category.CategoryName,
-        )
-        if err != nil {
-            return nil, err
+            &item.Description, &item.SortOrder, &item.Availability, &soldOutUntil,
+            &category.CategoryName, &foodCost, &item.IsBundle,
         }
+        if err := rows.Scan(append(dest, details.targets(&item)...)...); err != nil {
+            return err
+        }
+        details.apply(&item)
+        if item.Availability == ItemSoldOut && soldOutUntil.Valid {
+            item.SoldOutUntil = &soldOutUntil.Time
+        }
+        setFoodCost(&item, foodCost)
         
         category.CategoryID = item.CategoryID
         item.Category = &category
-        items = append(items, item) 
+        if err := fn(item); err != nil {
+            return err
+        }
     }
     
-    return items, nil
+    return rows.Err()
 }
 
-func (s *ItemService) CreateItem(item *models.Item) error {
+// GetItem returns one item as stored, including archived items.
+func (s *ItemService) GetItem(itemID int) (*models.Item, error) {
+    return loadItem(s.db, itemID)
+}
+
+func (s *ItemService) CreateItem(item *models.Item, actor *models.User) error {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+    
+    allergens := normalizeItemDetails(item)
+    if err := checkItemCodes(tx, item); err != nil {
+        return err
+    }
+    if err := checkNotArchived(tx, AuditCategory, item.CategoryID, "category_id"); err != nil {
+        return err
+    }
     query := `
-        INSERT INTO Items (ItemName, CategoryID, BasePrice, Description)
+        INSERT INTO Items (ItemName, CategoryID, BasePrice, Description, SortOrder,
+                           Allergens, IsVegetarian, IsVegan, SpicyLevel, Calories, SKU, Barcode, PLU)
         OUTPUT INSERTED.ItemID
-        VALUES (?, ?, ?, ?)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
     `
     
-    err := s.db.QueryRow(query, item.ItemName, item.CategoryID, item.BasePrice, item.Description).Scan(&item.ItemID)
-    return err
+    err = tx.QueryRow(query, item.ItemName, item.CategoryID, item.BasePrice, item.Description, item.SortOrder,
+        allergens, item.Vegetarian, item.Vegan, item.SpicyLevel, item.Calories,
+        nullCode(item.SKU), nullCode(item.Barcode), nullCode(item.PLU)).Scan(&item.ItemID)
+    if err != nil {
+        return err
+    }
+    
+    if _, err := schedulePrice(tx, item.ItemID, item.BasePrice, time.Now(), actor); err != nil {
+        return err
+    }
+    
+    if err := writeAudit(tx, actor, AuditItem, item.ItemID, AuditCreate, nil, item); err != nil {
+        return err
+    }
+    
+    return tx.Commit()
 }
 
-func (s *ItemService) UpdateItem(item *models.Item) error {
+func (s *ItemService) UpdateItem(item *models.Item, actor *models.User) error {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+    
+    before, err := loadItem(tx, item.ItemID)
+    if err != nil {
+        return err
+    }
+    
+    allergens := normalizeItemDetails(item)
+    if err := checkItemCodes(tx, item); err != nil {
+        return err
+    }
+    if item.CategoryID != before.CategoryID {
+        if err := checkNotArchived(tx, AuditCategory, item.CategoryID, "category_id"); err != nil {
+            return err
+        }
+    }
+    item.ArchivedAt = before.ArchivedAt
     query := `
         UPDATE Items 
-        SET ItemName = ?, CategoryID = ?, BasePrice = ?, Description = ?
+        SET ItemName = ?, CategoryID = ?, BasePrice = ?, Description = ?, SortOrder = ?,
+            Allergens = ?, IsVegetarian = ?, IsVegan = ?, SpicyLevel = ?, Calories = ?,
+            SKU = ?, Barcode = ?, PLU = ?
         WHERE ItemID = ?
     `
     
-    _, err := s.db.Exec(query, item.ItemName, item.CategoryID, item.BasePrice, item.Description, item.ItemID)
-    return err
+    result, err := tx.Exec(query, item.ItemName, item.CategoryID, item.BasePrice, item.Description, item.SortOrder,
+        allergens, item.Vegetarian, item.Vegan, item.SpicyLevel, item.Calories,
+        nullCode(item.SKU), nullCode(item.Barcode), nullCode(item.PLU), item.ItemID)
+    if err != nil {
+        return err
+    }
+    if err := checkAffected(result, "item", item.ItemID); err != nil {
+        return err
+    }
+    
+    // A new base price takes effect immediately; future changes are scheduled separately
+    if item.BasePrice != before.BasePrice {
+        if _, err := schedulePrice(tx, item.ItemID, item.BasePrice, time.Now(), actor); err != nil {
+            return err
+        }
+    }
+    
+    if err := writeAudit(tx, actor, AuditItem, item.ItemID, AuditUpdate, before, item); err != nil {
+        return err
+    }
+    
+    return tx.Commit()
 }
 
-func (s *ItemService) DeleteItem(itemID int) error {
+func (s *ItemService) DeleteItem(itemID int, actor *models.User) error {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+    
     // Check if item is used in any invoices
     var count int
     checkQuery := `SELECT COUNT(*) FROM InvoiceItems WHERE ItemID = ?`
-    err := s.db.QueryRow(checkQuery, itemID).Scan(&count)
+    err = tx.QueryRow(checkQuery, itemID).Scan(&count)
     if err != nil {
         return err
     }
     
     if count > 0 {
-        return fmt.Errorf("cannot delete item: they have %d invoice item", count)
+        return ConflictError("cannot delete item: it appears on %d invoice lines; archive it instead", count)
+    }
+    
+    if err := tx.QueryRow(`SELECT COUNT(*) FROM BundleChoices WHERE ItemID = ?`, itemID).Scan(&count); err != nil {
+        return err
+    }
+    if count > 0 {
+        return ConflictError("cannot delete item: it is a choice in %d bundle slots", count)
+    }
+    
+    before, err := loadItem(tx, itemID)
+    if err != nil {
+        return err
+    }
+    
+    if _, err := tx.Exec(`DELETE FROM ItemPrices WHERE ItemID = ?`, itemID); err != nil {
+        return err
+    }
+    if _, err := tx.Exec(`DELETE FROM RecipeLines WHERE ItemID = ?`, itemID); err != nil {
+        return err
+    }
+    if err := deleteBundle(tx, itemID); err != nil {
+        return err
     }
     
     query := `DELETE FROM Items WHERE ItemID = ?`
-    _, err = s.db.Exec(query, itemID)
-    return err
+    result, err := tx.Exec(query, itemID)
+    if err != nil {
+        return err
+    }
+    if err := checkAffected(result, "item", itemID); err != nil {
+        return err
+    }
+    
+    if err := writeAudit(tx, actor, AuditItem, itemID, AuditDelete, before, nil); err != nil {
+        return err
+    }
+    
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+    
+    // The item is gone, so its image files are no longer needed
+    if s.images != nil {
+        s.removeImages(imageKeys(before)...)
+    }
+    return nil
 }
 
-func (s *ItemService) GetAllCategories() ([]models.Category, error) {
-    query := `SELECT CategoryID, CategoryName, Description FROM Categories ORDER BY CategoryName`
-    
-    rows, err := s.db.Query(query)
+// loadItem reads one item, locking the row when q is a transaction so it can
+// be recorded as the before state of a change.
+func loadItem(q querier, itemID int) (*models.Item, error) {
+    var item models.Item
+    var soldOutUntil sql.NullTime
+    var details itemDetails
+    dest := []interface{}{&item.ItemID, &item.ItemName, &item.CategoryID, &item.BasePrice, &item.Description, &item.SortOrder,
+        &item.Availability, &soldOutUntil}
+    err := q.QueryRow(`
+        SELECT i.ItemID, i.ItemName, i.CategoryID, COALESCE(cp.Price, i.BasePrice), i.Description, i.SortOrder,
+               `+availabilityExpr+`, i.SoldOutUntil, `+itemDetailColumns+`
+        FROM Items i WITH (UPDLOCK)
+        `+currentPriceApply+`
+        WHERE i.ItemID = ?
+    `, itemID).Scan(append(dest, details.targets(&item)...)...)
+    if err == sql.ErrNoRows {
+        return nil, NotFoundError("item", itemID)
+    }
     if err != nil {
         return nil, err
     }
-    defer rows.Close()
-    
-    var categories []models.Category
-    for rows.Next() {
-        var category models.Category
-        err := rows.Scan(&category.CategoryID, &category.CategoryName, &category.Description)
-        if err != nil {
-            return nil, err
-        }
-        categories = append(categories, category)
+    if item.Availability == ItemSoldOut && soldOutUntil.Valid {
+        item.SoldOutUntil = &soldOutUntil.Time
     }
+    details.apply(&item)
     
-    return categories, nil
-}
\ No newline at end of file
+    return &item, nil
+}
+
+func (s *ItemService) GetAllCategories() ([]models.Category, error) {
+    categories := &CategoryService{db: s.db}
+    return categories.GetAllCategories(false)
+}
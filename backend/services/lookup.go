@@ -0,0 +1,28 @@
+package services
+
+import (
+    "fmt"
+    "backend/database"
+)
+
+var existsQueries = map[string]string{
+    "category":   `SELECT COUNT(*) FROM Categories WHERE CategoryID = ?`,
+    "customer":   `SELECT COUNT(*) FROM Customers WHERE CustomerID = ?`,
+    "ingredient": `SELECT COUNT(*) FROM Ingredients WHERE IngredientID = ?`,
+    "item":       `SELECT COUNT(*) FROM Items WHERE ItemID = ?`,
+    "supplier":   `SELECT COUNT(*) FROM Suppliers WHERE SupplierID = ?`,
+}
+
+// RecordExists reports whether a category, customer, ingredient, item or supplier with the given id exists.
+func RecordExists(entity string, id int) (bool, error) {
+    query, ok := existsQueries[entity]
+    if !ok {
+        return false, fmt.Errorf("unknown entity %q", entity)
+    }
+
+    var count int
+    if err := database.GetDB().QueryRow(query, id).Scan(&count); err != nil {
+        return false, err
+    }
+    return count > 0, nil
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+    "backend/models"
+)
+
+// Roles a user account can hold.
+const (
+    RoleCashier = "cashier"
+    RoleManager = "manager"
+    RoleAdmin   = "admin"
+)
+
+// Permission names an action that is granted to roles.
+type Permission string
+
+const (
+    PermViewMenu        Permission = "menu.view"
+    PermManageMenu      Permission = "menu.manage"
+    PermSetAvailability Permission = "menu.availability"
+    PermDeleteMenu      Permission = "menu.delete"
+    PermViewCustomers   Permission = "customers.view"
+    PermCreateCustomers Permission = "customers.create"
+    PermManageCustomers Permission = "customers.manage"
+    PermViewInvoices    Permission = "invoices.view"
+    PermCreateInvoices  Permission = "invoices.create"
+    PermVoidInvoices    Permission = "invoices.void"
+    PermVoidAnyAmount   Permission = "invoices.void_any_amount"
+    PermOverridePrice   Permission = "invoices.override_price"
+    PermLargeDiscount   Permission = "invoices.large_discount"
+    PermOpenDrawer      Permission = "till.open_drawer"
+    PermGrantApprovals  Permission = "approvals.grant"
+    PermImportData      Permission = "data.import"
+    PermExportData      Permission = "data.export"
+    PermViewReports     Permission = "reports.view"
+    PermViewInventory   Permission = "inventory.view"
+    PermManageInventory Permission = "inventory.manage"
+    PermRecordWastage   Permission = "inventory.wastage"
+    PermManageUsers     Permission = "users.manage"
+    PermManageSettings  Permission = "settings.manage"
+    PermViewAudit       Permission = "audit.view"
+)
+
+var cashierPermissions = []Permission{
+    PermViewMenu,
+    PermSetAvailability,
+    PermViewCustomers,
+    PermCreateCustomers,
+    PermViewInvoices,
+    PermCreateInvoices,
+    PermRecordWastage,
+}
+
+var managerPermissions = append([]Permission{
+    PermManageMenu,
+    PermDeleteMenu,
+    PermManageCustomers,
+    PermVoidInvoices,
+    PermOverridePrice,
+    PermLargeDiscount,
+    PermOpenDrawer,
+    PermGrantApprovals,
+    PermImportData,
+    PermExportData,
+    PermViewReports,
+    PermViewInventory,
+    PermManageInventory,
+}, cashierPermissions...)
+
+var rolePermissions = map[string]map[Permission]bool{
+    RoleCashier: permissionSet(cashierPermissions...),
+    RoleManager: permissionSet(managerPermissions...),
+    RoleAdmin: permissionSet(append([]Permission{
+        PermVoidAnyAmount,
+        PermManageUsers,
+        PermManageSettings,
+        PermViewAudit,
+    }, managerPermissions...)...),
+}
+
+func permissionSet(perms ...Permission) map[Permission]bool {
+    set := make(map[Permission]bool, len(perms))
+    for _, p := range perms {
+        set[p] = true
+    }
+    return set
+}
+
+// HasPermission reports whether the user's role grants the permission.
+func HasPermission(user *models.User, perm Permission) bool {
+    return user != nil && rolePermissions[user.Role][perm]
+}
+
+// RequirePermission returns a forbidden error unless the user's role grants the permission.
+func RequirePermission(user *models.User, perm Permission) error {
+    if !HasPermission(user, perm) {
+        return ForbiddenError(perm)
+    }
+    return nil
+}
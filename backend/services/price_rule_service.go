@@ -0,0 +1,324 @@
+package services
+
+import (
+    "database/sql"
+    "fmt"
+    "math"
+    "time"
+    "backend/models"
+    "backend/database"
+)
+
+type PriceRuleService struct {
+    db *sql.DB
+}
+
+func NewPriceRuleService() *PriceRuleService {
+    return &PriceRuleService{
+        db: database.GetDB(),
+    }
+}
+
+// priceRule is a rule in the form used for evaluation. Times are minutes
+// since midnight and days is a bit mask indexed by time.Weekday.
+type priceRule struct {
+    id              int
+    days            int
+    startMinute     int
+    endMinute       int
+    itemID          int
+    categoryID      int
+    discountPercent float64
+    fixedPrice      sql.NullFloat64
+}
+
+// activeAt reports whether the rule's window covers t. Windows that end
+// before they start run past midnight, and count towards the day they start.
+func (r *priceRule) activeAt(t time.Time) bool {
+    minute := t.Hour()*60 + t.Minute()
+    day := t.Weekday()
+    if r.startMinute <= r.endMinute {
+        return r.days&(1<<uint(day)) != 0 && minute >= r.startMinute && minute < r.endMinute
+    }
+    if minute >= r.startMinute {
+        return r.days&(1<<uint(day)) != 0
+    }
+    previous := (day + 6) % 7
+    return r.days&(1<<uint(previous)) != 0 && minute < r.endMinute
+}
+
+func (r *priceRule) apply(price float64) float64 {
+    if r.fixedPrice.Valid {
+        return r.fixedPrice.Float64
+    }
+    return math.Round(price*(100-r.discountPercent)) / 100
+}
+
+// priceRules holds the active rules used to price one request.
+type priceRules []priceRule
+
+// loadPriceRules reads every active rule.
+func loadPriceRules(q querier) (priceRules, error) {
+    rows, err := q.Query(`
+        SELECT PriceRuleID, DaysMask, StartMinute, EndMinute, ItemID, CategoryID, DiscountPercent, FixedPrice
+        FROM PriceRules WHERE IsActive = 1
+    `)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var rules priceRules
+    for rows.Next() {
+        var r priceRule
+        var itemID, categoryID sql.NullInt64
+        var discount sql.NullFloat64
+        err := rows.Scan(&r.id, &r.days, &r.startMinute, &r.endMinute, &itemID, &categoryID, &discount, &r.fixedPrice)
+        if err != nil {
+            return nil, err
+        }
+        r.itemID = int(itemID.Int64)
+        r.categoryID = int(categoryID.Int64)
+        r.discountPercent = discount.Float64
+        rules = append(rules, r)
+    }
+
+    return rules, rows.Err()
+}
+
+// priceAt applies the rules to an item's price at time t. Rules scoped to the
+// item take precedence over category rules; among rules of the same scope the
+// lowest resulting price wins. The id of the applied rule is returned, or nil.
+func (rules priceRules) priceAt(itemID, categoryID int, price float64, t time.Time) (float64, *int) {
+    var best *priceRule
+    bestPrice := price
+    for i := range rules {
+        r := &rules[i]
+        if r.itemID != itemID && (r.categoryID == 0 || r.categoryID != categoryID) {
+            continue
+        }
+        if !r.activeAt(t) {
+            continue
+        }
+
+        adjusted := r.apply(price)
+        switch {
+        case best == nil:
+        case r.itemID != 0 && best.itemID == 0:
+        case (r.itemID != 0) == (best.itemID != 0) && adjusted < bestPrice:
+        default:
+            continue
+        }
+        best, bestPrice = r, adjusted
+    }
+
+    if best == nil {
+        return price, nil
+    }
+    return bestPrice, &best.id
+}
+
+func (s *PriceRuleService) GetAllPriceRules() ([]models.PriceRule, error) {
+    rows, err := s.db.Query(`
+        SELECT PriceRuleID, Name, DaysMask, StartMinute, EndMinute, ItemID, CategoryID,
+               DiscountPercent, FixedPrice, IsActive
+        FROM PriceRules ORDER BY Name
+    `)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    rules := []models.PriceRule{}
+    for rows.Next() {
+        rule, err := scanPriceRule(rows)
+        if err != nil {
+            return nil, err
+        }
+        rules = append(rules, *rule)
+    }
+
+    return rules, rows.Err()
+}
+
+func (s *PriceRuleService) CreatePriceRule(rule *models.PriceRule, actor *models.User) error {
+    mask, start, end, err := validatePriceRule(rule)
+    if err != nil {
+        return err
+    }
+
+    tx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    err = tx.QueryRow(`
+        INSERT INTO PriceRules (Name, DaysMask, StartMinute, EndMinute, ItemID, CategoryID, DiscountPercent, FixedPrice, IsActive)
+        OUTPUT INSERTED.PriceRuleID
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `, rule.Name, mask, start, end, rule.ItemID, rule.CategoryID, rule.DiscountPercent, rule.FixedPrice, *rule.IsActive).Scan(&rule.PriceRuleID)
+    if err != nil {
+        return err
+    }
+
+    if err := writeAudit(tx, actor, AuditPriceRule, rule.PriceRuleID, AuditCreate, nil, rule); err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+func (s *PriceRuleService) UpdatePriceRule(rule *models.PriceRule, actor *models.User) error {
+    mask, start, end, err := validatePriceRule(rule)
+    if err != nil {
+        return err
+    }
+
+    tx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    before, err := loadPriceRule(tx, rule.PriceRuleID)
+    if err != nil {
+        return err
+    }
+
+    _, err = tx.Exec(`
+        UPDATE PriceRules
+        SET Name = ?, DaysMask = ?, StartMinute = ?, EndMinute = ?, ItemID = ?, CategoryID = ?,
+            DiscountPercent = ?, FixedPrice = ?, IsActive = ?
+        WHERE PriceRuleID = ?
+    `, rule.Name, mask, start, end, rule.ItemID, rule.CategoryID, rule.DiscountPercent, rule.FixedPrice, *rule.IsActive, rule.PriceRuleID)
+    if err != nil {
+        return err
+    }
+
+    if err := writeAudit(tx, actor, AuditPriceRule, rule.PriceRuleID, AuditUpdate, before, rule); err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+func (s *PriceRuleService) DeletePriceRule(ruleID int, actor *models.User) error {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    before, err := loadPriceRule(tx, ruleID)
+    if err != nil {
+        return err
+    }
+
+    // Invoice lines keep their reference, so used rules are deactivated instead
+    var used int
+    if err := tx.QueryRow(`SELECT COUNT(*) FROM InvoiceItems WHERE PriceRuleID = ?`, ruleID).Scan(&used); err != nil {
+        return err
+    }
+    if used > 0 {
+        return ConflictError("cannot delete price rule: it was applied to %d invoice lines; deactivate it instead", used)
+    }
+
+    if _, err := tx.Exec(`DELETE FROM PriceRules WHERE PriceRuleID = ?`, ruleID); err != nil {
+        return err
+    }
+
+    if err := writeAudit(tx, actor, AuditPriceRule, ruleID, AuditDelete, before, nil); err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+// validatePriceRule checks the rules that binding tags cannot express and
+// returns the stored form of the days and times. IsActive defaults to true.
+func validatePriceRule(rule *models.PriceRule) (mask, start, end int, err error) {
+    if (rule.ItemID == nil) == (rule.CategoryID == nil) {
+        return 0, 0, 0, FieldError("item_id", "set either item_id or category_id")
+    }
+    if (rule.DiscountPercent == nil) == (rule.FixedPrice == nil) {
+        return 0, 0, 0, FieldError("discount_percent", "set either discount_percent or fixed_price")
+    }
+    if rule.StartTime == rule.EndTime {
+        return 0, 0, 0, FieldError("end_time", "must differ from start_time")
+    }
+    if rule.IsActive == nil {
+        active := true
+        rule.IsActive = &active
+    }
+
+    for _, day := range rule.Days {
+        mask |= 1 << uint(day)
+    }
+    return mask, parseMinute(rule.StartTime), parseMinute(rule.EndTime), nil
+}
+
+// parseMinute converts an HH:MM time that has already been validated.
+func parseMinute(hhmm string) int {
+    t, _ := time.Parse("15:04", hhmm)
+    return t.Hour()*60 + t.Minute()
+}
+
+func loadPriceRule(q querier, ruleID int) (*models.PriceRule, error) {
+    rows, err := q.Query(`
+        SELECT PriceRuleID, Name, DaysMask, StartMinute, EndMinute, ItemID, CategoryID,
+               DiscountPercent, FixedPrice, IsActive
+        FROM PriceRules WITH (UPDLOCK) WHERE PriceRuleID = ?
+    `, ruleID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    if !rows.Next() {
+        if err := rows.Err(); err != nil {
+            return nil, err
+        }
+        return nil, NotFoundError("price rule", ruleID)
+    }
+    return scanPriceRule(rows)
+}
+
+func scanPriceRule(rows *sql.Rows) (*models.PriceRule, error) {
+    var rule models.PriceRule
+    var mask, start, end int
+    var itemID, categoryID sql.NullInt64
+    var discount, fixed sql.NullFloat64
+    var active bool
+    err := rows.Scan(&rule.PriceRuleID, &rule.Name, &mask, &start, &end, &itemID, &categoryID,
+        &discount, &fixed, &active)
+    if err != nil {
+        return nil, err
+    }
+
+    rule.Days = []int{}
+    for day := 0; day < 7; day++ {
+        if mask&(1<<uint(day)) != 0 {
+            rule.Days = append(rule.Days, day)
+        }
+    }
+    rule.StartTime = fmt.Sprintf("%02d:%02d", start/60, start%60)
+    rule.EndTime = fmt.Sprintf("%02d:%02d", end/60, end%60)
+    if itemID.Valid {
+        id := int(itemID.Int64)
+        rule.ItemID = &id
+    }
+    if categoryID.Valid {
+        id := int(categoryID.Int64)
+        rule.CategoryID = &id
+    }
+    if discount.Valid {
+        rule.DiscountPercent = &discount.Float64
+    }
+    if fixed.Valid {
+        rule.FixedPrice = &fixed.Float64
+    }
+    rule.IsActive = &active
+
+    return &rule, nil
+}
@@ -0,0 +1,465 @@
+package services
+
+import (
+    "database/sql"
+    "fmt"
+    "slices"
+    "sort"
+    "backend/models"
+    "backend/database"
+)
+
+// Purchase order statuses. Orders move from draft to sent, then to
+// partially_received and received as goods arrive. Unfinished orders can be
+// cancelled.
+const (
+    PurchaseOrderDraft             = "draft"
+    PurchaseOrderSent              = "sent"
+    PurchaseOrderPartiallyReceived = "partially_received"
+    PurchaseOrderReceived          = "received"
+    PurchaseOrderCancelled         = "cancelled"
+)
+
+var purchaseOrderSortColumns = map[string]string{
+    "created_at":        "o.CreatedAt",
+    "supplier_name":     "s.Name",
+    "status":            "o.Status",
+    "total":             "Total",
+    "purchase_order_id": "o.PurchaseOrderID",
+}
+
+type PurchaseOrderService struct {
+    db *sql.DB
+}
+
+func NewPurchaseOrderService() *PurchaseOrderService {
+    return &PurchaseOrderService{
+        db: database.GetDB(),
+    }
+}
+
+func purchaseOrderNumber(id int) string {
+    return fmt.Sprintf("PO-%06d", id)
+}
+
+// ListPurchaseOrders returns one page of orders without their lines, newest
+// first unless another sort is requested, and the total number of matches.
+func (s *PurchaseOrderService) ListPurchaseOrders(filter models.PurchaseOrderFilter) ([]models.PurchaseOrder, int, error) {
+    q := &listQuery{}
+    q.search(filter.Search, "s.Name", "o.Notes")
+    if filter.Status != "" {
+        q.where("o.Status = ?", filter.Status)
+    }
+    if filter.SupplierID > 0 {
+        q.where("o.SupplierID = ?", filter.SupplierID)
+    }
+
+    var total int
+    err := s.db.QueryRow(`
+        SELECT COUNT(*)
+        FROM PurchaseOrders o
+        JOIN Suppliers s ON o.SupplierID = s.SupplierID
+        `+q.clause(), q.args...).Scan(&total)
+    if err != nil {
+        return nil, 0, err
+    }
+
+    order, err := orderAndPage(filter.ListParams, purchaseOrderSortColumns, "o.PurchaseOrderID DESC", "o.PurchaseOrderID DESC")
+    if err != nil {
+        return nil, 0, err
+    }
+
+    rows, err := s.db.Query(`
+        SELECT o.PurchaseOrderID, o.SupplierID, s.Name, o.Status, o.Notes,
+               COALESCE((SELECT SUM(l.Quantity * l.UnitCost) FROM PurchaseOrderLines l
+                         WHERE l.PurchaseOrderID = o.PurchaseOrderID), 0) AS Total,
+               o.CreatedBy, o.CreatedAt, o.SentAt, o.ReceivedAt
+        FROM PurchaseOrders o
+        JOIN Suppliers s ON o.SupplierID = s.SupplierID
+        `+q.clause()+`
+        `+order, q.args...)
+    if err != nil {
+        return nil, 0, err
+    }
+    defer rows.Close()
+
+    orders := []models.PurchaseOrder{}
+    for rows.Next() {
+        po, err := scanPurchaseOrder(rows)
+        if err != nil {
+            return nil, 0, err
+        }
+        orders = append(orders, *po)
+    }
+
+    return orders, total, rows.Err()
+}
+
+func (s *PurchaseOrderService) GetPurchaseOrder(orderID int) (*models.PurchaseOrder, error) {
+    return loadPurchaseOrder(s.db, orderID)
+}
+
+// CreatePurchaseOrder stores a draft order.
+func (s *PurchaseOrderService) CreatePurchaseOrder(po *models.PurchaseOrder, actor *models.User) (*models.PurchaseOrder, error) {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    var createdBy interface{}
+    if actor != nil {
+        createdBy = actor.UserID
+    }
+
+    var orderID int
+    err = tx.QueryRow(`
+        INSERT INTO PurchaseOrders (SupplierID, Status, Notes, CreatedBy)
+        OUTPUT INSERTED.PurchaseOrderID
+        VALUES (?, ?, ?, ?)
+    `, po.SupplierID, PurchaseOrderDraft, po.Notes, createdBy).Scan(&orderID)
+    if err != nil {
+        return nil, err
+    }
+    if err := insertPurchaseOrderLines(tx, orderID, po.Lines); err != nil {
+        return nil, err
+    }
+
+    after, err := loadPurchaseOrder(tx, orderID)
+    if err != nil {
+        return nil, err
+    }
+    if err := writeAudit(tx, actor, AuditPurchaseOrder, orderID, AuditCreate, nil, after); err != nil {
+        return nil, err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+
+    return after, nil
+}
+
+// UpdatePurchaseOrder replaces the supplier, notes and lines of a draft order.
+func (s *PurchaseOrderService) UpdatePurchaseOrder(po *models.PurchaseOrder, actor *models.User) (*models.PurchaseOrder, error) {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    before, err := loadPurchaseOrder(tx, po.PurchaseOrderID)
+    if err != nil {
+        return nil, err
+    }
+    if before.Status != PurchaseOrderDraft {
+        return nil, ConflictError("purchase order %s is %s; only drafts can be edited", before.OrderNumber, before.Status)
+    }
+
+    _, err = tx.Exec(`UPDATE PurchaseOrders SET SupplierID = ?, Notes = ? WHERE PurchaseOrderID = ?`,
+        po.SupplierID, po.Notes, po.PurchaseOrderID)
+    if err != nil {
+        return nil, err
+    }
+    if _, err := tx.Exec(`DELETE FROM PurchaseOrderLines WHERE PurchaseOrderID = ?`, po.PurchaseOrderID); err != nil {
+        return nil, err
+    }
+    if err := insertPurchaseOrderLines(tx, po.PurchaseOrderID, po.Lines); err != nil {
+        return nil, err
+    }
+
+    after, err := loadPurchaseOrder(tx, po.PurchaseOrderID)
+    if err != nil {
+        return nil, err
+    }
+    if err := writeAudit(tx, actor, AuditPurchaseOrder, po.PurchaseOrderID, AuditUpdate, before, after); err != nil {
+        return nil, err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+
+    return after, nil
+}
+
+// DeletePurchaseOrder removes a draft order. Orders that have been sent are
+// cancelled instead so the supplier's copy can still be matched.
+func (s *PurchaseOrderService) DeletePurchaseOrder(orderID int, actor *models.User) error {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    before, err := loadPurchaseOrder(tx, orderID)
+    if err != nil {
+        return err
+    }
+    if before.Status != PurchaseOrderDraft {
+        return ConflictError("purchase order %s is %s; cancel it instead", before.OrderNumber, before.Status)
+    }
+
+    if _, err := tx.Exec(`DELETE FROM PurchaseOrderLines WHERE PurchaseOrderID = ?`, orderID); err != nil {
+        return err
+    }
+    if _, err := tx.Exec(`DELETE FROM PurchaseOrders WHERE PurchaseOrderID = ?`, orderID); err != nil {
+        return err
+    }
+
+    if err := writeAudit(tx, actor, AuditPurchaseOrder, orderID, AuditDelete, before, nil); err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+// SendPurchaseOrder marks a draft as sent to the supplier, after which its
+// lines can no longer change.
+func (s *PurchaseOrderService) SendPurchaseOrder(orderID int, actor *models.User) (*models.PurchaseOrder, error) {
+    return s.transition(orderID, AuditSend, actor, []string{PurchaseOrderDraft},
+        `UPDATE PurchaseOrders SET Status = ?, SentAt = GETDATE() WHERE PurchaseOrderID = ?`, PurchaseOrderSent)
+}
+
+// CancelPurchaseOrder closes an order that will not be (fully) delivered.
+// Goods already received stay in stock.
+func (s *PurchaseOrderService) CancelPurchaseOrder(orderID int, actor *models.User) (*models.PurchaseOrder, error) {
+    return s.transition(orderID, AuditCancel, actor,
+        []string{PurchaseOrderDraft, PurchaseOrderSent, PurchaseOrderPartiallyReceived},
+        `UPDATE PurchaseOrders SET Status = ? WHERE PurchaseOrderID = ?`, PurchaseOrderCancelled)
+}
+
+// transition moves an order in one of the from statuses to a new status with
+// the given update, which takes the status and the order id.
+func (s *PurchaseOrderService) transition(orderID int, action string, actor *models.User, from []string, update, status string) (*models.PurchaseOrder, error) {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    before, err := loadPurchaseOrder(tx, orderID)
+    if err != nil {
+        return nil, err
+    }
+    if !slices.Contains(from, before.Status) {
+        return nil, ConflictError("purchase order %s is %s and cannot be marked %s", before.OrderNumber, before.Status, status)
+    }
+
+    if _, err := tx.Exec(update, status, orderID); err != nil {
+        return nil, err
+    }
+
+    after, err := loadPurchaseOrder(tx, orderID)
+    if err != nil {
+        return nil, err
+    }
+    if err := writeAudit(tx, actor, AuditPurchaseOrder, orderID, action, before, after); err != nil {
+        return nil, err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+
+    return after, nil
+}
+
+// ReceivePurchaseOrder books delivered goods into stock at their unit cost,
+// which also becomes the ingredient's current cost. The order is received once
+// every line has been delivered in full.
+func (s *PurchaseOrderService) ReceivePurchaseOrder(orderID int, req *models.ReceivePurchaseOrderRequest, actor *models.User) (*models.PurchaseOrder, error) {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    before, err := loadPurchaseOrder(tx, orderID)
+    if err != nil {
+        return nil, err
+    }
+    if before.Status != PurchaseOrderSent && before.Status != PurchaseOrderPartiallyReceived {
+        return nil, ConflictError("purchase order %s is %s; only sent orders can be received", before.OrderNumber, before.Status)
+    }
+
+    lines := make(map[int]models.PurchaseOrderLine, len(before.Lines))
+    for _, line := range before.Lines {
+        lines[line.LineID] = line
+    }
+
+    type receipt struct {
+        line     models.PurchaseOrderLine
+        quantity float64
+        unitCost float64
+    }
+    receipts := make([]receipt, len(req.Lines))
+    for i, r := range req.Lines {
+        line, ok := lines[r.LineID]
+        if !ok {
+            return nil, FieldError(fmt.Sprintf("lines[%d].line_id", i), fmt.Sprintf("line %d is not on purchase order %s", r.LineID, before.OrderNumber))
+        }
+        receipts[i] = receipt{line: line, quantity: r.Quantity, unitCost: line.UnitCost}
+        if r.UnitCost != nil {
+            receipts[i].unitCost = *r.UnitCost
+        }
+    }
+
+    // Update ingredients in id order so concurrent stock changes lock rows in the same order
+    sort.Slice(receipts, func(i, j int) bool {
+        return receipts[i].line.IngredientID < receipts[j].line.IngredientID
+    })
+
+    ingredientIDs := make([]int, len(receipts))
+    for i, r := range receipts {
+        ingredientIDs[i] = r.line.IngredientID
+
+        _, err := tx.Exec(`UPDATE PurchaseOrderLines SET ReceivedQuantity = ReceivedQuantity + ? WHERE LineID = ?`,
+            r.quantity, r.line.LineID)
+        if err != nil {
+            return nil, err
+        }
+
+        unitCost := r.unitCost
+        err = recordMovement(tx, movement{
+            ingredientID:    r.line.IngredientID,
+            quantity:        r.quantity,
+            reason:          MovementReceipt,
+            purchaseOrderID: &orderID,
+            unitCost:        &unitCost,
+            note:            req.Note,
+        }, actor)
+        if err != nil {
+            return nil, err
+        }
+        if _, err := tx.Exec(`UPDATE Ingredients SET UnitCost = ? WHERE IngredientID = ?`, unitCost, r.line.IngredientID); err != nil {
+            return nil, err
+        }
+    }
+
+    var outstanding int
+    err = tx.QueryRow(`
+        SELECT COUNT(*) FROM PurchaseOrderLines WHERE PurchaseOrderID = ? AND ReceivedQuantity < Quantity
+    `, orderID).Scan(&outstanding)
+    if err != nil {
+        return nil, err
+    }
+    if outstanding == 0 {
+        _, err = tx.Exec(`UPDATE PurchaseOrders SET Status = ?, ReceivedAt = GETDATE() WHERE PurchaseOrderID = ?`,
+            PurchaseOrderReceived, orderID)
+    } else {
+        _, err = tx.Exec(`UPDATE PurchaseOrders SET Status = ? WHERE PurchaseOrderID = ?`,
+            PurchaseOrderPartiallyReceived, orderID)
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    if err := syncIngredientAvailability(tx, ingredientIDs); err != nil {
+        return nil, err
+    }
+
+    after, err := loadPurchaseOrder(tx, orderID)
+    if err != nil {
+        return nil, err
+    }
+    if err := writeAudit(tx, actor, AuditPurchaseOrder, orderID, AuditReceive, before, after); err != nil {
+        return nil, err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+
+    return after, nil
+}
+
+func insertPurchaseOrderLines(tx *sql.Tx, orderID int, lines []models.PurchaseOrderLine) error {
+    for _, line := range lines {
+        _, err := tx.Exec(`
+            INSERT INTO PurchaseOrderLines (PurchaseOrderID, IngredientID, Quantity, UnitCost)
+            VALUES (?, ?, ?, ?)
+        `, orderID, line.IngredientID, line.Quantity, line.UnitCost)
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func loadPurchaseOrder(q querier, orderID int) (*models.PurchaseOrder, error) {
+    rows, err := q.Query(`
+        SELECT o.PurchaseOrderID, o.SupplierID, s.Name, o.Status, o.Notes, 0,
+               o.CreatedBy, o.CreatedAt, o.SentAt, o.ReceivedAt
+        FROM PurchaseOrders o WITH (UPDLOCK)
+        JOIN Suppliers s ON o.SupplierID = s.SupplierID
+        WHERE o.PurchaseOrderID = ?
+    `, orderID)
+    if err != nil {
+        return nil, err
+    }
+
+    if !rows.Next() {
+        rows.Close()
+        if err := rows.Err(); err != nil {
+            return nil, err
+        }
+        return nil, NotFoundError("purchase order", orderID)
+    }
+    po, err := scanPurchaseOrder(rows)
+    rows.Close()
+    if err != nil {
+        return nil, err
+    }
+
+    lineRows, err := q.Query(`
+        SELECT l.LineID, l.IngredientID, g.Name, g.Unit, l.Quantity, l.UnitCost, l.ReceivedQuantity
+        FROM PurchaseOrderLines l
+        JOIN Ingredients g ON l.IngredientID = g.IngredientID
+        WHERE l.PurchaseOrderID = ?
+        ORDER BY l.LineID
+    `, orderID)
+    if err != nil {
+        return nil, err
+    }
+    defer lineRows.Close()
+
+    po.Lines = []models.PurchaseOrderLine{}
+    for lineRows.Next() {
+        var line models.PurchaseOrderLine
+        err := lineRows.Scan(&line.LineID, &line.IngredientID, &line.IngredientName, &line.Unit,
+            &line.Quantity, &line.UnitCost, &line.ReceivedQuantity)
+        if err != nil {
+            return nil, err
+        }
+        po.Lines = append(po.Lines, line)
+        po.Total += line.Quantity * line.UnitCost
+    }
+
+    return po, lineRows.Err()
+}
+
+func scanPurchaseOrder(rows *sql.Rows) (*models.PurchaseOrder, error) {
+    var po models.PurchaseOrder
+    var createdBy sql.NullInt64
+    var sentAt, receivedAt sql.NullTime
+    err := rows.Scan(&po.PurchaseOrderID, &po.SupplierID, &po.SupplierName, &po.Status, &po.Notes, &po.Total,
+        &createdBy, &po.CreatedAt, &sentAt, &receivedAt)
+    if err != nil {
+        return nil, err
+    }
+
+    po.OrderNumber = purchaseOrderNumber(po.PurchaseOrderID)
+    if createdBy.Valid {
+        id := int(createdBy.Int64)
+        po.CreatedBy = &id
+    }
+    if sentAt.Valid {
+        po.SentAt = &sentAt.Time
+    }
+    if receivedAt.Valid {
+        po.ReceivedAt = &receivedAt.Time
+    }
+
+    return &po, nil
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+    "database/sql"
+    "fmt"
+    "strings"
+    "backend/models"
+)
+
+// listQuery collects the WHERE conditions and arguments of a filtered list query.
+type listQuery struct {
+    conditions []string
+    args       []interface{}
+}
+
+func (q *listQuery) where(condition string, args ...interface{}) {
+    q.conditions = append(q.conditions, condition)
+    q.args = append(q.args, args...)
+}
+
+// search matches the term against any of the given columns.
+func (q *listQuery) search(term string, columns ...string) {
+    if term == "" {
+        return
+    }
+
+    parts := make([]string, len(columns))
+    pattern := "%" + escapeLike(term) + "%"
+    for i, column := range columns {
+        parts[i] = column + ` LIKE ? ESCAPE '\'`
+        q.args = append(q.args, pattern)
+    }
+    q.conditions = append(q.conditions, "("+strings.Join(parts, " OR ")+")")
+}
+
+func (q *listQuery) clause() string {
+    if len(q.conditions) == 0 {
+        return ""
+    }
+    return "WHERE " + strings.Join(q.conditions, " AND ")
+}
+
+// orderAndPage builds the ORDER BY and OFFSET/FETCH clauses. Only sort keys in
+// sortable are accepted, and tieBreak keeps the order stable between pages. The
+// tie-break is left out when it is the sort column itself, since SQL Server
+// rejects a column listed twice in ORDER BY.
+func orderAndPage(params models.ListParams, sortable map[string]string, defaultSort, tieBreak string) (string, error) {
+    order := defaultSort
+    if params.Sort != "" {
+        column, ok := sortable[params.Sort]
+        if !ok {
+            return "", FieldError("sort", fmt.Sprintf("cannot sort by %q", params.Sort))
+        }
+        order = column
+        if params.Desc {
+            order += " DESC"
+        }
+        if column != strings.TrimSuffix(tieBreak, " DESC") {
+            order += ", " + tieBreak
+        }
+    }
+
+    clause := "ORDER BY " + order
+    if params.Limit > 0 {
+        clause += fmt.Sprintf(" OFFSET %d ROWS FETCH NEXT %d ROWS ONLY", params.Offset, params.Limit)
+    }
+    return clause, nil
+}
+
+func escapeLike(term string) string {
+    replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`, `[`, `\[`)
+    return replacer.Replace(term)
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx so helpers can run inside
+// or outside a transaction.
+type querier interface {
+    QueryRow(query string, args ...interface{}) *sql.Row
+    Query(query string, args ...interface{}) (*sql.Rows, error)
+    Exec(query string, args ...interface{}) (sql.Result, error)
+}
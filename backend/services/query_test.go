@@ -0,0 +1,72 @@
+package services
+
+import (
+    "testing"
+    "backend/models"
+)
+
+func TestOrderAndPage(t *testing.T) {
+    sortable := map[string]string{
+        "item_name": "i.ItemName",
+        "item_id":   "i.ItemID",
+    }
+
+    tests := []struct {
+        name     string
+        params   models.ListParams
+        tieBreak string
+        want     string
+    }{
+        {
+            name:     "default sort",
+            params:   models.ListParams{},
+            tieBreak: "i.ItemID",
+            want:     "ORDER BY i.ItemName, i.ItemID",
+        },
+        {
+            name:     "sort with tie-break",
+            params:   models.ListParams{Sort: "item_name", Desc: true},
+            tieBreak: "i.ItemID",
+            want:     "ORDER BY i.ItemName DESC, i.ItemID",
+        },
+        {
+            name:     "sort on the tie-break column",
+            params:   models.ListParams{Sort: "item_id"},
+            tieBreak: "i.ItemID",
+            want:     "ORDER BY i.ItemID",
+        },
+        {
+            name:     "descending sort on a descending tie-break column",
+            params:   models.ListParams{Sort: "item_id", Desc: true},
+            tieBreak: "i.ItemID DESC",
+            want:     "ORDER BY i.ItemID DESC",
+        },
+        {
+            name:     "page",
+            params:   models.ListParams{Sort: "item_name", Limit: 20, Offset: 40},
+            tieBreak: "i.ItemID",
+            want:     "ORDER BY i.ItemName, i.ItemID OFFSET 40 ROWS FETCH NEXT 20 ROWS ONLY",
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := orderAndPage(tt.params, sortable, "i.ItemName, i.ItemID", tt.tieBreak)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if got != tt.want {
+                t.Errorf("got %q, want %q", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestOrderAndPageRejectsUnknownSort(t *testing.T) {
+    // Sort keys are whitelisted because the column is written into the query
+    _, err := orderAndPage(models.ListParams{Sort: "ItemName; DROP TABLE Items"}, map[string]string{"item_name": "i.ItemName"}, "i.ItemName", "i.ItemID")
+    appErr, ok := err.(*AppError)
+    if !ok || appErr.Code != CodeValidationFailed || appErr.Fields["sort"] == "" {
+        t.Fatalf("got %v, want a validation error on sort", err)
+    }
+}
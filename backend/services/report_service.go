@@ -0,0 +1,246 @@
+package services
+
+import (
+    "database/sql"
+    "fmt"
+    "sort"
+    "backend/models"
+    "backend/database"
+    "time"
+)
+
+type ReportService struct {
+    db *sql.DB
+}
+
+func NewReportService() *ReportService {
+    return &ReportService{
+        db: database.GetDB(),
+    }
+}
+
+// GetTaxReport aggregates taxable sales, exempt sales and tax collected per tax
+// rate for every month or quarter between from and to (to is exclusive).
+// Void invoices are excluded.
+func (s *ReportService) GetTaxReport(from, to time.Time, groupBy string) (*models.TaxReport, error) {
+    var periodExpr string
+    switch groupBy {
+    case "month":
+        periodExpr = "MONTH(InvoiceDate)"
+    case "quarter":
+        periodExpr = "DATEPART(QUARTER, InvoiceDate)"
+    default:
+        return nil, FieldError("group_by", "must be month or quarter")
+    }
+
+    query := fmt.Sprintf(`
+        SELECT YEAR(InvoiceDate) AS PeriodYear, %s AS PeriodNum, TaxRate,
+               COUNT(*),
+               SUM(CASE WHEN TaxRate > 0 THEN SubTotal ELSE 0 END),
+               SUM(CASE WHEN TaxRate = 0 THEN SubTotal ELSE 0 END),
+               SUM(TaxAmount)
+        FROM Invoices
+        WHERE InvoiceDate >= ? AND InvoiceDate < ? AND Status <> ?
+        GROUP BY YEAR(InvoiceDate), %s, TaxRate
+        ORDER BY PeriodYear, PeriodNum, TaxRate
+    `, periodExpr, periodExpr)
+
+    // Void invoices were never a sale, so they are left out of the tax return
+    rows, err := s.db.Query(query, from, to, InvoiceStatusVoid)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    report := &models.TaxReport{
+        From:    from,
+        To:      to,
+        GroupBy: groupBy,
+        Periods: []models.TaxReportPeriod{},
+    }
+
+    for rows.Next() {
+        var year, num int
+        var line models.TaxReportLine
+
+        err := rows.Scan(&year, &num, &line.TaxRate, &line.InvoiceCount,
+            &line.TaxableSales, &line.ExemptSales, &line.TaxCollected)
+        if err != nil {
+            return nil, err
+        }
+
+        if groupBy == "quarter" {
+            line.Period = fmt.Sprintf("%d-Q%d", year, num)
+        } else {
+            line.Period = fmt.Sprintf("%d-%02d", year, num)
+        }
+
+        // Rows arrive ordered by period, so a new period starts whenever the label changes
+        if len(report.Periods) == 0 || report.Periods[len(report.Periods)-1].Period != line.Period {
+            report.Periods = append(report.Periods, models.TaxReportPeriod{Period: line.Period})
+        }
+        period := &report.Periods[len(report.Periods)-1]
+        period.Components = append(period.Components, line)
+        period.InvoiceCount += line.InvoiceCount
+        period.TaxableSales += line.TaxableSales
+        period.ExemptSales += line.ExemptSales
+        period.TaxCollected += line.TaxCollected
+
+        report.InvoiceCount += line.InvoiceCount
+        report.TaxableSales += line.TaxableSales
+        report.ExemptSales += line.ExemptSales
+        report.TaxCollected += line.TaxCollected
+    }
+
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    return report, nil
+}
+
+// GetStockVarianceReport totals wastage and stock take variances per
+// ingredient between from and to (to is exclusive), valued at the unit cost
+// recorded on each movement. Ingredients are listed biggest loss first.
+func (s *ReportService) GetStockVarianceReport(from, to time.Time) (*models.StockVarianceReport, error) {
+    rows, err := s.db.Query(`
+        SELECT g.IngredientID, g.Name, g.Unit,
+               SUM(CASE WHEN m.Reason = ? THEN m.Quantity ELSE 0 END),
+               SUM(CASE WHEN m.Reason = ? THEN m.Quantity * COALESCE(m.UnitCost, 0) ELSE 0 END),
+               SUM(CASE WHEN m.Reason = ? THEN m.Quantity ELSE 0 END),
+               SUM(CASE WHEN m.Reason = ? THEN m.Quantity * COALESCE(m.UnitCost, 0) ELSE 0 END)
+        FROM StockMovements m
+        JOIN Ingredients g ON m.IngredientID = g.IngredientID
+        WHERE m.Reason IN (?, ?) AND m.OccurredAt >= ? AND m.OccurredAt < ?
+        GROUP BY g.IngredientID, g.Name, g.Unit
+    `, MovementWastage, MovementWastage, MovementStockTake, MovementStockTake,
+        MovementWastage, MovementStockTake, from, to)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    report := &models.StockVarianceReport{
+        From:  from,
+        To:    to,
+        Lines: []models.StockVarianceLine{},
+    }
+
+    for rows.Next() {
+        var line models.StockVarianceLine
+        err := rows.Scan(&line.IngredientID, &line.IngredientName, &line.Unit,
+            &line.WastageQuantity, &line.WastageValue, &line.StockTakeQuantity, &line.StockTakeValue)
+        if err != nil {
+            return nil, err
+        }
+
+        line.WastageValue = roundMoney(line.WastageValue)
+        line.StockTakeValue = roundMoney(line.StockTakeValue)
+        line.TotalValue = roundMoney(line.WastageValue + line.StockTakeValue)
+        report.WastageValue += line.WastageValue
+        report.StockTakeValue += line.StockTakeValue
+        report.Lines = append(report.Lines, line)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    sort.Slice(report.Lines, func(i, j int) bool {
+        return report.Lines[i].TotalValue < report.Lines[j].TotalValue
+    })
+    report.WastageValue = roundMoney(report.WastageValue)
+    report.StockTakeValue = roundMoney(report.StockTakeValue)
+    report.TotalValue = roundMoney(report.WastageValue + report.StockTakeValue)
+
+    return report, nil
+}
+
+// GetMarginReport totals revenue, cost of goods and margin per item or
+// category between from and to (to is exclusive), lowest margin first so
+// the items that most need re-pricing lead the list. Void invoices are
+// excluded. Bundles are reported as sold, with their components' cost, so
+// items chosen inside a bundle do not count as sales of their own. Names and
+// categories are those recorded on the lines, so sales stay under the name
+// they were made under.
+func (s *ReportService) GetMarginReport(from, to time.Time, groupBy string) (*models.MarginReport, error) {
+    var groupExpr string
+    switch groupBy {
+    case "item":
+        groupExpr = "ii.ItemID, ii.ItemName"
+    case "category":
+        groupExpr = "ii.CategoryID, ii.CategoryName"
+    default:
+        return nil, FieldError("group_by", "must be item or category")
+    }
+
+    query := fmt.Sprintf(`
+        SELECT %s,
+               SUM(ii.Quantity),
+               SUM(ii.TotalPrice),
+               SUM(CASE WHEN u.UnitCost IS NOT NULL THEN ii.TotalPrice ELSE 0 END),
+               SUM(COALESCE(ii.Quantity * u.UnitCost, 0)),
+               SUM(CASE WHEN u.UnitCost IS NULL THEN ii.Quantity ELSE 0 END)
+        FROM InvoiceItems ii
+        JOIN Invoices v ON ii.InvoiceID = v.InvoiceID
+        JOIN Items i ON ii.ItemID = i.ItemID
+        %s
+        CROSS APPLY (SELECT COALESCE(ii.UnitCost, fc.FoodCost) AS UnitCost) u
+        WHERE v.InvoiceDate >= ? AND v.InvoiceDate < ? AND v.Status <> ?
+          AND ii.ParentInvoiceItemID IS NULL
+        GROUP BY %s
+    `, groupExpr, foodCostApply, groupExpr)
+
+    rows, err := s.db.Query(query, from, to, InvoiceStatusVoid)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    report := &models.MarginReport{
+        From:    from,
+        To:      to,
+        GroupBy: groupBy,
+        Lines:   []models.MarginLine{},
+    }
+
+    var costedRevenue float64
+    for rows.Next() {
+        var line models.MarginLine
+        var lineCostedRevenue float64
+        err := rows.Scan(&line.ID, &line.Name, &line.QuantitySold, &line.Revenue,
+            &lineCostedRevenue, &line.CostOfGoods, &line.UncostedQuantity)
+        if err != nil {
+            return nil, err
+        }
+
+        line.Revenue = roundMoney(line.Revenue)
+        line.CostOfGoods = roundMoney(line.CostOfGoods)
+        line.Margin = roundMoney(lineCostedRevenue - line.CostOfGoods)
+        line.MarginPercent = marginPercent(lineCostedRevenue, line.CostOfGoods)
+        report.Revenue += line.Revenue
+        report.CostOfGoods += line.CostOfGoods
+        costedRevenue += lineCostedRevenue
+        report.Lines = append(report.Lines, line)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    // Lines with no known cost have no margin to compare and go last
+    sort.SliceStable(report.Lines, func(i, j int) bool {
+        a, b := report.Lines[i].MarginPercent, report.Lines[j].MarginPercent
+        if a == nil || b == nil {
+            return a != nil && b == nil
+        }
+        if *a != *b {
+            return *a < *b
+        }
+        return report.Lines[i].Name < report.Lines[j].Name
+    })
+    report.Revenue = roundMoney(report.Revenue)
+    report.CostOfGoods = roundMoney(report.CostOfGoods)
+    report.Margin = roundMoney(costedRevenue - report.CostOfGoods)
+    report.MarginPercent = marginPercent(costedRevenue, report.CostOfGoods)
+
+    return report, nil
+}
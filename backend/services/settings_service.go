@@ -0,0 +1,140 @@
+package services
+
+import (
+    "database/sql"
+    "fmt"
+    "sort"
+    "strconv"
+    "backend/models"
+    "backend/database"
+)
+
+// Setting keys and their defaults. Only known keys can be stored.
+const (
+    SettingManagerVoidLimit = "manager_void_limit"
+    SettingDiscountLimit    = "discount_limit_percent"
+    SettingReorderUsageDays = "reorder_usage_days"
+    SettingReorderCoverDays = "reorder_cover_days"
+)
+
+var settingDefaults = map[string]string{
+    // Largest invoice total a manager may void; 0 means no limit
+    SettingManagerVoidLimit: "0",
+    // Largest discount, as a percent of the line price, given without a
+    // manager; 0 means every discount needs one
+    SettingDiscountLimit:    "0",
+    // Days of sales averaged to estimate ingredient usage
+    SettingReorderUsageDays: "14",
+    // Days of usage a suggested reorder should cover beyond the reorder point
+    SettingReorderCoverDays: "7",
+}
+
+// settingValidators check a value before it is stored.
+var settingValidators = map[string]func(string) error{
+    SettingManagerVoidLimit: nonNegativeNumber,
+    SettingDiscountLimit:    percent,
+    SettingReorderUsageDays: positiveInteger,
+    SettingReorderCoverDays: nonNegativeNumber,
+}
+
+type SettingsService struct {
+    db *sql.DB
+}
+
+func NewSettingsService() *SettingsService {
+    return &SettingsService{
+        db: database.GetDB(),
+    }
+}
+
+// GetAllSettings returns every known setting, using the default for keys that were never saved.
+func (s *SettingsService) GetAllSettings() ([]models.Setting, error) {
+    rows, err := s.db.Query(`SELECT SettingKey, SettingValue, UpdatedAt FROM Settings`)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    stored := make(map[string]models.Setting)
+    for rows.Next() {
+        var setting models.Setting
+        if err := rows.Scan(&setting.Key, &setting.Value, &setting.UpdatedAt); err != nil {
+            return nil, err
+        }
+        stored[setting.Key] = setting
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    settings := []models.Setting{}
+    for key, value := range settingDefaults {
+        setting, ok := stored[key]
+        if !ok {
+            setting = models.Setting{Key: key, Value: value}
+        }
+        settings = append(settings, setting)
+    }
+
+    sort.Slice(settings, func(i, j int) bool { return settings[i].Key < settings[j].Key })
+    return settings, nil
+}
+
+// UpdateSetting stores a new value for a known setting.
+func (s *SettingsService) UpdateSetting(key, value string, actor *models.User) error {
+    if err := RequirePermission(actor, PermManageSettings); err != nil {
+        return err
+    }
+
+    validate, ok := settingValidators[key]
+    if !ok {
+        return FieldError("key", fmt.Sprintf("unknown setting %q", key))
+    }
+    if err := validate(value); err != nil {
+        return FieldError("value", err.Error())
+    }
+
+    _, err := s.db.Exec(`
+        MERGE Settings AS target
+        USING (SELECT ? AS SettingKey, ? AS SettingValue) AS source
+        ON target.SettingKey = source.SettingKey
+        WHEN MATCHED THEN UPDATE SET SettingValue = source.SettingValue, UpdatedAt = GETDATE()
+        WHEN NOT MATCHED THEN INSERT (SettingKey, SettingValue) VALUES (source.SettingKey, source.SettingValue);
+    `, key, value)
+    return err
+}
+
+// settingFloat reads a numeric setting inside a query or transaction.
+func settingFloat(q querier, key string) (float64, error) {
+    value := settingDefaults[key]
+    err := q.QueryRow(`SELECT SettingValue FROM Settings WHERE SettingKey = ?`, key).Scan(&value)
+    if err != nil && err != sql.ErrNoRows {
+        return 0, err
+    }
+
+    return strconv.ParseFloat(value, 64)
+}
+
+func nonNegativeNumber(value string) error {
+    v, err := strconv.ParseFloat(value, 64)
+    if err != nil || v < 0 {
+        return fmt.Errorf("must be a non-negative number")
+    }
+    return nil
+}
+
+func percent(value string) error {
+    v, err := strconv.ParseFloat(value, 64)
+    if err != nil || v < 0 || v > 100 {
+        return fmt.Errorf("must be a number from 0 to 100")
+    }
+    return nil
+}
+
+func positiveInteger(value string) error {
+    v, err := strconv.Atoi(value)
+    if err != nil || v < 1 {
+        return fmt.Errorf("must be a whole number of at least 1")
+    }
+    return nil
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+    "database/sql"
+    "log"
+    "math"
+    "time"
+    "backend/models"
+    "backend/database"
+)
+
+// StockAlertService flags ingredients that have fallen to their reorder point
+// and suggests how much to order.
+type StockAlertService struct {
+    db     *sql.DB
+    events *EventBroker
+}
+
+func NewStockAlertService(events *EventBroker) *StockAlertService {
+    return &StockAlertService{
+        db:     database.GetDB(),
+        events: events,
+    }
+}
+
+// Run checks stock now and then once per interval. It does not return.
+func (s *StockAlertService) Run(interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        if _, err := s.CheckStock(); err != nil {
+            log.Printf("stock check: %v", err)
+        }
+        <-ticker.C
+    }
+}
+
+type stockLevel struct {
+    ingredientID int
+    name         string
+    unit         string
+    onHand       float64
+    reorderPoint float64
+    usage        float64
+}
+
+// CheckStock opens an alert for every ingredient at or below its reorder
+// point, refreshes the figures of alerts that are still open and resolves
+// those whose stock has recovered. New and resolved alerts are published on
+// the event stream. It returns the open alerts.
+func (s *StockAlertService) CheckStock() ([]models.StockAlert, error) {
+    usageDays, err := settingFloat(s.db, SettingReorderUsageDays)
+    if err != nil {
+        return nil, err
+    }
+    coverDays, err := settingFloat(s.db, SettingReorderCoverDays)
+    if err != nil {
+        return nil, err
+    }
+    since := time.Now().AddDate(0, 0, -int(usageDays))
+
+    tx, err := s.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    // Usage is sales over the window multiplied out through current recipes
+    rows, err := tx.Query(`
+        SELECT g.IngredientID, g.Name, g.Unit, g.OnHand, g.ReorderPoint,
+               COALESCE((
+                   SELECT SUM(ii.Quantity * r.Quantity)
+                   FROM InvoiceItems ii
+                   JOIN Invoices v ON ii.InvoiceID = v.InvoiceID
+                   JOIN RecipeLines r ON r.ItemID = ii.ItemID AND r.IngredientID = g.IngredientID
+                   WHERE v.Status <> ? AND v.InvoiceDate >= ?
+               ), 0)
+        FROM Ingredients g WITH (UPDLOCK)
+        WHERE g.ReorderPoint IS NOT NULL
+        ORDER BY g.IngredientID
+    `, InvoiceStatusVoid, since)
+    if err != nil {
+        return nil, err
+    }
+
+    var levels []stockLevel
+    for rows.Next() {
+        var l stockLevel
+        if err := rows.Scan(&l.ingredientID, &l.name, &l.unit, &l.onHand, &l.reorderPoint, &l.usage); err != nil {
+            rows.Close()
+            return nil, err
+        }
+        levels = append(levels, l)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    var opened, resolved []models.StockAlert
+    for _, l := range levels {
+        if l.onHand > l.reorderPoint {
+            var alertID int
+            err := tx.QueryRow(`
+                UPDATE StockAlerts SET ResolvedAt = GETDATE(), OnHand = ?
+                OUTPUT INSERTED.AlertID
+                WHERE IngredientID = ? AND ResolvedAt IS NULL
+            `, l.onHand, l.ingredientID).Scan(&alertID)
+            if err == sql.ErrNoRows {
+                continue
+            }
+            if err != nil {
+                return nil, err
+            }
+            resolved = append(resolved, models.StockAlert{AlertID: alertID, IngredientID: l.ingredientID, IngredientName: l.name, Unit: l.unit, OnHand: l.onHand})
+            continue
+        }
+
+        dailyUsage := round3(l.usage / usageDays)
+        suggested := math.Max(0, round3(dailyUsage*coverDays+l.reorderPoint-l.onHand))
+
+        result, err := tx.Exec(`
+            UPDATE StockAlerts
+            SET OnHand = ?, ReorderPoint = ?, DailyUsage = ?, SuggestedQuantity = ?, CheckedAt = GETDATE()
+            WHERE IngredientID = ? AND ResolvedAt IS NULL
+        `, l.onHand, l.reorderPoint, dailyUsage, suggested, l.ingredientID)
+        if err != nil {
+            return nil, err
+        }
+        if n, err := result.RowsAffected(); err != nil {
+            return nil, err
+        } else if n > 0 {
+            continue
+        }
+
+        var alertID int
+        err = tx.QueryRow(`
+            INSERT INTO StockAlerts (IngredientID, OnHand, ReorderPoint, DailyUsage, SuggestedQuantity)
+            OUTPUT INSERTED.AlertID
+            VALUES (?, ?, ?, ?, ?)
+        `, l.ingredientID, l.onHand, l.reorderPoint, dailyUsage, suggested).Scan(&alertID)
+        if err != nil {
+            return nil, err
+        }
+        opened = append(opened, models.StockAlert{
+            AlertID:           alertID,
+            IngredientID:      l.ingredientID,
+            IngredientName:    l.name,
+            Unit:              l.unit,
+            OnHand:            l.onHand,
+            ReorderPoint:      l.reorderPoint,
+            DailyUsage:        dailyUsage,
+            SuggestedQuantity: suggested,
+        })
+    }
+
+    // Ingredients no longer tracked have nothing to reorder
+    _, err = tx.Exec(`
+        UPDATE StockAlerts SET ResolvedAt = GETDATE()
+        WHERE ResolvedAt IS NULL
+          AND IngredientID IN (SELECT IngredientID FROM Ingredients WHERE ReorderPoint IS NULL)
+    `)
+    if err != nil {
+        return nil, err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+
+    for _, alert := range opened {
+        s.events.Publish(EventStockLow, PermViewInventory, alert)
+    }
+    for _, alert := range resolved {
+        s.events.Publish(EventStockRestored, PermViewInventory, alert)
+    }
+
+    return s.ListAlerts()
+}
+
+// ListAlerts returns the open alerts, largest suggested order first.
+func (s *StockAlertService) ListAlerts() ([]models.StockAlert, error) {
+    rows, err := s.db.Query(`
+        SELECT a.AlertID, a.IngredientID, g.Name, g.Unit, a.OnHand, a.ReorderPoint,
+               a.DailyUsage, a.SuggestedQuantity, a.CreatedAt, a.CheckedAt
+        FROM StockAlerts a
+        JOIN Ingredients g ON a.IngredientID = g.IngredientID
+        WHERE a.ResolvedAt IS NULL
+        ORDER BY a.SuggestedQuantity DESC, g.Name
+    `)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    alerts := []models.StockAlert{}
+    for rows.Next() {
+        var a models.StockAlert
+        err := rows.Scan(&a.AlertID, &a.IngredientID, &a.IngredientName, &a.Unit, &a.OnHand, &a.ReorderPoint,
+            &a.DailyUsage, &a.SuggestedQuantity, &a.CreatedAt, &a.CheckedAt)
+        if err != nil {
+            return nil, err
+        }
+        alerts = append(alerts, a)
+    }
+
+    return alerts, rows.Err()
+}
+
+func round3(v float64) float64 {
+    return math.Round(v*1000) / 1000
+}
@@ -0,0 +1,411 @@
+package services
+
+import (
+    "database/sql"
+    "fmt"
+    "math"
+    "sort"
+    "backend/models"
+    "backend/database"
+)
+
+// Stock take statuses. Only one stock take can be open at a time.
+const (
+    StockTakeOpen   = "open"
+    StockTakePosted = "posted"
+)
+
+type StockTakeService struct {
+    db *sql.DB
+}
+
+func NewStockTakeService() *StockTakeService {
+    return &StockTakeService{
+        db: database.GetDB(),
+    }
+}
+
+// GetAllStockTakes returns every stock take without lines, newest first.
+func (s *StockTakeService) GetAllStockTakes() ([]models.StockTake, error) {
+    rows, err := s.db.Query(`
+        SELECT StockTakeID, Status, Notes, CreatedBy, CreatedAt, PostedBy, PostedAt
+        FROM StockTakes ORDER BY StockTakeID DESC
+    `)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    takes := []models.StockTake{}
+    for rows.Next() {
+        take, err := scanStockTake(rows)
+        if err != nil {
+            return nil, err
+        }
+        takes = append(takes, *take)
+    }
+
+    return takes, rows.Err()
+}
+
+func (s *StockTakeService) GetStockTake(stockTakeID int) (*models.StockTake, error) {
+    return loadStockTake(s.db, stockTakeID)
+}
+
+// CreateStockTake opens a stock take and records the expected quantity of
+// each ingredient to count. Counting an ingredient replaces its expected
+// quantity with the on-hand quantity at that moment.
+func (s *StockTakeService) CreateStockTake(req *models.CreateStockTakeRequest, actor *models.User) (*models.StockTake, error) {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    var openID int
+    err = tx.QueryRow(`SELECT StockTakeID FROM StockTakes WITH (UPDLOCK, HOLDLOCK) WHERE Status = ?`, StockTakeOpen).Scan(&openID)
+    if err == nil {
+        return nil, ConflictError("stock take %d is still open; post or delete it first", openID)
+    }
+    if err != sql.ErrNoRows {
+        return nil, err
+    }
+
+    var createdBy interface{}
+    if actor != nil {
+        createdBy = actor.UserID
+    }
+
+    var stockTakeID int
+    err = tx.QueryRow(`
+        INSERT INTO StockTakes (Status, Notes, CreatedBy)
+        OUTPUT INSERTED.StockTakeID
+        VALUES (?, ?, ?)
+    `, StockTakeOpen, req.Notes, createdBy).Scan(&stockTakeID)
+    if err != nil {
+        return nil, err
+    }
+
+    if len(req.IngredientIDs) == 0 {
+        _, err = tx.Exec(`
+            INSERT INTO StockTakeLines (StockTakeID, IngredientID, ExpectedQuantity)
+            SELECT ?, IngredientID, OnHand FROM Ingredients
+        `, stockTakeID)
+        if err != nil {
+            return nil, err
+        }
+    }
+    for _, id := range req.IngredientIDs {
+        _, err := tx.Exec(`
+            INSERT INTO StockTakeLines (StockTakeID, IngredientID, ExpectedQuantity)
+            SELECT ?, IngredientID, OnHand FROM Ingredients WHERE IngredientID = ?
+        `, stockTakeID, id)
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    take, err := loadStockTake(tx, stockTakeID)
+    if err != nil {
+        return nil, err
+    }
+    if err := writeAudit(tx, actor, AuditStockTake, stockTakeID, AuditCreate, nil, take); err != nil {
+        return nil, err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+
+    return take, nil
+}
+
+// RecordCounts stores counted quantities on an open stock take. Counting an
+// ingredient again replaces the earlier count. The till stays open during a
+// stock take, so each count is compared with the on-hand quantity when it is
+// entered, see countExpected.
+func (s *StockTakeService) RecordCounts(stockTakeID int, req *models.StockCountRequest, actor *models.User) (*models.StockTake, error) {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    if err := requireOpenStockTake(tx, stockTakeID); err != nil {
+        return nil, err
+    }
+    before, err := loadStockTake(tx, stockTakeID)
+    if err != nil {
+        return nil, err
+    }
+
+    // Lock ingredients in id order like other stock changes
+    order := make([]int, len(req.Counts))
+    for i := range order {
+        order[i] = i
+    }
+    sort.Slice(order, func(a, b int) bool {
+        return req.Counts[order[a]].IngredientID < req.Counts[order[b]].IngredientID
+    })
+
+    for _, i := range order {
+        count := req.Counts[i]
+        var onHand float64
+        err := tx.QueryRow(`
+            SELECT g.OnHand
+            FROM StockTakeLines l
+            JOIN Ingredients g WITH (UPDLOCK) ON l.IngredientID = g.IngredientID
+            WHERE l.StockTakeID = ? AND l.IngredientID = ?
+        `, stockTakeID, count.IngredientID).Scan(&onHand)
+        if err == sql.ErrNoRows {
+            return nil, FieldError(fmt.Sprintf("counts[%d].ingredient_id", i),
+                fmt.Sprintf("ingredient %d is not part of stock take %d", count.IngredientID, stockTakeID))
+        }
+        if err != nil {
+            return nil, err
+        }
+
+        _, err = tx.Exec(`
+            UPDATE StockTakeLines SET ExpectedQuantity = ?, CountedQuantity = ?, Reason = ?
+            WHERE StockTakeID = ? AND IngredientID = ?
+        `, countExpected(onHand), *count.CountedQuantity, count.Reason, stockTakeID, count.IngredientID)
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    take, err := loadStockTake(tx, stockTakeID)
+    if err != nil {
+        return nil, err
+    }
+    if err := writeAudit(tx, actor, AuditStockTake, stockTakeID, AuditUpdate, before, take); err != nil {
+        return nil, err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+
+    return take, nil
+}
+
+// PostStockTake adjusts stock by the variance of every counted ingredient and
+// closes the stock take. Ingredients that were not counted are left alone.
+func (s *StockTakeService) PostStockTake(stockTakeID int, actor *models.User) (*models.StockTake, error) {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    if err := requireOpenStockTake(tx, stockTakeID); err != nil {
+        return nil, err
+    }
+    before, err := loadStockTake(tx, stockTakeID)
+    if err != nil {
+        return nil, err
+    }
+
+    // Lines are ordered by name; lock ingredients in id order like other stock changes
+    variances := make(map[int]float64)
+    reasons := make(map[int]string)
+    for _, line := range before.Lines {
+        if line.Variance != nil && *line.Variance != 0 {
+            variances[line.IngredientID] = *line.Variance
+            reasons[line.IngredientID] = line.Reason
+        }
+    }
+
+    ids := sortedIngredientIDs(variances)
+    for _, id := range ids {
+        err := recordMovement(tx, movement{
+            ingredientID: id,
+            quantity:     variances[id],
+            reason:       MovementStockTake,
+            stockTakeID:  &stockTakeID,
+            note:         reasons[id],
+        }, actor)
+        if err != nil {
+            return nil, err
+        }
+    }
+    if err := syncIngredientAvailability(tx, ids); err != nil {
+        return nil, err
+    }
+
+    var postedBy interface{}
+    if actor != nil {
+        postedBy = actor.UserID
+    }
+    _, err = tx.Exec(`
+        UPDATE StockTakes SET Status = ?, PostedBy = ?, PostedAt = GETDATE()
+        WHERE StockTakeID = ?
+    `, StockTakePosted, postedBy, stockTakeID)
+    if err != nil {
+        return nil, err
+    }
+
+    take, err := loadStockTake(tx, stockTakeID)
+    if err != nil {
+        return nil, err
+    }
+    if err := writeAudit(tx, actor, AuditStockTake, stockTakeID, AuditPost, before, take); err != nil {
+        return nil, err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+
+    return take, nil
+}
+
+// DeleteStockTake discards an open stock take without changing stock. The
+// discarded counts are kept in the audit log.
+func (s *StockTakeService) DeleteStockTake(stockTakeID int, actor *models.User) error {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    if err := requireOpenStockTake(tx, stockTakeID); err != nil {
+        return err
+    }
+    before, err := loadStockTake(tx, stockTakeID)
+    if err != nil {
+        return err
+    }
+
+    if _, err := tx.Exec(`DELETE FROM StockTakeLines WHERE StockTakeID = ?`, stockTakeID); err != nil {
+        return err
+    }
+    if _, err := tx.Exec(`DELETE FROM StockTakes WHERE StockTakeID = ?`, stockTakeID); err != nil {
+        return err
+    }
+    if err := writeAudit(tx, actor, AuditStockTake, stockTakeID, AuditDelete, before, nil); err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+// countExpected is the expected quantity a count is compared with: the
+// on-hand quantity when the count is entered. Sales, receipts and wastage
+// recorded since the stock take was opened have already moved the on-hand
+// quantity, so comparing with the quantity at opening would apply them a
+// second time when the variance is posted.
+func countExpected(onHand float64) float64 {
+    return round3(onHand)
+}
+
+// countVariance is the adjustment posting makes for a counted line.
+func countVariance(expected, counted float64) float64 {
+    return round3(counted - expected)
+}
+
+func requireOpenStockTake(tx *sql.Tx, stockTakeID int) error {
+    var status string
+    err := tx.QueryRow(`SELECT Status FROM StockTakes WITH (UPDLOCK) WHERE StockTakeID = ?`, stockTakeID).Scan(&status)
+    if err == sql.ErrNoRows {
+        return NotFoundError("stock take", stockTakeID)
+    }
+    if err != nil {
+        return err
+    }
+    if status != StockTakeOpen {
+        return ConflictError("stock take %d has already been posted", stockTakeID)
+    }
+    return nil
+}
+
+// loadStockTake reads a stock take with its lines. Variances are valued at the
+// posted movement's cost once posted, and at the current cost before.
+func loadStockTake(q querier, stockTakeID int) (*models.StockTake, error) {
+    rows, err := q.Query(`
+        SELECT StockTakeID, Status, Notes, CreatedBy, CreatedAt, PostedBy, PostedAt
+        FROM StockTakes WHERE StockTakeID = ?
+    `, stockTakeID)
+    if err != nil {
+        return nil, err
+    }
+    if !rows.Next() {
+        rows.Close()
+        if err := rows.Err(); err != nil {
+            return nil, err
+        }
+        return nil, NotFoundError("stock take", stockTakeID)
+    }
+    take, err := scanStockTake(rows)
+    rows.Close()
+    if err != nil {
+        return nil, err
+    }
+
+    lineRows, err := q.Query(`
+        SELECT l.IngredientID, g.Name, g.Unit, l.ExpectedQuantity, l.CountedQuantity, l.Reason,
+               COALESCE(m.UnitCost, g.UnitCost, 0)
+        FROM StockTakeLines l
+        JOIN Ingredients g ON l.IngredientID = g.IngredientID
+        LEFT JOIN StockMovements m ON m.StockTakeID = l.StockTakeID AND m.IngredientID = l.IngredientID
+        WHERE l.StockTakeID = ?
+        ORDER BY g.Name
+    `, stockTakeID)
+    if err != nil {
+        return nil, err
+    }
+    defer lineRows.Close()
+
+    take.Lines = []models.StockTakeLine{}
+    for lineRows.Next() {
+        var line models.StockTakeLine
+        var counted sql.NullFloat64
+        var unitCost float64
+        err := lineRows.Scan(&line.IngredientID, &line.IngredientName, &line.Unit, &line.ExpectedQuantity,
+            &counted, &line.Reason, &unitCost)
+        if err != nil {
+            return nil, err
+        }
+
+        if counted.Valid {
+            variance := countVariance(line.ExpectedQuantity, counted.Float64)
+            value := roundMoney(variance * unitCost)
+            line.CountedQuantity = &counted.Float64
+            line.Variance = &variance
+            line.VarianceValue = &value
+            take.VarianceValue += value
+        }
+        take.Lines = append(take.Lines, line)
+    }
+    take.VarianceValue = roundMoney(take.VarianceValue)
+
+    return take, lineRows.Err()
+}
+
+func scanStockTake(rows *sql.Rows) (*models.StockTake, error) {
+    var take models.StockTake
+    var createdBy, postedBy sql.NullInt64
+    var postedAt sql.NullTime
+    err := rows.Scan(&take.StockTakeID, &take.Status, &take.Notes, &createdBy, &take.CreatedAt, &postedBy, &postedAt)
+    if err != nil {
+        return nil, err
+    }
+
+    if createdBy.Valid {
+        id := int(createdBy.Int64)
+        take.CreatedBy = &id
+    }
+    if postedBy.Valid {
+        id := int(postedBy.Int64)
+        take.PostedBy = &id
+    }
+    if postedAt.Valid {
+        take.PostedAt = &postedAt.Time
+    }
+
+    return &take, nil
+}
+
+func roundMoney(v float64) float64 {
+    return math.Round(v*100) / 100
+}
@@ -0,0 +1,35 @@
+package services
+
+import "testing"
+
+// The till keeps selling during a stock take. Stock moved before a count is
+// part of what is counted; stock moved after it is not, and must survive
+// posting.
+func TestStockTakeDuringSales(t *testing.T) {
+    tests := []struct {
+        name       string
+        opened     float64
+        moved      float64
+        counted    float64
+        movedAfter float64
+        wantAfter  float64
+    }{
+        // 3 sold while the stock take is open and 7 counted: nothing is missing
+        {"sale", 10, -3, 7, 0, 7},
+        {"sale and a shortfall", 10, -3, 6, 0, 6},
+        {"delivery", 10, 5, 15, 0, 15},
+        {"sale after the count", 10, -3, 7, -2, 5},
+        {"no movement", 10, 0, 9.5, 0, 9.5},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            onHand := tt.opened + tt.moved
+            expected := countExpected(onHand)
+            after := round3(onHand + tt.movedAfter + countVariance(expected, tt.counted))
+            if after != tt.wantAfter {
+                t.Errorf("on hand after posting = %v, want %v", after, tt.wantAfter)
+            }
+        })
+    }
+}
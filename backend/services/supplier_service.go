@@ -0,0 +1,138 @@
+package services
+
+import (
+    "database/sql"
+    "backend/models"
+    "backend/database"
+)
+
+type SupplierService struct {
+    db *sql.DB
+}
+
+func NewSupplierService() *SupplierService {
+    return &SupplierService{
+        db: database.GetDB(),
+    }
+}
+
+func (s *SupplierService) GetAllSuppliers() ([]models.Supplier, error) {
+    rows, err := s.db.Query(`SELECT SupplierID, Name, ContactName, Phone, Email, Notes FROM Suppliers ORDER BY Name`)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    suppliers := []models.Supplier{}
+    for rows.Next() {
+        var supplier models.Supplier
+        err := rows.Scan(&supplier.SupplierID, &supplier.Name, &supplier.ContactName, &supplier.Phone, &supplier.Email, &supplier.Notes)
+        if err != nil {
+            return nil, err
+        }
+        suppliers = append(suppliers, supplier)
+    }
+
+    return suppliers, rows.Err()
+}
+
+func (s *SupplierService) GetSupplierByID(supplierID int) (*models.Supplier, error) {
+    return loadSupplier(s.db, supplierID)
+}
+
+func loadSupplier(q querier, supplierID int) (*models.Supplier, error) {
+    var supplier models.Supplier
+    err := q.QueryRow(`
+        SELECT SupplierID, Name, ContactName, Phone, Email, Notes
+        FROM Suppliers WITH (UPDLOCK) WHERE SupplierID = ?
+    `, supplierID).Scan(&supplier.SupplierID, &supplier.Name, &supplier.ContactName, &supplier.Phone, &supplier.Email, &supplier.Notes)
+    if err == sql.ErrNoRows {
+        return nil, NotFoundError("supplier", supplierID)
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    return &supplier, nil
+}
+
+func (s *SupplierService) CreateSupplier(supplier *models.Supplier, actor *models.User) error {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    err = tx.QueryRow(`
+        INSERT INTO Suppliers (Name, ContactName, Phone, Email, Notes)
+        OUTPUT INSERTED.SupplierID
+        VALUES (?, ?, ?, ?, ?)
+    `, supplier.Name, supplier.ContactName, supplier.Phone, supplier.Email, supplier.Notes).Scan(&supplier.SupplierID)
+    if err != nil {
+        return err
+    }
+
+    if err := writeAudit(tx, actor, AuditSupplier, supplier.SupplierID, AuditCreate, nil, supplier); err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+func (s *SupplierService) UpdateSupplier(supplier *models.Supplier, actor *models.User) error {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    before, err := loadSupplier(tx, supplier.SupplierID)
+    if err != nil {
+        return err
+    }
+
+    _, err = tx.Exec(`
+        UPDATE Suppliers SET Name = ?, ContactName = ?, Phone = ?, Email = ?, Notes = ?
+        WHERE SupplierID = ?
+    `, supplier.Name, supplier.ContactName, supplier.Phone, supplier.Email, supplier.Notes, supplier.SupplierID)
+    if err != nil {
+        return err
+    }
+
+    if err := writeAudit(tx, actor, AuditSupplier, supplier.SupplierID, AuditUpdate, before, supplier); err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+func (s *SupplierService) DeleteSupplier(supplierID int, actor *models.User) error {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    before, err := loadSupplier(tx, supplierID)
+    if err != nil {
+        return err
+    }
+
+    var count int
+    if err := tx.QueryRow(`SELECT COUNT(*) FROM PurchaseOrders WHERE SupplierID = ?`, supplierID).Scan(&count); err != nil {
+        return err
+    }
+    if count > 0 {
+        return ConflictError("cannot delete supplier: they have %d purchase orders", count)
+    }
+
+    if _, err := tx.Exec(`DELETE FROM Suppliers WHERE SupplierID = ?`, supplierID); err != nil {
+        return err
+    }
+
+    if err := writeAudit(tx, actor, AuditSupplier, supplierID, AuditDelete, before, nil); err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+    "database/sql"
+    "backend/models"
+    "backend/database"
+)
+
+type UserService struct {
+    db *sql.DB
+}
+
+func NewUserService() *UserService {
+    return &UserService{
+        db: database.GetDB(),
+    }
+}
+
+func (s *UserService) GetAllUsers() ([]models.User, error) {
+    query := `SELECT UserID, Username, FullName, Role, IsActive, CreatedAt FROM Users ORDER BY Username`
+
+    rows, err := s.db.Query(query)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    users := []models.User{}
+    for rows.Next() {
+        var user models.User
+        err := rows.Scan(&user.UserID, &user.Username, &user.FullName, &user.Role, &user.IsActive, &user.CreatedAt)
+        if err != nil {
+            return nil, err
+        }
+        users = append(users, user)
+    }
+
+    return users, rows.Err()
+}
+
+func (s *UserService) CreateUser(req *models.CreateUserRequest, actor *models.User) (*models.User, error) {
+    if err := RequirePermission(actor, PermManageUsers); err != nil {
+        return nil, err
+    }
+
+    hash, err := HashPassword(req.Password)
+    if err != nil {
+        return nil, err
+    }
+
+    user := models.User{Username: req.Username, FullName: req.FullName, Role: req.Role, IsActive: true}
+    err = s.db.QueryRow(`
+        INSERT INTO Users (Username, PasswordHash, FullName, Role)
+        OUTPUT INSERTED.UserID, INSERTED.CreatedAt
+        VALUES (?, ?, ?, ?)
+    `, req.Username, hash, req.FullName, req.Role).Scan(&user.UserID, &user.CreatedAt)
+    if err != nil {
+        return nil, err
+    }
+
+    return &user, nil
+}
+
+// UpdateUser changes a user's name, role, active flag and optionally password.
+// It refuses changes that would leave no active administrator.
+func (s *UserService) UpdateUser(userID int, req *models.UpdateUserRequest, actor *models.User) error {
+    if err := RequirePermission(actor, PermManageUsers); err != nil {
+        return err
+    }
+
+    tx, err := s.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    if req.Role != RoleAdmin || !req.IsActive {
+        var otherAdmins int
+        err := tx.QueryRow(`
+            SELECT COUNT(*) FROM Users WITH (UPDLOCK)
+            WHERE Role = ? AND IsActive = 1 AND UserID <> ?
+        `, RoleAdmin, userID).Scan(&otherAdmins)
+        if err != nil {
+            return err
+        }
+        if otherAdmins == 0 {
+            return ConflictError("at least one active admin account is required")
+        }
+    }
+
+    result, err := tx.Exec(`
+        UPDATE Users SET FullName = ?, Role = ?, IsActive = ?
+        WHERE UserID = ?
+    `, req.FullName, req.Role, req.IsActive, userID)
+    if err != nil {
+        return err
+    }
+    if err := checkAffected(result, "user", userID); err != nil {
+        return err
+    }
+
+    if req.Password != "" {
+        hash, err := HashPassword(req.Password)
+        if err != nil {
+            return err
+        }
+        if _, err := tx.Exec(`UPDATE Users SET PasswordHash = ? WHERE UserID = ?`, hash, userID); err != nil {
+            return err
+        }
+    }
+
+    // Role, status and password changes end the user's existing sessions
+    _, err = tx.Exec(`
+        UPDATE RefreshTokens SET RevokedAt = GETDATE()
+        WHERE UserID = ? AND RevokedAt IS NULL
+    `, userID)
+    if err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
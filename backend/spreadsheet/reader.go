@@ -0,0 +1,247 @@
+package spreadsheet
+
+import (
+    "archive/zip"
+    "bytes"
+    "encoding/csv"
+    "encoding/xml"
+    "fmt"
+    "io"
+    "path"
+    "strconv"
+    "strings"
+)
+
+// FormatFromFilename picks the import format from a file extension.
+func FormatFromFilename(filename string) (string, error) {
+    switch strings.ToLower(path.Ext(filename)) {
+    case ".csv":
+        return "csv", nil
+    case ".xlsx":
+        return "xlsx", nil
+    default:
+        return "", fmt.Errorf("unsupported file type %q: upload a .csv or .xlsx file", path.Ext(filename))
+    }
+}
+
+// ReadAll returns every row of a CSV file or of the first sheet of an XLSX
+// workbook. Cells are returned as text with surrounding spaces trimmed.
+func ReadAll(data []byte, format string) ([][]string, error) {
+    switch format {
+    case "csv":
+        r := csv.NewReader(bytes.NewReader(data))
+        r.FieldsPerRecord = -1
+        rows, err := r.ReadAll()
+        if err != nil {
+            return nil, fmt.Errorf("invalid CSV file: %v", err)
+        }
+        for _, row := range rows {
+            for i := range row {
+                row[i] = strings.TrimSpace(row[i])
+            }
+        }
+        // Strip a UTF-8 byte order mark written by Excel
+        if len(rows) > 0 && len(rows[0]) > 0 {
+            rows[0][0] = strings.TrimPrefix(rows[0][0], "\ufeff")
+        }
+        return rows, nil
+    case "xlsx":
+        return readXLSX(data)
+    default:
+        return nil, fmt.Errorf("unsupported import format %q", format)
+    }
+}
+
+type xlsxRelationships struct {
+    Relationships []struct {
+        ID     string `xml:"Id,attr"`
+        Target string `xml:"Target,attr"`
+    } `xml:"Relationship"`
+}
+
+type xlsxWorkbook struct {
+    Sheets []struct {
+        RelID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+    } `xml:"sheets>sheet"`
+}
+
+type xlsxRichText struct {
+    Text string `xml:"t"`
+    Runs []struct {
+        Text string `xml:"t"`
+    } `xml:"r"`
+}
+
+func (t xlsxRichText) String() string {
+    if len(t.Runs) == 0 {
+        return t.Text
+    }
+    var b strings.Builder
+    for _, run := range t.Runs {
+        b.WriteString(run.Text)
+    }
+    return b.String()
+}
+
+type xlsxSharedStrings struct {
+    Items []xlsxRichText `xml:"si"`
+}
+
+// Sheet limits of Excel. References beyond them are rejected rather than
+// allocated, and so are sheets whose cells, counting the empty ones before a
+// referenced cell, would not fit in memory.
+const (
+    maxXLSXRows    = 1048576
+    maxXLSXColumns = 16384 // XFD
+    maxXLSXCells   = 2 << 20
+)
+
+type xlsxSheet struct {
+    Rows []struct {
+        Number int `xml:"r,attr"`
+        Cells  []struct {
+            Ref    string        `xml:"r,attr"`
+            Type   string        `xml:"t,attr"`
+            Value  string        `xml:"v"`
+            Inline *xlsxRichText `xml:"is"`
+        } `xml:"c"`
+    } `xml:"sheetData>row"`
+}
+
+func readXLSX(data []byte) ([][]string, error) {
+    zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+    if err != nil {
+        return nil, fmt.Errorf("invalid XLSX file: %v", err)
+    }
+
+    files := make(map[string]*zip.File)
+    for _, f := range zr.File {
+        files[f.Name] = f
+    }
+
+    var workbook xlsxWorkbook
+    if err := decodeXLSXPart(files, "xl/workbook.xml", &workbook); err != nil {
+        return nil, err
+    }
+    if len(workbook.Sheets) == 0 {
+        return nil, fmt.Errorf("invalid XLSX file: workbook has no sheets")
+    }
+
+    var rels xlsxRelationships
+    if err := decodeXLSXPart(files, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+        return nil, err
+    }
+
+    sheetPath := ""
+    for _, rel := range rels.Relationships {
+        if rel.ID == workbook.Sheets[0].RelID {
+            sheetPath = rel.Target
+        }
+    }
+    if sheetPath == "" {
+        return nil, fmt.Errorf("invalid XLSX file: first sheet not found")
+    }
+    if strings.HasPrefix(sheetPath, "/") {
+        sheetPath = strings.TrimPrefix(sheetPath, "/")
+    } else {
+        sheetPath = path.Join("xl", sheetPath)
+    }
+
+    var shared xlsxSharedStrings
+    if _, ok := files["xl/sharedStrings.xml"]; ok {
+        if err := decodeXLSXPart(files, "xl/sharedStrings.xml", &shared); err != nil {
+            return nil, err
+        }
+    }
+
+    var sheet xlsxSheet
+    if err := decodeXLSXPart(files, sheetPath, &sheet); err != nil {
+        return nil, err
+    }
+
+    rows := make([][]string, 0, len(sheet.Rows))
+    cells := 0
+    for _, r := range sheet.Rows {
+        // Rows without cells may be left out of the sheet; keep the gaps so
+        // row numbers in import reports match the spreadsheet
+        if r.Number != 0 {
+            if r.Number <= len(rows) || r.Number > maxXLSXRows {
+                return nil, fmt.Errorf("invalid XLSX file: row %d is out of order or beyond row %d", r.Number, maxXLSXRows)
+            }
+            for len(rows) < r.Number-1 {
+                rows = append(rows, nil)
+            }
+        }
+
+        var row []string
+        for i, c := range r.Cells {
+            col := i
+            if c.Ref != "" {
+                col = columnIndex(c.Ref)
+            }
+            if col < 0 || col >= maxXLSXColumns {
+                return nil, fmt.Errorf("invalid XLSX file: cell %q in row %d is beyond column XFD", c.Ref, len(rows)+1)
+            }
+            if col >= len(row) {
+                if cells += col + 1 - len(row); cells > maxXLSXCells {
+                    return nil, fmt.Errorf("invalid XLSX file: sheet has more than %d cells", maxXLSXCells)
+                }
+            }
+            for len(row) <= col {
+                row = append(row, "")
+            }
+
+            value := c.Value
+            switch c.Type {
+            case "s":
+                idx, err := strconv.Atoi(c.Value)
+                if err != nil || idx < 0 || idx >= len(shared.Items) {
+                    return nil, fmt.Errorf("invalid XLSX file: bad shared string in cell %s", c.Ref)
+                }
+                value = shared.Items[idx].String()
+            case "inlineStr":
+                if c.Inline != nil {
+                    value = c.Inline.String()
+                }
+            }
+            row[col] = strings.TrimSpace(value)
+        }
+        rows = append(rows, row)
+    }
+
+    return rows, nil
+}
+
+func decodeXLSXPart(files map[string]*zip.File, name string, v interface{}) error {
+    f, ok := files[name]
+    if !ok {
+        return fmt.Errorf("invalid XLSX file: missing %s", name)
+    }
+
+    rc, err := f.Open()
+    if err != nil {
+        return err
+    }
+    defer rc.Close()
+
+    if err := xml.NewDecoder(io.LimitReader(rc, 64<<20)).Decode(v); err != nil {
+        return fmt.Errorf("invalid XLSX file: %s: %v", name, err)
+    }
+    return nil
+}
+
+// columnIndex converts a cell reference such as "AB12" to a zero-based column
+// index. It returns -1 for a reference without a column or beyond column XFD.
+func columnIndex(ref string) int {
+    index := 0
+    for _, r := range ref {
+        if r < 'A' || r > 'Z' {
+            break
+        }
+        index = index*26 + int(r-'A') + 1
+        if index > maxXLSXColumns {
+            return -1
+        }
+    }
+    return index - 1
+}
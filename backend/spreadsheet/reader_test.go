@@ -0,0 +1,74 @@
+package spreadsheet
+
+import (
+    "archive/zip"
+    "bytes"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+// workbook builds an XLSX file whose first sheet has the given sheetData.
+func workbook(t *testing.T, sheetData string) []byte {
+    t.Helper()
+    parts := map[string]string{
+        "xl/workbook.xml": `<workbook xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+            `<sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+        "xl/_rels/workbook.xml.rels": `<Relationships><Relationship Id="rId1" Target="worksheets/sheet1.xml"/></Relationships>`,
+        "xl/worksheets/sheet1.xml":   `<worksheet><sheetData>` + sheetData + `</sheetData></worksheet>`,
+    }
+
+    var buf bytes.Buffer
+    zw := zip.NewWriter(&buf)
+    for name, content := range parts {
+        w, err := zw.Create(name)
+        if err != nil {
+            t.Fatal(err)
+        }
+        w.Write([]byte(content))
+    }
+    if err := zw.Close(); err != nil {
+        t.Fatal(err)
+    }
+    return buf.Bytes()
+}
+
+func TestReadXLSX(t *testing.T) {
+    // Row 3 is missing from the file, and row 4 skips column B
+    data := workbook(t, `<row r="1"><c r="A1" t="inlineStr"><is><t>name</t></is></c><c r="B1" t="inlineStr"><is><t>price</t></is></c></row>`+
+        `<row r="2"><c r="A2" t="inlineStr"><is><t> Cola </t></is></c><c r="B2"><v>2.5</v></c></row>`+
+        `<row r="4"><c r="A4" t="inlineStr"><is><t>Tea</t></is></c><c r="C4"><v>1</v></c></row>`)
+
+    rows, err := ReadAll(data, "xlsx")
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := [][]string{{"name", "price"}, {"Cola", "2.5"}, nil, {"Tea", "", "1"}}
+    if !reflect.DeepEqual(rows, want) {
+        t.Errorf("got %q, want %q", rows, want)
+    }
+}
+
+func TestReadXLSXRejectsBadReferences(t *testing.T) {
+    tests := []struct {
+        name      string
+        sheetData string
+        want      string
+    }{
+        {"column beyond XFD", `<row r="1"><c r="XFDZZZZ1"><v>1</v></c></row>`, "beyond column XFD"},
+        {"column overflow", `<row r="1"><c r="` + strings.Repeat("Z", 20) + `1"><v>1</v></c></row>`, "beyond column XFD"},
+        {"no column", `<row r="1"><c r="12"><v>1</v></c></row>`, "beyond column XFD"},
+        {"row beyond the sheet", `<row r="1048577"><c r="A1048577"><v>1</v></c></row>`, "beyond row"},
+        {"rows out of order", `<row r="2"><c r="A2"><v>1</v></c></row><row r="1"><c r="A1"><v>1</v></c></row>`, "out of order"},
+        {"too many cells", strings.Repeat(`<row><c r="XFD1"><v>1</v></c></row>`, 200), "more than"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            _, err := ReadAll(workbook(t, tt.sheetData), "xlsx")
+            if err == nil || !strings.Contains(err.Error(), tt.want) {
+                t.Errorf("got error %v, want one containing %q", err, tt.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,113 @@
+package spreadsheet
+
+import (
+    "encoding/csv"
+    "fmt"
+    "io"
+    "net/http"
+    "strconv"
+    "time"
+)
+
+// flushEvery controls how many rows are buffered before they are pushed to
+// the client, so large exports start downloading straight away.
+const flushEvery = 200
+
+// Writer streams rows of a single sheet to an underlying io.Writer.
+type Writer interface {
+    WriteRow(values ...interface{}) error
+    Close() error
+}
+
+// IsSupported reports whether format is one of the export formats.
+func IsSupported(format string) bool {
+    return format == "csv" || format == "xlsx"
+}
+
+// ContentType returns the MIME type for an export format.
+func ContentType(format string) string {
+    if format == "xlsx" {
+        return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+    }
+    return "text/csv"
+}
+
+// NewWriter returns a streaming writer for the given format ("csv" or "xlsx").
+func NewWriter(w io.Writer, format string, sheetName string) (Writer, error) {
+    switch format {
+    case "csv":
+        return &csvWriter{w: csv.NewWriter(w), out: w}, nil
+    case "xlsx":
+        return newXLSXWriter(w, sheetName)
+    default:
+        return nil, fmt.Errorf("unsupported export format %q", format)
+    }
+}
+
+type csvWriter struct {
+    w    *csv.Writer
+    out  io.Writer
+    rows int
+}
+
+func (c *csvWriter) WriteRow(values ...interface{}) error {
+    record := make([]string, len(values))
+    for i, v := range values {
+        record[i] = FormatValue(v)
+    }
+
+    if err := c.w.Write(record); err != nil {
+        return err
+    }
+
+    c.rows++
+    if c.rows%flushEvery == 0 {
+        c.w.Flush()
+        flush(c.out)
+    }
+    return c.w.Error()
+}
+
+func (c *csvWriter) Close() error {
+    c.w.Flush()
+    flush(c.out)
+    return c.w.Error()
+}
+
+// FormatValue renders a cell value as text.
+func FormatValue(v interface{}) string {
+    switch val := v.(type) {
+    case nil:
+        return ""
+    case string:
+        return val
+    case int:
+        return strconv.Itoa(val)
+    case int64:
+        return strconv.FormatInt(val, 10)
+    case float64:
+        return strconv.FormatFloat(val, 'f', 2, 64)
+    case *float64:
+        if val == nil {
+            return ""
+        }
+        return FormatValue(*val)
+    case bool:
+        return strconv.FormatBool(val)
+    case time.Time:
+        return val.Format("2006-01-02 15:04:05")
+    case *time.Time:
+        if val == nil {
+            return ""
+        }
+        return FormatValue(*val)
+    default:
+        return fmt.Sprint(val)
+    }
+}
+
+func flush(w io.Writer) {
+    if f, ok := w.(http.Flusher); ok {
+        f.Flush()
+    }
+}
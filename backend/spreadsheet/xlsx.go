@@ -0,0 +1,175 @@
+package spreadsheet
+
+import (
+    "archive/zip"
+    "encoding/xml"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const contentTypesXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+</Types>`
+
+const rootRelsXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+
+const workbookXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+
+const workbookRelsXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`
+
+const stylesXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<fonts count="1"><font><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="1"><fill><patternFill patternType="none"/></fill></fills>
+<borders count="1"><border/></borders>
+<cellStyleXfs count="1"><xf/></cellStyleXfs>
+<cellXfs count="1"><xf/></cellXfs>
+</styleSheet>`
+
+const sheetHeaderXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+
+const sheetFooterXML = `</sheetData></worksheet>`
+
+// xlsxWriter writes a single-sheet workbook. The static parts are written up
+// front so the worksheet can be streamed as the last zip entry, using inline
+// strings to avoid having to build a shared string table in memory.
+type xlsxWriter struct {
+    zw    *zip.Writer
+    sheet io.Writer
+    out   io.Writer
+    rows  int
+}
+
+func newXLSXWriter(w io.Writer, sheetName string) (*xlsxWriter, error) {
+    zw := zip.NewWriter(w)
+
+    var name strings.Builder
+    xml.EscapeText(&name, []byte(sheetName))
+
+    parts := []struct {
+        path    string
+        content string
+    }{
+        {"[Content_Types].xml", contentTypesXML},
+        {"_rels/.rels", rootRelsXML},
+        {"xl/workbook.xml", fmt.Sprintf(workbookXML, name.String())},
+        {"xl/_rels/workbook.xml.rels", workbookRelsXML},
+        {"xl/styles.xml", stylesXML},
+    }
+
+    for _, part := range parts {
+        f, err := zw.Create(part.path)
+        if err != nil {
+            return nil, err
+        }
+        if _, err := io.WriteString(f, part.content); err != nil {
+            return nil, err
+        }
+    }
+
+    sheet, err := zw.Create("xl/worksheets/sheet1.xml")
+    if err != nil {
+        return nil, err
+    }
+    if _, err := io.WriteString(sheet, sheetHeaderXML); err != nil {
+        return nil, err
+    }
+
+    return &xlsxWriter{zw: zw, sheet: sheet, out: w}, nil
+}
+
+func (x *xlsxWriter) WriteRow(values ...interface{}) error {
+    x.rows++
+
+    var b strings.Builder
+    fmt.Fprintf(&b, `<row r="%d">`, x.rows)
+    for i, v := range values {
+        ref := columnName(i) + strconv.Itoa(x.rows)
+        // Optional figures are left blank when unset
+        if p, ok := v.(*float64); ok {
+            if p == nil {
+                continue
+            }
+            v = *p
+        }
+        if p, ok := v.(*time.Time); ok {
+            if p == nil {
+                continue
+            }
+            v = *p
+        }
+        switch val := v.(type) {
+        case nil:
+            continue
+        case int, int64:
+            fmt.Fprintf(&b, `<c r="%s"><v>%d</v></c>`, ref, val)
+        case float64:
+            fmt.Fprintf(&b, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(val, 'f', -1, 64))
+        case bool:
+            bit := 0
+            if val {
+                bit = 1
+            }
+            fmt.Fprintf(&b, `<c r="%s" t="b"><v>%d</v></c>`, ref, bit)
+        case time.Time:
+            fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t>%s</t></is></c>`, ref, FormatValue(val))
+        default:
+            fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+            xml.EscapeText(&b, []byte(FormatValue(val)))
+            b.WriteString(`</t></is></c>`)
+        }
+    }
+    b.WriteString(`</row>`)
+
+    if _, err := io.WriteString(x.sheet, b.String()); err != nil {
+        return err
+    }
+
+    if x.rows%flushEvery == 0 {
+        if err := x.zw.Flush(); err != nil {
+            return err
+        }
+        flush(x.out)
+    }
+    return nil
+}
+
+func (x *xlsxWriter) Close() error {
+    if _, err := io.WriteString(x.sheet, sheetFooterXML); err != nil {
+        return err
+    }
+    if err := x.zw.Close(); err != nil {
+        return err
+    }
+    flush(x.out)
+    return nil
+}
+
+// columnName converts a zero-based column index to its letter form (0 -> A, 26 -> AA).
+func columnName(index int) string {
+    name := ""
+    for index >= 0 {
+        name = string(rune('A'+index%26)) + name
+        index = index/26 - 1
+    }
+    return name
+}
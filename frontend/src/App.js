@@ -7,6 +7,8 @@ import ItemsManagement from './components/Items/ItemsManagement';
 import CategoriesManagement from './components/Categories/CategoriesManagement';
 import CustomersManagement from './components/Customers/CustomersManagement';
 import InvoicesManagement from './components/Invoices/InvoicesManagement';
+import Login from './components/Auth/Login';
+import { getTokens } from './services/api';
 
 const theme = createTheme({
   palette: {
@@ -19,20 +21,35 @@ const theme = createTheme({
   },
 });
 
+// Sends signed-out users to the login page
+const RequireAuth = ({ children }) => (
+  getTokens() ? children : <Navigate to="/login" replace />
+);
+
 function App() {
   return (
     <ThemeProvider theme={theme}>
       <CssBaseline />
       <Router>
-        <Layout>
-          <Routes>
-            <Route path="/" element={<Navigate to="/items" replace />} />
-            <Route path="/items" element={<ItemsManagement />} />
-            <Route path="/categories" element={<CategoriesManagement />} />
-            <Route path="/customers" element={<CustomersManagement />} />
-            <Route path="/invoices" element={<InvoicesManagement />} />
-          </Routes>
-        </Layout>
+        <Routes>
+          <Route path="/login" element={<Login />} />
+          <Route
+            path="*"
+            element={
+              <RequireAuth>
+                <Layout>
+                  <Routes>
+                    <Route path="/" element={<Navigate to="/items" replace />} />
+                    <Route path="/items" element={<ItemsManagement />} />
+                    <Route path="/categories" element={<CategoriesManagement />} />
+                    <Route path="/customers" element={<CustomersManagement />} />
+                    <Route path="/invoices" element={<InvoicesManagement />} />
+                  </Routes>
+                </Layout>
+              </RequireAuth>
+            }
+          />
+        </Routes>
       </Router>
     </ThemeProvider>
   );
@@ -0,0 +1,53 @@
+import { useState } from 'react';
+import { Box, Paper, Typography, TextField, Button, Alert } from '@mui/material';
+import { useNavigate } from 'react-router-dom';
+import { authAPI, setTokens } from '../../services/api';
+
+const Login = () => {
+  const navigate = useNavigate();
+  const [formData, setFormData] = useState({ username: '', password: '' });
+  const [error, setError] = useState('');
+
+  const handleSubmit = async (event) => {
+    event.preventDefault();
+    try {
+      const response = await authAPI.login(formData.username, formData.password);
+      setTokens(response.data.data);
+      navigate('/items', { replace: true });
+    } catch (error) {
+      setError(error.response?.data?.error || 'Failed to sign in');
+    }
+  };
+
+  return (
+    <Box sx={{ display: 'flex', justifyContent: 'center', mt: 12 }}>
+      <Paper component="form" onSubmit={handleSubmit} sx={{ p: 4, width: 360 }}>
+        <Typography variant="h5" gutterBottom>
+          Pizza Shop Billing System
+        </Typography>
+        {error && <Alert severity="error" sx={{ mb: 2 }}>{error}</Alert>}
+        <TextField
+          label="Username"
+          fullWidth
+          margin="normal"
+          autoFocus
+          value={formData.username}
+          onChange={(e) => setFormData({ ...formData, username: e.target.value })}
+        />
+        <TextField
+          label="Password"
+          type="password"
+          fullWidth
+          margin="normal"
+          value={formData.password}
+          onChange={(e) => setFormData({ ...formData, password: e.target.value })}
+        />
+        <Button type="submit" variant="contained" fullWidth sx={{ mt: 2 }}>
+          Sign in
+        </Button>
+      </Paper>
+    </Box>
+  );
+};
+
+export default Login;
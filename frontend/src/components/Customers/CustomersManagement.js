@@ -26,8 +26,7 @@ const CustomersManagement = () => {
 
   const loadCustomers = async () => {
     try {
-      const response = await customersAPI.getAll();
-      setCustomers(response.data.data || []);
+      setCustomers(await customersAPI.getAllPages());
     } catch (error) {
       setError('Failed to load customers');
     }
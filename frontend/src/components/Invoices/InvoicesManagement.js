@@ -32,8 +32,7 @@ const InvoicesManagement = () => {
 
   const loadInvoices = async () => {
     try {
-      const response = await invoicesAPI.getAll();
-      setInvoices(response.data.data || []);
+      setInvoices(await invoicesAPI.getAllPages());
     } catch (error) {
       setError('Failed to load invoices');
     }
@@ -41,8 +40,7 @@ const InvoicesManagement = () => {
 
   const loadCustomers = async () => {
     try {
-      const response = await customersAPI.getAll();
-      setCustomers(response.data.data || []);
+      setCustomers(await customersAPI.getAllPages());
     } catch (error) {
       setError('Failed to load customers');
     }
@@ -50,8 +48,7 @@ const InvoicesManagement = () => {
 
   const loadItems = async () => {
     try {
-      const response = await itemsAPI.getAll();
-      setItems(response.data.data || []);
+      setItems(await itemsAPI.getAllPages());
     } catch (error) {
       setError('Failed to load items');
     }
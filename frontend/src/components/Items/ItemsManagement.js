@@ -29,8 +29,7 @@ const ItemsManagement = () => {
 
   const loadItems = async () => {
     try {
-      const response = await itemsAPI.getAll();
-      setItems(response.data.data || []);
+      setItems(await itemsAPI.getAllPages());
     } catch (error) {
       setError('Failed to load items');
     }
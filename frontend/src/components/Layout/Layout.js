@@ -1,5 +1,6 @@
 import { AppBar, Toolbar, Typography, Container, Box, Button } from '@mui/material';
 import { useNavigate, useLocation } from 'react-router-dom';
+import { authAPI, clearTokens } from '../../services/api';
 
 const Layout = ({ children }) => {
   const navigate = useNavigate();
@@ -12,6 +13,16 @@ const Layout = ({ children }) => {
     { label: 'Invoices', path: '/invoices' },
   ];
 
+  const handleLogout = async () => {
+    try {
+      await authAPI.logout();
+    } catch (error) {
+      // The session is dropped locally even if the server could not be reached
+    }
+    clearTokens();
+    navigate('/login', { replace: true });
+  };
+
   return (
     <Box sx={{ flexGrow: 1 }}>
       <AppBar position="static">
@@ -31,6 +42,9 @@ const Layout = ({ children }) => {
               {item.label}
             </Button>
           ))}
+          <Button color="inherit" onClick={handleLogout}>
+            Logout
+          </Button>
         </Toolbar>
       </AppBar>
       <Container maxWidth="lg" sx={{ mt: 4, mb: 4 }}>
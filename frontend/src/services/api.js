@@ -9,9 +9,76 @@ const api = axios.create({
   },
 });
 
+const TOKENS_KEY = 'pizzashop.tokens';
+
+export const getTokens = () => JSON.parse(localStorage.getItem(TOKENS_KEY) || 'null');
+export const setTokens = (tokens) => localStorage.setItem(TOKENS_KEY, JSON.stringify(tokens));
+export const clearTokens = () => localStorage.removeItem(TOKENS_KEY);
+
+// Attach the access token to every request
+api.interceptors.request.use((config) => {
+  const tokens = getTokens();
+  if (tokens) {
+    config.headers.Authorization = `Bearer ${tokens.access_token}`;
+  }
+  return config;
+});
+
+// On a 401, try the refresh token once before sending the user to the login page
+let refreshing = null;
+api.interceptors.response.use(
+  (response) => response,
+  async (error) => {
+    const original = error.config;
+    const tokens = getTokens();
+    if (error.response?.status !== 401 || original._retried || !tokens || original.url.startsWith('/auth/')) {
+      if (error.response?.status === 401 && !original.url.startsWith('/auth/login')) {
+        clearTokens();
+        window.location.assign('/login');
+      }
+      return Promise.reject(error);
+    }
+
+    original._retried = true;
+    try {
+      refreshing = refreshing || axios.post(`${API_BASE_URL}/auth/refresh`, { refresh_token: tokens.refresh_token });
+      const response = await refreshing;
+      setTokens(response.data.data);
+    } catch (refreshError) {
+      clearTokens();
+      window.location.assign('/login');
+      return Promise.reject(refreshError);
+    } finally {
+      refreshing = null;
+    }
+    return api(original);
+  }
+);
+
+// List endpoints return 50 rows by default. Screens that show a whole list
+// follow next_cursor until every page has been loaded.
+const getAllPages = async (path, params = {}) => {
+  const rows = [];
+  let cursor;
+  do {
+    const response = await api.get(path, { params: { ...params, limit: 500, cursor } });
+    rows.push(...(response.data.data || []));
+    cursor = response.data.pagination?.next_cursor;
+  } while (cursor);
+  return rows;
+};
+
+// Auth API
+export const authAPI = {
+  login: (username, password) => api.post('/auth/login', { username, password }),
+  logout: () => api.post('/auth/logout', { refresh_token: getTokens()?.refresh_token }),
+  me: () => api.get('/auth/me'),
+};
+
 // Items API
 export const itemsAPI = {
-  getAll: () => api.get('/items'),
+  getAll: (params) => api.get('/items', { params }),
+  getAllPages: (params) => getAllPages('/items', params),
   create: (item) => api.post('/items', item),
   update: (id, item) => api.put(`/items/${id}`, item),
   delete: (id) => api.delete(`/items/${id}`),
@@ -19,7 +86,7 @@ export const itemsAPI = {
 
 // Categories API
 export const categoriesAPI = {
-  getAll: () => api.get('/categories'),
+  getAll: (params) => api.get('/categories', { params }),
   getById: (id) => api.get(`/categories/${id}`),
   create: (category) => api.post('/categories', category),
   update: (id, category) => api.put(`/categories/${id}`, category),
@@ -28,14 +95,16 @@ export const categoriesAPI = {
 
 // Invoices API
 export const invoicesAPI = {
-  getAll: () => api.get('/invoices'),
+  getAll: (params) => api.get('/invoices', { params }),
+  getAllPages: (params) => getAllPages('/invoices', params),
   getById: (id) => api.get(`/invoices/${id}`),
   create: (invoice) => api.post('/invoices', invoice),
 };
 
 // Customers API
 export const customersAPI = {
-  getAll: () => api.get('/customers'),
+  getAll: (params) => api.get('/customers', { params }),
+  getAllPages: (params) => getAllPages('/customers', params),
   getById: (id) => api.get(`/customers/${id}`),
   create: (customer) => api.post('/customers', customer),
   update: (id, customer) => api.put(`/customers/${id}`, customer),